@@ -0,0 +1,120 @@
+// Package accesslog aggregates ImageFlux requests in access logs by transformation.
+//
+// It reads access logs of CDNs or ImageFlux in the combined log format or in JSON Lines,
+// parses the parameters of each request, and reports which transformations dominate the traffic,
+// and which transformations are nearly the same and waste the cache space.
+package accesslog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Entry is a request in an access log.
+type Entry struct {
+	// Path is the request target, e.g. "/c/w=200/images/1.jpg".
+	// It may be an absolute URL.
+	Path string
+
+	// Status is the HTTP status code. It is zero if unknown.
+	Status int
+
+	// Bytes is the size of the response body in bytes.
+	Bytes int64
+}
+
+// combinedPattern matches the combined log format and the common log format:
+//
+//	host ident user [time] "method target protocol" status bytes "referer" "user-agent"
+var combinedPattern = regexp.MustCompile(`^\S+ \S+ \S+ \[[^\]]*\] "\S+ (\S+)(?: [^"]*)?" (\d{3}) (\d+|-)`)
+
+// JSON field names of the request target, the status code and the response size.
+// The first field found is used.
+var (
+	jsonPathFields   = []string{"path", "uri", "request_uri", "url", "request"}
+	jsonStatusFields = []string{"status", "status_code"}
+	jsonBytesFields  = []string{"bytes", "body_bytes_sent", "bytes_sent", "size", "response_bytes"}
+)
+
+// ParseLine parses a line of an access log.
+// A line that starts with '{' is parsed as JSON, and the others are parsed as the combined log format.
+func ParseLine(line string) (Entry, error) {
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "{") {
+		return parseJSON(line)
+	}
+	return parseCombined(line)
+}
+
+func parseCombined(line string) (Entry, error) {
+	m := combinedPattern.FindStringSubmatch(line)
+	if m == nil {
+		return Entry{}, errors.New("accesslog: invalid combined log format")
+	}
+	status, _ := strconv.Atoi(m[2])
+	var size int64
+	if m[3] != "-" {
+		var err error
+		size, err = strconv.ParseInt(m[3], 10, 64)
+		if err != nil {
+			return Entry{}, fmt.Errorf("accesslog: invalid size %q: %w", m[3], err)
+		}
+	}
+	return Entry{
+		Path:   m[1],
+		Status: status,
+		Bytes:  size,
+	}, nil
+}
+
+func parseJSON(line string) (Entry, error) {
+	var fields map[string]any
+	if err := json.Unmarshal([]byte(line), &fields); err != nil {
+		return Entry{}, fmt.Errorf("accesslog: invalid JSON: %w", err)
+	}
+
+	var entry Entry
+	for _, name := range jsonPathFields {
+		if s, ok := fields[name].(string); ok && s != "" {
+			entry.Path = s
+			break
+		}
+	}
+	if entry.Path == "" {
+		return Entry{}, errors.New("accesslog: the request path is not found")
+	}
+	// the request line, e.g. "GET /c/w=200/images/1.jpg HTTP/1.1".
+	if method, rest, ok := strings.Cut(entry.Path, " "); ok && !strings.Contains(method, "/") {
+		entry.Path, _, _ = strings.Cut(rest, " ")
+	}
+
+	for _, name := range jsonStatusFields {
+		if v, ok := jsonInt(fields[name]); ok {
+			entry.Status = int(v)
+			break
+		}
+	}
+	for _, name := range jsonBytesFields {
+		if v, ok := jsonInt(fields[name]); ok {
+			entry.Bytes = v
+			break
+		}
+	}
+	return entry, nil
+}
+
+// jsonInt converts a JSON number or a numeric string into an integer.
+func jsonInt(v any) (int64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return int64(v), true
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
@@ -0,0 +1,64 @@
+package accesslog
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want Entry
+	}{
+		{
+			line: `127.0.0.1 - - [10/Oct/2026:13:55:36 +0900] "GET /c/w=200/images/1.jpg HTTP/1.1" 200 2326 "-" "Mozilla/5.0"`,
+			want: Entry{Path: "/c/w=200/images/1.jpg", Status: 200, Bytes: 2326},
+		},
+		{
+			// the common log format
+			line: `127.0.0.1 - frank [10/Oct/2026:13:55:36 +0900] "GET /images/1.jpg HTTP/1.0" 304 -`,
+			want: Entry{Path: "/images/1.jpg", Status: 304},
+		},
+		{
+			line: `{"path":"/c/w=200/images/1.jpg","status":200,"bytes":2326}`,
+			want: Entry{Path: "/c/w=200/images/1.jpg", Status: 200, Bytes: 2326},
+		},
+		{
+			// nginx style
+			line: `{"request_uri":"/c/w=200/images/1.jpg","status":"200","body_bytes_sent":"2326"}`,
+			want: Entry{Path: "/c/w=200/images/1.jpg", Status: 200, Bytes: 2326},
+		},
+		{
+			// the request line
+			line: `{"request":"GET /c/w=200/images/1.jpg HTTP/1.1","status_code":200,"size":2326}`,
+			want: Entry{Path: "/c/w=200/images/1.jpg", Status: 200, Bytes: 2326},
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLine(tt.line)
+		if err != nil {
+			t.Errorf("ParseLine(%q) returned error: %v", tt.line, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("ParseLine(%q) mismatch (-want +got):\n%s", tt.line, diff)
+		}
+	}
+}
+
+func TestParseLine_error(t *testing.T) {
+	tests := []string{
+		"",
+		"GET /images/1.jpg",
+		`{"path":`,
+		`{"status":200}`,
+	}
+
+	for _, tt := range tests {
+		if _, err := ParseLine(tt); err == nil {
+			t.Errorf("ParseLine(%q) should return error", tt)
+		}
+	}
+}
@@ -0,0 +1,478 @@
+package accesslog
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+// DefaultTolerance is the default relative tolerance of Analyzer.Tolerance.
+const DefaultTolerance = 0.02
+
+// Analyzer aggregates requests by transformation.
+// The zero value is ready to use.
+type Analyzer struct {
+	// Proxy is the proxy that serves the requests.
+	// It is used to strip the path prefix. The signatures are not verified.
+	// If it is nil, the zero Proxy is used.
+	Proxy *imageflux.Proxy
+
+	// Presets are the configs keyed by the preset names.
+	// A request belongs to the preset whose canonical form is the same as the config of the request.
+	Presets map[string]*imageflux.Config
+
+	// Tolerance is the relative difference of the numeric parameters of nearly the same configs.
+	// For example, with the tolerance 0.02, "w=199" and "w=200" are nearly the same,
+	// but "w=190" and "w=200" are not.
+	// If it is zero, DefaultTolerance is used.
+	Tolerance float64
+
+	requests, bytes, errors int64
+	failed, untransformed   Stat
+	configs                 map[string]*Stat
+	presets                 map[string]string // canonical config -> preset name
+}
+
+// Stat is the statistics of requests.
+type Stat struct {
+	// Requests is the number of the requests.
+	Requests int64 `json:"requests"`
+
+	// Bytes is the total size of the responses in bytes.
+	Bytes int64 `json:"bytes"`
+}
+
+func (s *Stat) add(other Stat) {
+	s.Requests += other.Requests
+	s.Bytes += other.Bytes
+}
+
+// Add adds the request e.
+// It returns an error if the parameters of the request can't be parsed.
+//
+// The requests whose status is not 2xx, and the requests that don't transform the images
+// such as "/favicon.ico" are not aggregated by config.
+// They are counted in Report.Failed and Report.Untransformed.
+func (a *Analyzer) Add(e Entry) error {
+	if e.Status != 0 && (e.Status < 200 || e.Status >= 300) {
+		a.failed.add(Stat{Requests: 1, Bytes: e.Bytes})
+		return nil
+	}
+	key, err := a.canonical(e.Path)
+	if err != nil {
+		a.errors++
+		return err
+	}
+	if key == emptyConfig {
+		a.untransformed.add(Stat{Requests: 1, Bytes: e.Bytes})
+		return nil
+	}
+	if a.configs == nil {
+		a.configs = make(map[string]*Stat)
+	}
+	stat, ok := a.configs[key]
+	if !ok {
+		stat = &Stat{}
+		a.configs[key] = stat
+	}
+	stat.add(Stat{Requests: 1, Bytes: e.Bytes})
+	a.requests++
+	a.bytes += e.Bytes
+	return nil
+}
+
+// Read reads the access log from r, and adds the requests.
+// The lines that can't be parsed are counted as errors, and skipped.
+func (a *Analyzer) Read(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		e, err := ParseLine(line)
+		if err != nil {
+			a.errors++
+			continue
+		}
+		// the error is counted in Add.
+		_ = a.Add(e)
+	}
+	return scanner.Err()
+}
+
+func (a *Analyzer) proxy() *imageflux.Proxy {
+	if a.Proxy != nil {
+		return a.Proxy
+	}
+	return &imageflux.Proxy{}
+}
+
+// canonical returns the canonical form of the config of the request path.
+// The expiration time is ignored because it differs in each URL.
+func (a *Analyzer) canonical(path string) (string, error) {
+	res, err := a.proxy().Verify(path)
+	if err != nil {
+		return "", err
+	}
+	return canonicalString(res.Image.Config), nil
+}
+
+// emptyConfig is the canonical form of the config that doesn't transform the images.
+var emptyConfig = canonicalString(&imageflux.Config{})
+
+func canonicalString(c *imageflux.Config) string {
+	cfg := *c
+	cfg.Expires = time.Time{}
+	return cfg.Canonical().String()
+}
+
+func (a *Analyzer) presetName(config string) string {
+	if a.presets == nil {
+		a.presets = make(map[string]string, len(a.Presets))
+		names := make([]string, 0, len(a.Presets))
+		for name := range a.Presets {
+			names = append(names, name)
+		}
+		// the first name in the lexical order wins if presets have the same config.
+		slices.Sort(names)
+		slices.Reverse(names)
+		for _, name := range names {
+			a.presets[canonicalString(a.Presets[name])] = name
+		}
+	}
+	return a.presets[config]
+}
+
+// Report is the result of the analysis.
+// The statistics are sorted by the number of the requests in descending order.
+type Report struct {
+	// Requests and Bytes are the total of the requests.
+	Stat
+
+	// Errors is the number of the lines that can't be parsed.
+	Errors int64 `json:"errors"`
+
+	// Failed is the total of the requests whose status is not 2xx.
+	// They are not included in Requests and Bytes.
+	Failed Stat `json:"failed"`
+
+	// Untransformed is the total of the requests that don't transform the images,
+	// e.g. the requests that have no parameters such as "/favicon.ico".
+	// They are not included in Requests and Bytes.
+	Untransformed Stat `json:"untransformed"`
+
+	// Configs are the statistics by canonical config.
+	Configs []ConfigStat `json:"configs"`
+
+	// Presets are the statistics by preset.
+	// The requests that don't belong to any preset are aggregated into the empty name.
+	Presets []PresetStat `json:"presets"`
+
+	// Params are the statistics by parameter, e.g. "w=200".
+	Params []ParamStat `json:"params"`
+
+	// NearDuplicates are the groups of the configs that are nearly the same.
+	NearDuplicates []NearDuplicate `json:"near_duplicates"`
+}
+
+// ConfigStat is the statistics of a config.
+type ConfigStat struct {
+	// Config is the canonical form of the config.
+	Config string `json:"config"`
+
+	// Preset is the name of the preset that the config belongs to.
+	Preset string `json:"preset,omitempty"`
+
+	Stat
+}
+
+// PresetStat is the statistics of a preset.
+type PresetStat struct {
+	// Preset is the name of the preset.
+	Preset string `json:"preset"`
+
+	Stat
+}
+
+// ParamStat is the statistics of a parameter.
+type ParamStat struct {
+	// Param is the parameter, e.g. "w=200".
+	Param string `json:"param"`
+
+	Stat
+}
+
+// NearDuplicate is a group of the configs that are nearly the same.
+// They could be merged into one config to save the cache space.
+type NearDuplicate struct {
+	// Configs are the canonical forms of the configs.
+	Configs []string `json:"configs"`
+
+	// Stat is the total of the configs.
+	Stat
+}
+
+// Report returns the result of the analysis.
+func (a *Analyzer) Report() *Report {
+	r := &Report{
+		Stat:           Stat{Requests: a.requests, Bytes: a.bytes},
+		Errors:         a.errors,
+		Failed:         a.failed,
+		Untransformed:  a.untransformed,
+		Configs:        []ConfigStat{},
+		Presets:        []PresetStat{},
+		Params:         []ParamStat{},
+		NearDuplicates: []NearDuplicate{},
+	}
+
+	presets := map[string]*Stat{}
+	params := map[string]*Stat{}
+	for config, stat := range a.configs {
+		preset := a.presetName(config)
+		r.Configs = append(r.Configs, ConfigStat{
+			Config: config,
+			Preset: preset,
+			Stat:   *stat,
+		})
+		addStat(presets, preset, *stat)
+		for _, p := range splitParams(config) {
+			addStat(params, p.String(), *stat)
+		}
+	}
+	sortStats(r.Configs, func(s ConfigStat) (Stat, string) { return s.Stat, s.Config })
+
+	for preset, stat := range presets {
+		r.Presets = append(r.Presets, PresetStat{Preset: preset, Stat: *stat})
+	}
+	sortStats(r.Presets, func(s PresetStat) (Stat, string) { return s.Stat, s.Preset })
+
+	for param, stat := range params {
+		r.Params = append(r.Params, ParamStat{Param: param, Stat: *stat})
+	}
+	sortStats(r.Params, func(s ParamStat) (Stat, string) { return s.Stat, s.Param })
+
+	r.NearDuplicates = a.nearDuplicates(r.Configs)
+	sortStats(r.NearDuplicates, func(s NearDuplicate) (Stat, string) { return s.Stat, s.Configs[0] })
+	return r
+}
+
+func addStat(m map[string]*Stat, key string, stat Stat) {
+	s, ok := m[key]
+	if !ok {
+		s = &Stat{}
+		m[key] = s
+	}
+	s.add(stat)
+}
+
+// sortStats sorts the statistics by the number of the requests in descending order, and then by the key.
+func sortStats[T any](s []T, key func(T) (Stat, string)) {
+	slices.SortFunc(s, func(a, b T) int {
+		statA, keyA := key(a)
+		statB, keyB := key(b)
+		if c := cmp.Compare(statB.Requests, statA.Requests); c != 0 {
+			return c
+		}
+		return cmp.Compare(keyA, keyB)
+	})
+}
+
+// param is a parameter of a config.
+type param struct {
+	key, value string
+}
+
+func (p param) String() string {
+	return p.key + "=" + p.value
+}
+
+// splitParams splits the canonical form of a config into the parameters.
+func splitParams(config string) []param {
+	var params []param
+	t := imageflux.NewTokenizer(config)
+	for t.Next() {
+		tok := t.Token()
+		params = append(params, param{key: tok.Key, value: tok.RawValue})
+	}
+	return params
+}
+
+// nearDuplicates returns the groups of the configs that are nearly the same.
+// The configs must be sorted.
+func (a *Analyzer) nearDuplicates(configs []ConfigStat) []NearDuplicate {
+	tolerance := a.Tolerance
+	if tolerance == 0 {
+		tolerance = DefaultTolerance
+	}
+
+	// group the configs by the shape: the keys and the non-numeric values.
+	shapes := map[string][]int{}
+	var order []string
+	params := make([][]param, len(configs))
+	for i, c := range configs {
+		params[i] = splitParams(c.Config)
+		var shape strings.Builder
+		for _, p := range params[i] {
+			shape.WriteString(p.key)
+			shape.WriteByte('=')
+			if _, err := strconv.ParseFloat(p.value, 64); err != nil {
+				shape.WriteString(p.value)
+			}
+			shape.WriteByte(',')
+		}
+		key := shape.String()
+		if _, ok := shapes[key]; !ok {
+			order = append(order, key)
+		}
+		shapes[key] = append(shapes[key], i)
+	}
+
+	// union the configs of the same shape whose numeric values are close.
+	parent := make([]int, len(configs))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(i int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for _, key := range order {
+		members := shapes[key]
+		if len(members) < 2 {
+			continue
+		}
+
+		// sort the members by the numeric parameter that has the most distinct values,
+		// and compare each member only with the following members close to it.
+		dim := sweepDimension(params, members)
+		values := make(map[int]float64, len(members))
+		for _, i := range members {
+			values[i], _ = strconv.ParseFloat(params[i][dim].value, 64)
+		}
+		slices.SortFunc(members, func(x, y int) int {
+			return cmp.Compare(values[x], values[y])
+		})
+		for i, x := range members {
+			for _, y := range members[i+1:] {
+				if tolerance < 1 && !isNear(values[x], values[y], tolerance) {
+					// the values are sorted, so the following members are farther.
+					break
+				}
+				if near(params[x], params[y], tolerance) {
+					parent[find(y)] = find(x)
+				}
+			}
+		}
+	}
+
+	groups := map[int]*NearDuplicate{}
+	var roots []int
+	for i, c := range configs {
+		root := find(i)
+		g, ok := groups[root]
+		if !ok {
+			g = &NearDuplicate{}
+			groups[root] = g
+			roots = append(roots, root)
+		}
+		g.Configs = append(g.Configs, c.Config)
+		g.add(c.Stat)
+	}
+	ret := []NearDuplicate{}
+	for _, root := range roots {
+		if g := groups[root]; len(g.Configs) > 1 {
+			ret = append(ret, *g)
+		}
+	}
+	return ret
+}
+
+// sweepDimension returns the index of the numeric parameter that has the most distinct values in members.
+// The members must have the same shape, and have at least one numeric parameter.
+func sweepDimension(params [][]param, members []int) int {
+	best, bestCount := 0, -1
+	for dim, p := range params[members[0]] {
+		if _, err := strconv.ParseFloat(p.value, 64); err != nil {
+			continue
+		}
+		distinct := map[string]struct{}{}
+		for _, i := range members {
+			distinct[params[i][dim].value] = struct{}{}
+		}
+		if len(distinct) > bestCount {
+			best, bestCount = dim, len(distinct)
+		}
+	}
+	return best
+}
+
+// near reports whether the numeric values of the parameters are close.
+// The parameters must have the same shape.
+func near(a, b []param, tolerance float64) bool {
+	for i := range a {
+		if a[i].value == b[i].value {
+			continue
+		}
+		x, err1 := strconv.ParseFloat(a[i].value, 64)
+		y, err2 := strconv.ParseFloat(b[i].value, 64)
+		if err1 != nil || err2 != nil {
+			return false
+		}
+		if !isNear(x, y, tolerance) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNear reports whether the relative difference of x and y is within tolerance.
+func isNear(x, y, tolerance float64) bool {
+	return math.Abs(x-y) <= tolerance*max(math.Abs(x), math.Abs(y))
+}
+
+// WriteCSV writes the table of the report in CSV.
+// The table is one of "configs", "presets", "params" and "near_duplicates".
+func (r *Report) WriteCSV(w io.Writer, table string) error {
+	cw := csv.NewWriter(w)
+	itoa := func(i int64) string { return strconv.FormatInt(i, 10) }
+	switch table {
+	case "configs":
+		cw.Write([]string{"config", "preset", "requests", "bytes"})
+		for _, s := range r.Configs {
+			cw.Write([]string{s.Config, s.Preset, itoa(s.Requests), itoa(s.Bytes)})
+		}
+	case "presets":
+		cw.Write([]string{"preset", "requests", "bytes"})
+		for _, s := range r.Presets {
+			cw.Write([]string{s.Preset, itoa(s.Requests), itoa(s.Bytes)})
+		}
+	case "params":
+		cw.Write([]string{"param", "requests", "bytes"})
+		for _, s := range r.Params {
+			cw.Write([]string{s.Param, itoa(s.Requests), itoa(s.Bytes)})
+		}
+	case "near_duplicates":
+		cw.Write([]string{"configs", "requests", "bytes"})
+		for _, s := range r.NearDuplicates {
+			cw.Write([]string{strings.Join(s.Configs, " "), itoa(s.Requests), itoa(s.Bytes)})
+		}
+	default:
+		return fmt.Errorf("accesslog: unknown table %q", table)
+	}
+	cw.Flush()
+	return cw.Error()
+}
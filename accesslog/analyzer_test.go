@@ -0,0 +1,135 @@
+package accesslog
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/go-imageflux"
+)
+
+const testLog = `127.0.0.1 - - [10/Oct/2026:13:55:36 +0900] "GET /c/w=200,h=100/images/1.jpg HTTP/1.1" 200 1000 "-" "-"
+127.0.0.1 - - [10/Oct/2026:13:55:37 +0900] "GET /c/h=100,w=200/images/2.jpg HTTP/1.1" 200 2000 "-" "-"
+{"path":"/c/w=199,h=100/images/3.jpg","status":200,"bytes":500}
+{"path":"/c/w=200,h=100,expires=2026-01-01T00:00:00Z/images/4.jpg","status":200,"bytes":700}
+{"path":"/c/w=100,f=webp/images/1.jpg","status":200,"bytes":300}
+{"path":"/c/w=abc/images/1.jpg","status":200,"bytes":100}
+{"path":"/c/w=200,h=100/images/5.jpg","status":404,"bytes":150}
+{"path":"/c/w=100,f=webp/images/1.jpg","status":304,"bytes":0}
+{"path":"/favicon.ico","status":200,"bytes":50}
+{"path":"/images/1.jpg","bytes":2000}
+broken line
+`
+
+func TestAnalyzer(t *testing.T) {
+	a := &Analyzer{
+		Presets: map[string]*imageflux.Config{
+			"thumbnail": {Width: 200, Height: 100},
+		},
+	}
+	if err := a.Read(strings.NewReader(testLog)); err != nil {
+		t.Fatal(err)
+	}
+	got := a.Report()
+	want := &Report{
+		Stat:          Stat{Requests: 5, Bytes: 4500},
+		Errors:        2,
+		Failed:        Stat{Requests: 2, Bytes: 150},
+		Untransformed: Stat{Requests: 2, Bytes: 2050},
+		Configs: []ConfigStat{
+			{Config: "w=200%2Ch=100", Preset: "thumbnail", Stat: Stat{Requests: 3, Bytes: 3700}},
+			{Config: "w=100%2Cf=webp", Stat: Stat{Requests: 1, Bytes: 300}},
+			{Config: "w=199%2Ch=100", Stat: Stat{Requests: 1, Bytes: 500}},
+		},
+		Presets: []PresetStat{
+			{Preset: "thumbnail", Stat: Stat{Requests: 3, Bytes: 3700}},
+			{Preset: "", Stat: Stat{Requests: 2, Bytes: 800}},
+		},
+		Params: []ParamStat{
+			{Param: "h=100", Stat: Stat{Requests: 4, Bytes: 4200}},
+			{Param: "w=200", Stat: Stat{Requests: 3, Bytes: 3700}},
+			{Param: "f=webp", Stat: Stat{Requests: 1, Bytes: 300}},
+			{Param: "w=100", Stat: Stat{Requests: 1, Bytes: 300}},
+			{Param: "w=199", Stat: Stat{Requests: 1, Bytes: 500}},
+		},
+		NearDuplicates: []NearDuplicate{
+			{Configs: []string{"w=200%2Ch=100", "w=199%2Ch=100"}, Stat: Stat{Requests: 4, Bytes: 4200}},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Report mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnalyzer_Tolerance(t *testing.T) {
+	tests := []struct {
+		tolerance float64
+		widths    []string
+		want      int
+	}{
+		{0, []string{"199", "200"}, 1},
+		{0, []string{"190", "200"}, 0},
+		{0.1, []string{"190", "200"}, 1},
+		{0, []string{"196", "198", "200"}, 1}, // 196 and 200 are grouped through 198
+	}
+
+	for _, tt := range tests {
+		a := &Analyzer{Tolerance: tt.tolerance}
+		for _, w := range tt.widths {
+			if err := a.Add(Entry{Path: "/c/w=" + w + "/images/1.jpg"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		got := a.Report().NearDuplicates
+		if len(got) != tt.want {
+			t.Errorf("tolerance %v, widths %v: want %d groups, got %v", tt.tolerance, tt.widths, tt.want, got)
+		}
+	}
+}
+
+func TestAnalyzer_NearDuplicates(t *testing.T) {
+	a := &Analyzer{}
+	for _, path := range []string{
+		"/c/w=200,h=100/1.jpg",
+		"/c/w=199,h=100/1.jpg",
+		"/c/w=198,h=50/1.jpg",  // h is far from the others
+		"/c/w=400,h=100/1.jpg", // w is far from the others
+		"/c/w=400,h=101/1.jpg",
+		"/c/w=200,f=webp/1.jpg", // the shape is different
+	} {
+		if err := a.Add(Entry{Path: path}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got [][]string
+	for _, d := range a.Report().NearDuplicates {
+		got = append(got, d.Configs)
+	}
+	want := [][]string{
+		{"w=199%2Ch=100", "w=200%2Ch=100"},
+		{"w=400%2Ch=100", "w=400%2Ch=101"},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("NearDuplicates mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestReport_WriteCSV(t *testing.T) {
+	a := &Analyzer{}
+	if err := a.Read(strings.NewReader(testLog)); err != nil {
+		t.Fatal(err)
+	}
+	var buf strings.Builder
+	if err := a.Report().WriteCSV(&buf, "near_duplicates"); err != nil {
+		t.Fatal(err)
+	}
+	want := "configs,requests,bytes\n" +
+		"w=200%2Ch=100 w=199%2Ch=100,4,4200\n"
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("WriteCSV mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := a.Report().WriteCSV(&buf, "unknown"); err == nil {
+		t.Error("WriteCSV should return error for an unknown table")
+	}
+}
@@ -0,0 +1,258 @@
+// Package audit finds stale ImageFlux URLs in contents, such as HTML, JSON and Markdown files.
+//
+// After rotating the signing secret or changing the parameters,
+// the URLs embedded in the contents may have bad signatures, expire, or use deprecated parameters.
+// The Scanner extracts the ImageFlux URLs of the configured hosts from the contents,
+// verifies them, and reports them with their locations.
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+// Status is the status of an ImageFlux URL.
+type Status string
+
+const (
+	// StatusValid means the URL is valid.
+	StatusValid Status = "valid"
+
+	// StatusMalformed means the URL can't be parsed.
+	StatusMalformed Status = "malformed"
+
+	// StatusBadSignature means the URL is not signed with any of the secrets.
+	StatusBadSignature Status = "bad_signature"
+
+	// StatusExpired means the URL has expired.
+	StatusExpired Status = "expired"
+
+	// StatusExpiringSoon means the URL expires within Scanner.ExpiringWithin.
+	StatusExpiringSoon Status = "expiring_soon"
+
+	// StatusDeprecated means the URL uses deprecated parameters,
+	// or is signed with one of the previous secrets.
+	StatusDeprecated Status = "deprecated"
+)
+
+// Finding is an ImageFlux URL found in the contents.
+type Finding struct {
+	// File is the name of the file.
+	File string `json:"file"`
+
+	// Line and Column are the position of the URL, starting at 1.
+	// Column is counted in bytes.
+	Line   int `json:"line"`
+	Column int `json:"column"`
+
+	// URL is the URL found.
+	URL string `json:"url"`
+
+	// Status is the status of the URL.
+	Status Status `json:"status"`
+
+	// Expires is the expiration time of the URL, if any.
+	Expires *time.Time `json:"expires,omitempty"`
+
+	// Messages describe the problems of the URL.
+	Messages []string `json:"messages,omitempty"`
+}
+
+// Scanner finds ImageFlux URLs in contents and verifies them.
+type Scanner struct {
+	// Proxy is the proxy to verify the URLs.
+	// If it has no signing secret, the signatures are not verified.
+	// If it is nil, the zero Proxy is used, and Hosts must be set.
+	Proxy *imageflux.Proxy
+
+	// Hosts are the hosts of the ImageFlux URLs.
+	// If it is empty, Proxy.Host and Proxy.Hosts are used.
+	Hosts []string
+
+	// ExpiringWithin is the period in which the URLs are reported as expiring soon.
+	ExpiringWithin time.Duration
+
+	// Now returns the current time. If it is nil, time.Now is used.
+	Now func() time.Time
+}
+
+// ScanFile scans the file named name.
+func (s *Scanner) ScanFile(name string) ([]Finding, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return s.Scan(name, f)
+}
+
+// Scan scans the contents read from r. name is used as Finding.File.
+func (s *Scanner) Scan(name string, r io.Reader) ([]Finding, error) {
+	pattern, err := s.pattern()
+	if err != nil {
+		return nil, err
+	}
+
+	var findings []Finding
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := scanner.Text()
+		for _, loc := range pattern.FindAllStringIndex(text, -1) {
+			rawURL := trimURL(unescapeJSON(text[loc[0]:loc[1]]))
+			f := s.Check(rawURL)
+			f.File = name
+			f.Line = line
+			f.Column = loc[0] + 1
+			findings = append(findings, f)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("audit: failed to read %s: %w", name, err)
+	}
+	return findings, nil
+}
+
+// pattern returns the regular expression that matches the ImageFlux URLs.
+func (s *Scanner) pattern() (*regexp.Regexp, error) {
+	hosts := s.Hosts
+	if len(hosts) == 0 {
+		proxy := s.proxy()
+		if proxy.Host != "" {
+			hosts = append(hosts, proxy.Host)
+		}
+		hosts = append(hosts, proxy.Hosts...)
+	}
+	if len(hosts) == 0 {
+		return nil, errors.New("audit: no hosts are configured")
+	}
+	quoted := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		quoted = append(quoted, regexp.QuoteMeta(host))
+	}
+	// the URL continues until the whitespace, the quotes or the brackets of HTML.
+	// The slashes may be escaped as "\/" in JSON strings,
+	// and the URL may contain the escape sequences "\/" and "\uXXXX" of JSON.
+	return regexp.Compile(`(?:https?:)?\\?/\\?/(?:` + strings.Join(quoted, "|") + `)(?::\d+)?\\?/` +
+		`(?:[^\s"'<>\\` + "`" + `]|\\/|\\u[0-9A-Fa-f]{4})*`)
+}
+
+// unescapeJSON decodes the escape sequences of JSON strings in s.
+// It returns s as it is if s has no escape sequences or they are invalid.
+func unescapeJSON(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var ret string
+	if err := json.Unmarshal([]byte(`"`+s+`"`), &ret); err != nil {
+		return s
+	}
+	return ret
+}
+
+// trimURL removes the characters that are not a part of the URL,
+// e.g. the closing parenthesis of Markdown links and the trailing punctuation.
+// It also decodes "&amp;" of HTML.
+func trimURL(s string) string {
+	s = strings.ReplaceAll(s, "&amp;", "&")
+	for len(s) > 0 {
+		switch s[len(s)-1] {
+		case '.', ',', ';', ':', '!', '?', ']', '}':
+			s = s[:len(s)-1]
+			continue
+		case ')':
+			// ImageFlux URLs may contain balanced parentheses, e.g. l=(...).
+			if strings.Count(s, "(") < strings.Count(s, ")") {
+				s = s[:len(s)-1]
+				continue
+			}
+		}
+		return s
+	}
+	return s
+}
+
+// Check verifies rawURL. The location of the result is empty.
+func (s *Scanner) Check(rawURL string) Finding {
+	f := Finding{
+		URL:    rawURL,
+		Status: StatusValid,
+	}
+	if strings.HasPrefix(rawURL, "//") {
+		rawURL = "https:" + rawURL
+	}
+	proxy := s.proxy()
+	res, err := proxy.Verify(rawURL)
+	if err != nil {
+		f.Status = StatusMalformed
+		f.Messages = append(f.Messages, err.Error())
+		return f
+	}
+
+	var statuses []Status
+	if len(proxy.SecretBytes) > 0 || proxy.Secret != "" {
+		switch {
+		case !res.Signed:
+			statuses = append(statuses, StatusBadSignature)
+			f.Messages = append(f.Messages, "the URL is not signed")
+		case !res.Valid:
+			statuses = append(statuses, StatusBadSignature)
+			f.Messages = append(f.Messages, "the signature is invalid")
+		case res.KeyIndex > 0:
+			statuses = append(statuses, StatusDeprecated)
+			f.Messages = append(f.Messages, fmt.Sprintf("the URL is signed with the previous secret %d", res.KeyIndex-1))
+		}
+	}
+	if !res.Expires.IsZero() {
+		expires := res.Expires
+		f.Expires = &expires
+		now := s.now()
+		switch {
+		case !expires.After(now):
+			statuses = append(statuses, StatusExpired)
+			f.Messages = append(f.Messages, fmt.Sprintf("the URL expired at %s", expires.Format(time.RFC3339)))
+		case expires.Sub(now) <= s.ExpiringWithin:
+			statuses = append(statuses, StatusExpiringSoon)
+			f.Messages = append(f.Messages, fmt.Sprintf("the URL expires at %s", expires.Format(time.RFC3339)))
+		}
+	}
+	if len(res.Warnings) > 0 {
+		statuses = append(statuses, StatusDeprecated)
+		f.Messages = append(f.Messages, res.Warnings...)
+	}
+
+	// report the most severe status.
+	for _, status := range []Status{StatusBadSignature, StatusExpired, StatusExpiringSoon, StatusDeprecated} {
+		if slices.Contains(statuses, status) {
+			f.Status = status
+			break
+		}
+	}
+	return f
+}
+
+func (s *Scanner) proxy() *imageflux.Proxy {
+	if s.Proxy != nil {
+		return s.Proxy
+	}
+	return &imageflux.Proxy{}
+}
+
+func (s *Scanner) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
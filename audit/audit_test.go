@@ -0,0 +1,190 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+var testNow = time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+func newTestScanner() *Scanner {
+	return &Scanner{
+		Proxy: &imageflux.Proxy{
+			Host:            "demo.imageflux.jp",
+			SecretBytes:     []byte("testsigningsecret"),
+			PreviousSecrets: [][]byte{[]byte("oldsigningsecret")},
+		},
+		ExpiringWithin: 7 * 24 * time.Hour,
+		Now:            func() time.Time { return testNow },
+	}
+}
+
+func TestScanner_Check(t *testing.T) {
+	s := newTestScanner()
+	old := &imageflux.Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("oldsigningsecret"),
+	}
+	other := &imageflux.Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("othersigningsecret"),
+	}
+
+	tests := []struct {
+		url  string
+		want Status
+	}{
+		{s.Proxy.Image("/a.jpg", &imageflux.Config{Width: 200}).SignedURL(), StatusValid},
+		{s.Proxy.Image("/a.jpg", &imageflux.Config{Width: 200, Expires: testNow.Add(30 * 24 * time.Hour)}).SignedURL(), StatusValid},
+		{s.Proxy.Image("/a.jpg", &imageflux.Config{Width: 200, Expires: testNow.Add(24 * time.Hour)}).SignedURL(), StatusExpiringSoon},
+		{s.Proxy.Image("/a.jpg", &imageflux.Config{Width: 200, Expires: testNow.Add(-time.Hour)}).SignedURL(), StatusExpired},
+		{s.Proxy.Image("/a.jpg", &imageflux.Config{Format: imageflux.FormatWebPFromJPEG}).SignedURL(), StatusDeprecated},
+		{old.Image("/a.jpg", &imageflux.Config{Width: 200}).SignedURL(), StatusDeprecated},
+		{other.Image("/a.jpg", &imageflux.Config{Width: 200}).SignedURL(), StatusBadSignature},
+		{other.Image("/a.jpg", &imageflux.Config{Width: 200, Expires: testNow.Add(-time.Hour)}).SignedURL(), StatusBadSignature},
+		{"https://demo.imageflux.jp/c/w=200/a.jpg", StatusBadSignature},
+		{"https://demo.imageflux.jp/c/w=abc/a.jpg", StatusMalformed},
+	}
+	for _, tt := range tests {
+		got := s.Check(tt.url)
+		if got.Status != tt.want {
+			t.Errorf("Check(%q) = %s, want %s: %v", tt.url, got.Status, tt.want, got.Messages)
+		}
+	}
+}
+
+func TestScanner_Check_unsigned(t *testing.T) {
+	s := &Scanner{
+		Proxy: &imageflux.Proxy{Host: "demo.imageflux.jp"},
+	}
+	got := s.Check("https://demo.imageflux.jp/c/w=200/a.jpg")
+	if got.Status != StatusValid {
+		t.Errorf("want %s, got %s: %v", StatusValid, got.Status, got.Messages)
+	}
+}
+
+func TestScanner_Scan(t *testing.T) {
+	s := newTestScanner()
+	valid := s.Proxy.Image("/a.jpg", &imageflux.Config{
+		Width: 200,
+		Overlays: []*imageflux.Overlay{
+			{Path: "/logo.png"},
+		},
+	}).SignedURL()
+	expired := s.Proxy.Image("/b.jpg", &imageflux.Config{Width: 200, Expires: testNow.Add(-time.Hour)}).SignedURL()
+
+	input := "# Title\n" +
+		"![a](" + valid + ") and " + expired + ".\n" +
+		`<img src="` + strings.TrimPrefix(valid, "https:") + `"><img src="https://other.example.com/c.jpg">` + "\n" +
+		`{"image": "` + expired + `"}` + "\n"
+	findings, err := s.Scan("content.md", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type location struct {
+		line, column int
+		url          string
+		status       Status
+	}
+	want := []location{
+		{2, 6, valid, StatusValid},
+		{2, len("![a]("+valid+") and ") + 1, expired, StatusExpired},
+		{3, 11, strings.TrimPrefix(valid, "https:"), StatusValid},
+		{4, 12, expired, StatusExpired},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("want %d findings, got %d: %v", len(want), len(findings), findings)
+	}
+	for i, f := range findings {
+		got := location{f.Line, f.Column, f.URL, f.Status}
+		if got != want[i] {
+			t.Errorf("%d: want %v, got %v", i, want[i], got)
+		}
+		if f.File != "content.md" {
+			t.Errorf("%d: want content.md, got %s", i, f.File)
+		}
+	}
+}
+
+func TestScanner_Scan_json(t *testing.T) {
+	s := newTestScanner()
+	valid := s.Proxy.Image("/a.jpg", &imageflux.Config{Width: 200}).SignedURL() + "?v=1&w=2"
+	expired := s.Proxy.Image("/b.jpg", &imageflux.Config{Width: 200, Expires: testNow.Add(-time.Hour)}).SignedURL()
+
+	// the JSON encoder escapes '&' as "\u0026", and some encoders escape '/' as "\/".
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(map[string]string{"a": valid, "b": expired}); err != nil {
+		t.Fatal(err)
+	}
+	input := strings.ReplaceAll(buf.String(), "/", `\/`)
+	findings, err := s.Scan("content.json", strings.NewReader(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type location struct {
+		column int
+		url    string
+		status Status
+	}
+	want := []location{
+		{strings.Index(input, "https") + 1, valid, StatusValid},
+		{strings.LastIndex(input, "https") + 1, expired, StatusExpired},
+	}
+	if len(findings) != len(want) {
+		t.Fatalf("want %d findings, got %d: %v", len(want), len(findings), findings)
+	}
+	for i, f := range findings {
+		got := location{f.Column, f.URL, f.Status}
+		if got != want[i] {
+			t.Errorf("%d: want %v, got %v", i, want[i], got)
+		}
+	}
+}
+
+func TestScanner_nilProxy(t *testing.T) {
+	s := &Scanner{Hosts: []string{"demo.imageflux.jp"}}
+	findings, err := s.Scan("content.md", strings.NewReader("https://demo.imageflux.jp/c/w=200/a.jpg\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(findings) != 1 || findings[0].Status != StatusValid {
+		t.Errorf("want a valid finding, got %v", findings)
+	}
+
+	s = &Scanner{}
+	if _, err := s.Scan("content.md", strings.NewReader("")); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestScanner_Scan_noHosts(t *testing.T) {
+	s := &Scanner{Proxy: &imageflux.Proxy{}}
+	if _, err := s.Scan("content.md", strings.NewReader("")); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestTrimURL(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"https://demo.imageflux.jp/c/w=200/a.jpg", "https://demo.imageflux.jp/c/w=200/a.jpg"},
+		{"https://demo.imageflux.jp/c/w=200/a.jpg).", "https://demo.imageflux.jp/c/w=200/a.jpg"},
+		{"https://demo.imageflux.jp/c/l=(%2Flogo.png)/a.jpg)", "https://demo.imageflux.jp/c/l=(%2Flogo.png)/a.jpg"},
+		{"https://demo.imageflux.jp/c/l=(%2Flogo.png)", "https://demo.imageflux.jp/c/l=(%2Flogo.png)"},
+		{"https://demo.imageflux.jp/a.jpg?sig=1&amp;v=2", "https://demo.imageflux.jp/a.jpg?sig=1&v=2"},
+	}
+	for _, tt := range tests {
+		if got := trimURL(tt.input); got != tt.want {
+			t.Errorf("trimURL(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package imageflux
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Canonical returns the canonical form of c.
+// Configs that mean the same transformation have the same canonical form,
+// even if they are spelled differently in URLs:
+// e.g. the order of the parameters, the deprecated aliases, ',' or "%2C",
+// redundant default values such as "u=1", the spelling of numbers and colors,
+// and the order of the variables of variable fonts.
+//
+// The canonical form is normalized through its URL representation,
+// so the ratios are rounded in the same way as the parser does.
+// If c can't be represented as valid parameters,
+// the deprecated fields are replaced but the other fields are kept as they are.
+func (c *Config) Canonical() *Config {
+	if c == nil {
+		return &Config{}
+	}
+	modern := c.Modernize()
+	state := parseState{
+		Tokenizer:    Tokenizer{s: modern.String()},
+		config:       &Config{},
+		allowExpired: true,
+	}
+	ret, rest, err := state.parseConfig()
+	if err != nil || rest != "" {
+		return modern
+	}
+
+	// the output format is "auto" by default.
+	if ret.Format == FormatAuto {
+		ret.Format = ""
+	}
+	return ret
+}
+
+// Equal reports whether c and other encode into the same parameters.
+// Use SemanticEqual to ignore the differences of spelling.
+func (c *Config) Equal(other *Config) bool {
+	return c.String() == other.String()
+}
+
+// SemanticEqual reports whether c and other mean the same transformation.
+// It compares the canonical forms of them, including the overlays, the texts and the fonts.
+func (c *Config) SemanticEqual(other *Config) bool {
+	return c.Canonical().String() == other.Canonical().String()
+}
+
+// CanonicalURL returns the canonical form of rawURL.
+// URLs that mean the same image have the same canonical form,
+// so it can be used as a cache key.
+// The scheme, the host and the query parameters other than "sig" are kept as they are.
+//
+// If the proxy has a signing secret, the canonical URL is signed with it,
+// and rawURL must have a valid signature; otherwise ErrInvalidSignature is returned.
+// Expired URLs are accepted because the expiration time is kept in the canonical URL,
+// so the canonical URL expires at the same time.
+func (p *Proxy) CanonicalURL(rawURL string) (string, error) {
+	res, err := p.Verify(rawURL)
+	if err != nil {
+		return "", err
+	}
+	if err := p.checkSignature(res); err != nil {
+		return "", err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", fmt.Errorf("imageflux: invalid url %q: %w", rawURL, err)
+	}
+	img := &Image{
+		Proxy:  p,
+		Path:   res.Image.Path,
+		Config: res.Image.Config.Canonical(),
+	}
+	return p.rewriteURL(u, img), nil
+}
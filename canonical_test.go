@@ -0,0 +1,169 @@
+package imageflux
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"testing"
+	"time"
+)
+
+func TestConfig_SemanticEqual(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		// the order of the parameters
+		{"w=200,h=100", "h=100,w=200", true},
+		// the separators
+		{"w=200,h=100", "w=200%2Ch=100", true},
+		// the deprecated aliases
+		{"c=0:0:100:100,r=2", "oc=0:0:100:100,or=2", true},
+		{"f=webp:jpeg", "f=webp:jpg", true},
+		// the default values
+		{"w=200,u=1", "w=200", true},
+		{"f=auto", "", true},
+		{"w=200,f=auto", "w=200", true},
+		// the spelling of numbers and colors
+		{"dpr=2.0", "dpr=2", true},
+		{"a=2,b=FFFFFF", "a=2,b=ffffff", true},
+		{"ocr=0:0:0.50:0.5", "ocr=0:0:0.5:0.5", true},
+		// overlays
+		{"l=(c=0:0:10:10/a.png)", "l=(oc=0:0:10:10%2Fa.png)", true},
+		{"l=(w=100/a.png)", "l=(w=100/b.png)", false},
+		// texts and fonts
+		{
+			"t=(font=(Roboto%2Cvar=wght:700%2Cvar=wdth:100),size=12,w=400,h=100,text=hello)",
+			"t=(h=100%2Cw=400%2Csize=12.0%2Cfont=(Roboto%2Cvar=wdth:100.0%2Cvar=wght:700)%2Ctext=hello)",
+			true,
+		},
+		{"t=(font=Roboto,size=12,w=400,h=100,text=hello)", "t=(font=Roboto,size=12,w=400,h=100,text=world)", false},
+		// the different transformations
+		{"w=200", "w=201", false},
+		{"l=(w=100/a.png),l=(w=100/b.png)", "l=(w=100/b.png),l=(w=100/a.png)", false},
+	}
+
+	for _, tt := range cases {
+		a, _, err := ParseConfig(tt.a)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.a, err)
+		}
+		b, _, err := ParseConfig(tt.b)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.b, err)
+		}
+		if got := a.SemanticEqual(b); got != tt.want {
+			t.Errorf("%q.SemanticEqual(%q) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.SemanticEqual(a); got != tt.want {
+			t.Errorf("%q.SemanticEqual(%q) = %t, want %t", tt.b, tt.a, got, tt.want)
+		}
+	}
+}
+
+func TestConfig_Equal(t *testing.T) {
+	a := &Config{Width: 200, Clip: image.Rect(0, 0, 100, 100)}
+	b := &Config{Width: 200, OutputClip: image.Rect(0, 0, 100, 100)}
+	if !a.Equal(b) {
+		t.Errorf("%v and %v encode into the same parameters", a, b)
+	}
+
+	a = &Config{Background: color.Gray{Y: 255}}
+	b = &Config{Background: color.NRGBA{R: 255, G: 255, B: 255, A: 255}}
+	if !a.Equal(b) {
+		t.Errorf("%v and %v encode into the same parameters", a, b)
+	}
+
+	a = &Config{Format: FormatWebPFromJPEG}
+	b = &Config{Format: FormatWebPJPEG}
+	if a.Equal(b) {
+		t.Errorf("%v and %v encode into the different parameters", a, b)
+	}
+	if !a.SemanticEqual(b) {
+		t.Errorf("%v and %v mean the same transformation", a, b)
+	}
+}
+
+func TestConfig_Canonical(t *testing.T) {
+	c := &Config{
+		Width:  200,
+		Rotate: RotateTopRight,
+		Format: FormatAuto,
+		Overlays: []*Overlay{
+			{URL: "images/2.png"},
+		},
+	}
+	got := c.Canonical()
+	if got.Rotate != RotateDefault || got.OutputRotate != RotateTopRight {
+		t.Errorf("unexpected rotation: %v, %v", got.Rotate, got.OutputRotate)
+	}
+	if got.Format != "" {
+		t.Errorf("unexpected format: %q", got.Format)
+	}
+	if got.Overlays[0].URL != "" || got.Overlays[0].Path != "/images/2.png" {
+		t.Errorf("unexpected overlay: %#v", got.Overlays[0])
+	}
+	if c.Rotate != RotateTopRight {
+		t.Error("Canonical modified the original config")
+	}
+
+	if got := (*Config)(nil).Canonical(); got.String() != "f=auto" {
+		t.Errorf("nil.Canonical() = %q, want %q", got, "f=auto")
+	}
+}
+
+func TestProxy_CanonicalURL(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	cases := []struct {
+		proxy *Proxy
+		input string
+		want  string
+	}{
+		{
+			proxy: &Proxy{},
+			input: "https://demo.imageflux.jp/c/h=100%2Cw=200%2Cu=1%2Cc=0:0:100:100/images/1.jpg",
+			want:  "https://demo.imageflux.jp/c/w=200%2Ch=100%2Coc=0:0:100:100/images/1.jpg",
+		},
+		{
+			proxy: &Proxy{},
+			input: "https://demo.imageflux.jp/c/w=200,h=100,oc=0:0:100:100/images/1.jpg",
+			want:  "https://demo.imageflux.jp/c/w=200%2Ch=100%2Coc=0:0:100:100/images/1.jpg",
+		},
+		{
+			proxy: &Proxy{
+				SecretBytes: []byte("testsigningsecret"),
+			},
+			input: "https://demo.imageflux.jp/c/w=200,sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=/images/1.jpg",
+			want:  "https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg",
+		},
+	}
+
+	for _, tt := range cases {
+		got, err := tt.proxy.CanonicalURL(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.want, got)
+		}
+	}
+}
+
+func TestProxy_CanonicalURL_invalidSignature(t *testing.T) {
+	p := &Proxy{
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	for _, input := range []string{
+		"https://demo.imageflux.jp/c/sig=1.invalid,w=200/images/1.jpg",
+		"https://demo.imageflux.jp/c/w=200/images/1.jpg",
+	} {
+		_, err := p.CanonicalURL(input)
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%q: want ErrInvalidSignature, got %v", input, err)
+		}
+	}
+}
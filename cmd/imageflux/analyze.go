@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/shogo82148/go-imageflux"
+	"github.com/shogo82148/go-imageflux/accesslog"
+)
+
+func runAnalyze(e *env, cmd command, args []string) int {
+	fs := e.newFlagSet(cmd)
+	prefix := fs.String("path-prefix", "", "the path prefix of the requests, e.g. /imageflux")
+	presets := fs.String("presets", "", `the JSON file of the presets, e.g. {"thumbnail": "w=200,h=200"}`)
+	tolerance := fs.Float64("tolerance", accesslog.DefaultTolerance, "the relative difference of the numeric parameters of nearly the same configs")
+	format := fs.String("format", "json", "the output format: json or csv")
+	table := fs.String("table", "configs", "the table to output in CSV: configs, presets, params or near_duplicates")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *format != "json" && *format != "csv" {
+		return e.fail(fmt.Errorf("unknown format %q", *format))
+	}
+
+	a := &accesslog.Analyzer{
+		Proxy: &imageflux.Proxy{
+			PathPrefix: *prefix,
+		},
+		Tolerance: *tolerance,
+	}
+	if *presets != "" {
+		p, err := loadPresets(*presets)
+		if err != nil {
+			return e.fail(err)
+		}
+		a.Presets = p
+	}
+
+	if fs.NArg() == 0 {
+		if err := a.Read(e.stdin); err != nil {
+			return e.fail(err)
+		}
+	}
+	for _, name := range fs.Args() {
+		if err := analyzeFile(a, name); err != nil {
+			return e.fail(err)
+		}
+	}
+
+	report := a.Report()
+	if *format == "csv" {
+		if err := report.WriteCSV(e.stdout, *table); err != nil {
+			return e.fail(err)
+		}
+		return 0
+	}
+	return e.writeJSON(report)
+}
+
+func analyzeFile(a *accesslog.Analyzer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return a.Read(f)
+}
+
+// loadPresets reads the presets from the JSON file that maps the preset names to the configs.
+func loadPresets(name string) (map[string]*imageflux.Config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]string
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	}
+	presets := make(map[string]*imageflux.Config, len(raw))
+	for preset, s := range raw {
+		cfg, rest, err := imageflux.ParseConfig(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid preset %q: %w", preset, err)
+		}
+		if rest != "" {
+			return nil, fmt.Errorf("invalid preset %q: unexpected %q", preset, rest)
+		}
+		presets[preset] = cfg
+	}
+	return presets, nil
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/go-imageflux"
+	"github.com/shogo82148/go-imageflux/audit"
+)
+
+type auditResult struct {
+	Findings []audit.Finding      `json:"findings"`
+	Summary  map[audit.Status]int `json:"summary"`
+}
+
+func runAudit(e *env, cmd command, args []string) int {
+	fs := e.newFlagSet(cmd)
+	var secret secretFlags
+	secret.register(fs)
+	hosts := fs.String("host", "", "the comma-separated hosts of ImageFlux, e.g. demo.imageflux.jp")
+	previous := fs.String("previous-secret-file", "", "the file that contains the previous signing secrets, one per line")
+	expiring := fs.Duration("expiring", 7*24*time.Hour, "report the URLs that expire within the duration")
+	exts := fs.String("ext", ".html,.htm,.json,.md,.markdown", "the comma-separated extensions of the files in directories")
+	all := fs.Bool("all", false, "report the valid URLs too")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *hosts == "" {
+		*hosts = e.getenv("IMAGEFLUX_HOST")
+	}
+	if *hosts == "" {
+		return e.fail(errors.New("the host is required; use -host or IMAGEFLUX_HOST"))
+	}
+	key, err := secret.load(e)
+	if err != nil {
+		return e.fail(err)
+	}
+	proxy := &imageflux.Proxy{
+		SecretBytes: key,
+	}
+	if *previous != "" {
+		data, err := os.ReadFile(*previous)
+		if err != nil {
+			return e.fail(err)
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			if line = strings.TrimRight(line, "\r"); line != "" {
+				proxy.PreviousSecrets = append(proxy.PreviousSecrets, []byte(line))
+			}
+		}
+	}
+	scanner := &audit.Scanner{
+		Proxy:          proxy,
+		Hosts:          strings.Split(*hosts, ","),
+		ExpiringWithin: *expiring,
+	}
+
+	var findings []audit.Finding
+	if fs.NArg() == 0 {
+		findings, err = scanner.Scan("-", e.stdin)
+	} else {
+		findings, err = auditFiles(scanner, fs.Args(), strings.Split(*exts, ","))
+	}
+	if err != nil {
+		return e.fail(err)
+	}
+
+	result := &auditResult{
+		Findings: []audit.Finding{},
+		Summary:  map[audit.Status]int{},
+	}
+	for _, f := range findings {
+		result.Summary[f.Status]++
+		if *all || f.Status != audit.StatusValid {
+			result.Findings = append(result.Findings, f)
+		}
+	}
+	if status := e.writeJSON(result); status != 0 {
+		return status
+	}
+	if len(findings) != result.Summary[audit.StatusValid] {
+		return 1
+	}
+	return 0
+}
+
+// auditFiles scans the files and the files in the directories with the extensions.
+func auditFiles(scanner *audit.Scanner, names []string, exts []string) ([]audit.Finding, error) {
+	var findings []audit.Finding
+	for _, name := range names {
+		err := filepath.WalkDir(name, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			// the files in the arguments are always scanned.
+			if path != name && !slices.Contains(exts, filepath.Ext(path)) {
+				return nil
+			}
+			f, err := scanner.ScanFile(path)
+			if err != nil {
+				return err
+			}
+			findings = append(findings, f...)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return findings, nil
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+type explainRequest struct {
+	// URL is the URL or the path of the image.
+	URL string `json:"url,omitempty"`
+
+	// Config is the config, e.g. "w=200,f=webp".
+	// It is used if URL is empty.
+	Config string `json:"config,omitempty"`
+}
+
+type explainResult struct {
+	URL    string `json:"url,omitempty"`
+	Config string `json:"config,omitempty"`
+	Steps  []step `json:"steps"`
+}
+
+type step struct {
+	Stage       string   `json:"stage"`
+	Description string   `json:"description"`
+	Params      []string `json:"params,omitempty"`
+	Steps       []step   `json:"steps,omitempty"`
+}
+
+func runExplain(e *env, cmd command, args []string) int {
+	fs := e.newFlagSet(cmd)
+	jsonMode := fs.Bool("json", false, "write the result in JSON")
+	batchMode := fs.Bool("batch", false, "read requests in JSON Lines from stdin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *batchMode {
+		return batch(e, func(req *explainRequest) (any, error) {
+			if req.URL != "" {
+				return explain(req.URL)
+			}
+			return explainConfig(req.Config)
+		})
+	}
+
+	arg, err := oneArg(fs)
+	if err != nil {
+		return e.fail(err)
+	}
+	var result *explainResult
+	if strings.Contains(arg, "://") || strings.HasPrefix(arg, "/") {
+		result, err = explain(arg)
+	} else {
+		result, err = explainConfig(arg)
+	}
+	if err != nil {
+		return e.fail(err)
+	}
+	if *jsonMode {
+		return e.writeJSON(result)
+	}
+	writeSteps(e.stdout, result.Steps, 0)
+	return 0
+}
+
+func explain(rawURL string) (*explainResult, error) {
+	proxy := &imageflux.Proxy{}
+	res, err := proxy.Verify(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return &explainResult{
+		URL:   rawURL,
+		Steps: convertSteps(res.Image.Config.Explain()),
+	}, nil
+}
+
+func explainConfig(config string) (*explainResult, error) {
+	if err := checkParams(config); err != nil {
+		return nil, err
+	}
+	cfg, rest, err := imageflux.ParseConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q in the config", rest)
+	}
+	return &explainResult{
+		Config: config,
+		Steps:  convertSteps(cfg.Explain()),
+	}, nil
+}
+
+func convertSteps(steps []imageflux.Step) []step {
+	if len(steps) == 0 {
+		return nil
+	}
+	ret := make([]step, 0, len(steps))
+	for _, s := range steps {
+		ret = append(ret, step{
+			Stage:       s.Stage,
+			Description: s.Description,
+			Params:      s.Params,
+			Steps:       convertSteps(s.Steps),
+		})
+	}
+	return ret
+}
+
+func writeSteps(w io.Writer, steps []step, depth int) {
+	indent := strings.Repeat("  ", depth)
+	for i, s := range steps {
+		fmt.Fprintf(w, "%s%d. %s: %s\n", indent, i+1, s.Stage, s.Description)
+		writeSteps(w, s.Steps, depth+1)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+type lintResult struct {
+	URL       string    `json:"url"`
+	Findings  []finding `json:"findings"`
+	Rewritten string    `json:"rewritten"`
+	Signed    bool      `json:"signed"`
+}
+
+type finding struct {
+	Field       string `json:"field"`
+	Replacement string `json:"replacement"`
+	Message     string `json:"message"`
+}
+
+func runLint(e *env, cmd command, args []string) int {
+	fs := e.newFlagSet(cmd)
+	var secret secretFlags
+	secret.register(fs)
+	fix := fs.Bool("fix", false, "write the rewritten URL instead of the findings")
+	jsonMode := fs.Bool("json", false, "write the result in JSON")
+	batchMode := fs.Bool("batch", false, "read requests in JSON Lines from stdin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	key, err := secret.load(e)
+	if err != nil {
+		return e.fail(err)
+	}
+	proxy := &imageflux.Proxy{
+		SecretBytes: key,
+	}
+
+	if *batchMode {
+		return batch(e, func(req *urlRequest) (any, error) {
+			return lint(proxy, req.URL)
+		})
+	}
+
+	rawURL, err := oneArg(fs)
+	if err != nil {
+		return e.fail(err)
+	}
+	result, err := lint(proxy, rawURL)
+	if err != nil {
+		return e.fail(err)
+	}
+	switch {
+	case *jsonMode:
+		if status := e.writeJSON(result); status != 0 {
+			return status
+		}
+	case *fix:
+		for _, f := range result.Findings {
+			fmt.Fprintf(e.stderr, "%s: %s\n", f.Field, f.Message)
+		}
+		if len(result.Findings) > 0 && !result.Signed {
+			fmt.Fprintln(e.stderr, "imageflux: the rewritten URL is not signed; set the signing secret to re-sign it")
+		}
+		fmt.Fprintln(e.stdout, result.Rewritten)
+		return 0
+	default:
+		for _, f := range result.Findings {
+			fmt.Fprintf(e.stdout, "%s: %s\n", f.Field, f.Message)
+		}
+	}
+	if len(result.Findings) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func lint(proxy *imageflux.Proxy, rawURL string) (*lintResult, error) {
+	res, err := proxy.LintURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	findings := make([]finding, 0, len(res.Findings))
+	for _, f := range res.Findings {
+		findings = append(findings, finding{
+			Field:       f.Field,
+			Replacement: f.Replacement,
+			Message:     f.Message,
+		})
+	}
+	return &lintResult{
+		URL:       rawURL,
+		Findings:  findings,
+		Rewritten: res.URL,
+		Signed:    res.Signed,
+	}, nil
+}
@@ -0,0 +1,202 @@
+// Command imageflux signs, parses, verifies, explains, lints and audits ImageFlux URLs,
+// and analyzes access logs.
+//
+// Usage:
+//
+//	imageflux sign [flags] path
+//	imageflux parse [flags] url
+//	imageflux verify [flags] url
+//	imageflux explain [flags] url-or-config
+//	imageflux lint [flags] url
+//	imageflux audit [flags] [file-or-directory...]
+//	imageflux analyze [flags] [access-log...]
+//
+// The signing secret is read from the environment variable IMAGEFLUX_SECRET,
+// or from the file specified by the -secret-file flag.
+//
+// With the -batch flag, the subcommands read requests in JSON Lines from stdin,
+// and write the results in JSON Lines to stdout.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	e := &env{
+		stdin:  os.Stdin,
+		stdout: os.Stdout,
+		stderr: os.Stderr,
+		getenv: os.Getenv,
+	}
+	os.Exit(e.run(os.Args[1:]))
+}
+
+// env is the environment of the command.
+type env struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	getenv func(string) string
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(e *env, cmd command, args []string) int
+}
+
+var commands = []command{
+	{"sign", "sign [flags] path", runSign},
+	{"parse", "parse [flags] url", runParse},
+	{"verify", "verify [flags] url", runVerify},
+	{"explain", "explain [flags] url-or-config", runExplain},
+	{"lint", "lint [flags] url", runLint},
+	{"audit", "audit [flags] [file-or-directory...]", runAudit},
+	{"analyze", "analyze [flags] [access-log...]", runAnalyze},
+}
+
+func (e *env) run(args []string) int {
+	if len(args) == 0 {
+		e.usage()
+		return 2
+	}
+	for _, cmd := range commands {
+		if cmd.name == args[0] {
+			return cmd.run(e, cmd, args[1:])
+		}
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		e.usage()
+		return 0
+	}
+	fmt.Fprintf(e.stderr, "imageflux: unknown command %q\n", args[0])
+	e.usage()
+	return 2
+}
+
+func (e *env) usage() {
+	fmt.Fprintln(e.stderr, "Usage:")
+	for _, cmd := range commands {
+		fmt.Fprintf(e.stderr, "\timageflux %s\n", cmd.usage)
+	}
+	fmt.Fprintln(e.stderr, "\nRun 'imageflux <command> -h' for the flags of the command.")
+}
+
+// newFlagSet returns a new flag set for the command.
+func (e *env) newFlagSet(cmd command) *flag.FlagSet {
+	fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(e.stderr, "Usage: imageflux %s\n", cmd.usage)
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// secretFlags are the flags to read the signing secret.
+type secretFlags struct {
+	env  string
+	file string
+}
+
+func (f *secretFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.env, "secret-env", "IMAGEFLUX_SECRET", "the environment variable that contains the signing secret")
+	fs.StringVar(&f.file, "secret-file", "", "the file that contains the signing secret")
+}
+
+// load returns the signing secret.
+// It returns nil if no secret is configured.
+func (f *secretFlags) load(e *env) ([]byte, error) {
+	if f.file != "" {
+		data, err := os.ReadFile(f.file)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(strings.TrimRight(string(data), "\r\n")), nil
+	}
+	if f.env != "" {
+		if secret := e.getenv(f.env); secret != "" {
+			return []byte(secret), nil
+		}
+	}
+	return nil, nil
+}
+
+// batch reads the requests in JSON Lines from stdin, handles them,
+// and writes the results in JSON Lines to stdout.
+// A request that fails produces {"error": "..."}.
+func batch[T any](e *env, handle func(req *T) (any, error)) int {
+	status := 0
+	enc := json.NewEncoder(e.stdout)
+	enc.SetEscapeHTML(false)
+	scanner := bufio.NewScanner(e.stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(strings.TrimSpace(string(line))) == 0 {
+			continue
+		}
+
+		var result any
+		var req T
+		err := json.Unmarshal(line, &req)
+		if err == nil {
+			result, err = handle(&req)
+		}
+		if err != nil {
+			status = 1
+			result = errorResult{Error: err.Error()}
+		}
+		if err := enc.Encode(result); err != nil {
+			fmt.Fprintf(e.stderr, "imageflux: %v\n", err)
+			return 1
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(e.stderr, "imageflux: %v\n", err)
+		return 1
+	}
+	return status
+}
+
+type errorResult struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes v as indented JSON to stdout.
+func (e *env) writeJSON(v any) int {
+	enc := json.NewEncoder(e.stdout)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return e.fail(err)
+	}
+	return 0
+}
+
+// fail reports err and returns the exit status.
+func (e *env) fail(err error) int {
+	msg := err.Error()
+	if !strings.HasPrefix(msg, "imageflux: ") {
+		msg = "imageflux: " + msg
+	}
+	fmt.Fprintln(e.stderr, msg)
+	return 1
+}
+
+// oneArg returns the only positional argument.
+func oneArg(fs *flag.FlagSet) (string, error) {
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return "", errors.New("exactly one argument is required")
+	}
+	return fs.Arg(0), nil
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func runCommand(t *testing.T, stdin string, args ...string) (stdout, stderr string, status int) {
+	t.Helper()
+	var out, errOut bytes.Buffer
+	e := &env{
+		stdin:  strings.NewReader(stdin),
+		stdout: &out,
+		stderr: &errOut,
+		getenv: func(key string) string {
+			if key == "IMAGEFLUX_SECRET" {
+				return "testsigningsecret"
+			}
+			return ""
+		},
+	}
+	status = e.run(args)
+	return out.String(), errOut.String(), status
+}
+
+func TestRun(t *testing.T) {
+	cases := []struct {
+		name   string
+		stdin  string
+		args   []string
+		stdout string
+		status int
+	}{
+		{
+			name:   "sign",
+			args:   []string{"sign", "-host", "demo.imageflux.jp", "-config", "w=200", "/images/1.jpg"},
+			stdout: "https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg\n",
+		},
+		{
+			name:  "sign batch",
+			stdin: `{"path":"/images/1.jpg","preset":{"w":200}}` + "\n" + `{"path":""}` + "\n",
+			args:  []string{"sign", "-host", "demo.imageflux.jp", "-batch"},
+			stdout: `{"url":"https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg"}` + "\n" +
+				`{"error":"the path is required"}` + "\n",
+			status: 1,
+		},
+		{
+			name:   "sign misspelled key",
+			args:   []string{"sign", "-host", "demo.imageflux.jp", "-config", "wdth=200", "/images/1.jpg"},
+			status: 1,
+		},
+		{
+			name:   "sign misspelled key in overlay",
+			args:   []string{"sign", "-host", "demo.imageflux.jp", "-config", "w=200,l=(wdth=100/logo.png)", "/images/1.jpg"},
+			status: 1,
+		},
+		{
+			name:   "sign without host",
+			args:   []string{"sign", "/images/1.jpg"},
+			status: 1,
+		},
+		{
+			name:  "parse batch",
+			stdin: `{"url":"https://demo.imageflux.jp/c/w=200/images/1.jpg"}` + "\n",
+			args:  []string{"parse", "-batch"},
+			stdout: `{"url":"https://demo.imageflux.jp/c/w=200/images/1.jpg","host":"demo.imageflux.jp",` +
+				`"path":"/images/1.jpg","params":"w=200","config":{"w":"200"}}` + "\n",
+		},
+		{
+			name:  "parse overlays",
+			stdin: `{"url":"https://demo.imageflux.jp/c/w=200,l=(w=100/logo.png),f=webp/images/1.jpg"}` + "\n",
+			args:  []string{"parse", "-batch"},
+			stdout: `{"url":"https://demo.imageflux.jp/c/w=200,l=(w=100/logo.png),f=webp/images/1.jpg","host":"demo.imageflux.jp",` +
+				`"path":"/images/1.jpg","params":"w=200%2Cl=(w=100%2Flogo.png)%2Cf=webp",` +
+				`"config":{"f":"webp","l":["(w=100%2Flogo.png)"],"w":"200"}}` + "\n",
+		},
+		{
+			name:  "verify batch",
+			stdin: `{"url":"https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg"}` + "\n",
+			args:  []string{"verify", "-batch"},
+			stdout: `{"url":"https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg",` +
+				`"signed":true,"valid":true,"signature_version":"1","key_index":0,"expired":false}` + "\n",
+		},
+		{
+			name:  "verify batch invalid signature",
+			stdin: `{"url":"https://demo.imageflux.jp/c/sig=1.invalid,w=200/images/1.jpg"}` + "\n",
+			args:  []string{"verify", "-batch"},
+			stdout: `{"url":"https://demo.imageflux.jp/c/sig=1.invalid,w=200/images/1.jpg",` +
+				`"signed":true,"valid":false,"signature_version":"1","key_index":-1,"expired":false}` + "\n",
+			status: 1,
+		},
+		{
+			name:   "verify invalid signature",
+			args:   []string{"verify", "https://demo.imageflux.jp/c/sig=1.invalid,w=200/images/1.jpg"},
+			stdout: "",
+			status: 1,
+		},
+		{
+			name:   "explain",
+			args:   []string{"explain", "w=200,f=webp"},
+			stdout: "1. resize: width 200 px\n2. output: format webp\n",
+		},
+		{
+			name:   "explain misspelled key",
+			args:   []string{"explain", "wdth=200"},
+			status: 1,
+		},
+		{
+			name:   "lint",
+			args:   []string{"lint", "https://demo.imageflux.jp/c/sig=1.dBVE0NdhS2qtYPcH2JlxOwTZAandvEzpm1faXUbv4xQ=,c=0:0:100:100,f=webp:jpeg/images/1.jpg"},
+			stdout: "c: deprecated key \"c\" is used, use \"oc\" instead\nf: deprecated format \"webp:jpeg\" is used, use \"webp:jpg\" instead\n",
+			status: 1,
+		},
+		{
+			name:   "lint fix",
+			args:   []string{"lint", "-fix", "https://demo.imageflux.jp/c/sig=1.nNiXQRFg_wyn6qKIZjCyVa9GxXf9kgDWNzlzJKlf3Qs=,c=0:0:100:100,w=200/images/1.jpg"},
+			stdout: "https://demo.imageflux.jp/c/sig=1.gBaZdtFvK18j7SR_5GUt5G7kqKYylb195bken130Ass=%2Cw=200%2Coc=0:0:100:100/images/1.jpg\n",
+		},
+		{
+			name:   "lint batch",
+			stdin:  `{"url":"https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg"}` + "\n",
+			args:   []string{"lint", "-batch"},
+			stdout: `{"url":"https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg","findings":[],"rewritten":"https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg","signed":true}` + "\n",
+		},
+		{
+			name:   "lint fix unsigned",
+			args:   []string{"lint", "-fix", "https://demo.imageflux.jp/c/c=0:0:100:100,w=200/images/1.jpg"},
+			status: 1,
+		},
+		{
+			name:  "audit",
+			stdin: "![image](https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg)\n",
+			args:  []string{"audit", "-host", "demo.imageflux.jp"},
+			stdout: "{\n" +
+				"  \"findings\": [],\n" +
+				"  \"summary\": {\n" +
+				"    \"valid\": 1\n" +
+				"  }\n" +
+				"}\n",
+		},
+		{
+			name:   "audit invalid signature",
+			stdin:  "<img src=\"https://demo.imageflux.jp/c/sig=1.invalid,w=200/images/1.jpg\">\n",
+			args:   []string{"audit", "-host", "demo.imageflux.jp"},
+			status: 1,
+		},
+		{
+			name:   "audit without host",
+			args:   []string{"audit"},
+			status: 1,
+		},
+		{
+			name: "analyze",
+			stdin: "127.0.0.1 - - [10/Oct/2026:13:55:36 +0900] \"GET /c/w=200/images/1.jpg HTTP/1.1\" 200 1000 \"-\" \"-\"\n" +
+				"{\"path\":\"/c/w=199/images/2.jpg\",\"status\":200,\"bytes\":500}\n",
+			args: []string{"analyze", "-format", "csv", "-table", "near_duplicates"},
+			stdout: "configs,requests,bytes\n" +
+				"w=199 w=200,2,1500\n",
+		},
+		{
+			name:   "analyze unknown table",
+			args:   []string{"analyze", "-format", "csv", "-table", "unknown"},
+			status: 1,
+		},
+		{
+			name:   "unknown command",
+			args:   []string{"unknown"},
+			status: 2,
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			stdout, stderr, status := runCommand(t, tt.stdin, tt.args...)
+			if status != tt.status {
+				t.Errorf("unexpected status: want %d, got %d\nstderr: %s", tt.status, status, stderr)
+			}
+			if tt.stdout == "" && status != 0 {
+				// the output is not interesting on failures.
+				return
+			}
+			if diff := cmp.Diff(tt.stdout, stdout); diff != "" {
+				t.Errorf("stdout mismatch (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestParsePreset(t *testing.T) {
+	got, err := parsePreset(map[string]any{
+		"w":        200.0,
+		"f":        "webp:auto",
+		"lossless": true,
+		"l":        []any{"(w=100/a.png)", "(w=50/b.png)"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"f=webp:auto", "l=(w=100/a.png)", "l=(w=50/b.png)", "lossless=1", "w=200"}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("parsePreset() mismatch (-want +got):\n%s", diff)
+	}
+
+	if _, err := parsePreset(map[string]any{"w": nil}); err == nil {
+		t.Error("want error, got nil")
+	}
+}
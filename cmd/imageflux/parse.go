@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/url"
+	"slices"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+type urlRequest struct {
+	URL string `json:"url"`
+}
+
+type parseResult struct {
+	URL    string `json:"url"`
+	Host   string `json:"host,omitempty"`
+	Path   string `json:"path"`
+	Params string `json:"params"`
+
+	// Config maps the keys of the parameters to the values in the URL form,
+	// in the same format as the preset of the sign command.
+	Config map[string]any `json:"config"`
+
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// repeatedParams are the keys of the parameters that may appear more than once.
+// Their values are always arrays in parseResult.Config.
+var repeatedParams = []string{"l", "t"}
+
+func runParse(e *env, cmd command, args []string) int {
+	fs := e.newFlagSet(cmd)
+	batchMode := fs.Bool("batch", false, "read requests in JSON Lines from stdin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *batchMode {
+		return batch(e, func(req *urlRequest) (any, error) {
+			return parse(req.URL)
+		})
+	}
+
+	rawURL, err := oneArg(fs)
+	if err != nil {
+		return e.fail(err)
+	}
+	result, err := parse(rawURL)
+	if err != nil {
+		return e.fail(err)
+	}
+	return e.writeJSON(result)
+}
+
+func parse(rawURL string) (*parseResult, error) {
+	// Verify doesn't fail on invalid signatures or expired URLs.
+	proxy := &imageflux.Proxy{}
+	res, err := proxy.Verify(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	params := res.Image.Config.String()
+	config, err := configParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return &parseResult{
+		URL:      rawURL,
+		Host:     u.Host,
+		Path:     res.Image.Path,
+		Params:   params,
+		Config:   config,
+		Warnings: res.Warnings,
+	}, nil
+}
+
+// configParams converts the parameters into the config of parseResult.
+func configParams(params string) (map[string]any, error) {
+	config := map[string]any{}
+	t := imageflux.NewTokenizer(params)
+	for t.Next() {
+		tok := t.Token()
+		if !slices.Contains(repeatedParams, tok.Key) {
+			config[tok.Key] = tok.RawValue
+			continue
+		}
+		values, _ := config[tok.Key].([]string)
+		config[tok.Key] = append(values, tok.RawValue)
+	}
+	if err := t.Err(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
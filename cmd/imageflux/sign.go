@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+type signRequest struct {
+	// Path is the path of the image.
+	Path string `json:"path"`
+
+	// Config is the inline config, e.g. "w=200,f=webp".
+	Config string `json:"config,omitempty"`
+
+	// Preset is the preset of the config. See parsePreset.
+	Preset map[string]any `json:"preset,omitempty"`
+
+	// Expires is the duration until the URL expires, e.g. "1h".
+	Expires string `json:"expires,omitempty"`
+}
+
+type signResult struct {
+	URL string `json:"url"`
+}
+
+func runSign(e *env, cmd command, args []string) int {
+	fs := e.newFlagSet(cmd)
+	var secret secretFlags
+	secret.register(fs)
+	host := fs.String("host", "", "the host of ImageFlux, e.g. demo.imageflux.jp")
+	scheme := fs.String("scheme", "", "the scheme of the URL (default https)")
+	config := fs.String("config", "", `the inline config, e.g. "w=200,f=webp"`)
+	presetFile := fs.String("preset", "", "the JSON file of the config preset")
+	expires := fs.Duration("expires", 0, "the duration until the URL expires")
+	batchMode := fs.Bool("batch", false, "read requests in JSON Lines from stdin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *host == "" {
+		*host = e.getenv("IMAGEFLUX_HOST")
+	}
+	if *host == "" {
+		return e.fail(errors.New("the host is required; use -host or IMAGEFLUX_HOST"))
+	}
+
+	key, err := secret.load(e)
+	if err != nil {
+		return e.fail(err)
+	}
+	proxy := &imageflux.Proxy{
+		Host:        *host,
+		Scheme:      *scheme,
+		SecretBytes: key,
+	}
+
+	var preset map[string]any
+	if *presetFile != "" {
+		data, err := os.ReadFile(*presetFile)
+		if err != nil {
+			return e.fail(err)
+		}
+		if err := json.Unmarshal(data, &preset); err != nil {
+			return e.fail(fmt.Errorf("invalid preset %s: %w", *presetFile, err))
+		}
+	}
+
+	if *batchMode {
+		return batch(e, func(req *signRequest) (any, error) {
+			if req.Preset == nil {
+				req.Preset = preset
+			}
+			if req.Config == "" {
+				req.Config = *config
+			}
+			d := *expires
+			if req.Expires != "" {
+				var err error
+				d, err = time.ParseDuration(req.Expires)
+				if err != nil {
+					return nil, fmt.Errorf("invalid expires %q: %w", req.Expires, err)
+				}
+			}
+			return sign(proxy, req.Path, req.Config, req.Preset, d)
+		})
+	}
+
+	path, err := oneArg(fs)
+	if err != nil {
+		return e.fail(err)
+	}
+	result, err := sign(proxy, path, *config, preset, *expires)
+	if err != nil {
+		return e.fail(err)
+	}
+	fmt.Fprintln(e.stdout, result.URL)
+	return 0
+}
+
+func sign(proxy *imageflux.Proxy, path, config string, preset map[string]any, expires time.Duration) (*signResult, error) {
+	if path == "" {
+		return nil, errors.New("the path is required")
+	}
+	params, err := parsePreset(preset)
+	if err != nil {
+		return nil, err
+	}
+	if config != "" {
+		params = append(params, config)
+	}
+	joined := strings.Join(params, ",")
+	if err := checkParams(joined); err != nil {
+		return nil, err
+	}
+	cfg, rest, err := imageflux.ParseConfig(joined)
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q in the config", rest)
+	}
+
+	img := proxy.Image(path, cfg)
+	if expires > 0 {
+		img.Expires = time.Now().Add(expires).Truncate(time.Second)
+	}
+	return &signResult{URL: img.SignedURL()}, nil
+}
+
+// checkParams returns an error if params has unknown keys.
+// ParseConfig ignores the unknown keys of configs and overlays,
+// so a typo would silently produce a URL of a different image.
+// The keys of texts are checked by ParseConfig.
+func checkParams(params string) error {
+	t := imageflux.NewTokenizer(params)
+	for t.Next() {
+		tok := t.Token()
+		if _, ok := imageflux.LookupParam(tok.Key, imageflux.TargetConfig); !ok {
+			return fmt.Errorf("unknown parameter %q", tok.Key)
+		}
+		if tok.Key != "l" {
+			continue
+		}
+		inner := strings.TrimSuffix(strings.TrimPrefix(tok.RawValue, "("), ")")
+		inner, err := url.PathUnescape(inner)
+		if err != nil {
+			return fmt.Errorf("invalid overlay %q: %w", tok.RawValue, err)
+		}
+		o := imageflux.NewTokenizer(inner)
+		for o.Next() {
+			if _, ok := imageflux.LookupParam(o.Token().Key, imageflux.TargetOverlay); !ok {
+				return fmt.Errorf("unknown parameter %q in the overlay", o.Token().Key)
+			}
+		}
+		if err := o.Err(); err != nil {
+			return err
+		}
+	}
+	return t.Err()
+}
+
+// parsePreset converts the preset into the parameters.
+// The preset is a JSON object that maps the keys of ImageFlux parameters to the values,
+// e.g. {"w": 200, "f": "webp:auto"}.
+// The values are strings in the URL form, numbers or booleans.
+// Arrays are used for repeated parameters such as "l" and "t".
+func parsePreset(preset map[string]any) ([]string, error) {
+	keys := make([]string, 0, len(preset))
+	for key := range preset {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var params []string
+	for _, key := range keys {
+		values, ok := preset[key].([]any)
+		if !ok {
+			values = []any{preset[key]}
+		}
+		for _, v := range values {
+			var value string
+			switch v := v.(type) {
+			case string:
+				value = v
+			case float64:
+				value = strconv.FormatFloat(v, 'f', -1, 64)
+			case bool:
+				value = "0"
+				if v {
+					value = "1"
+				}
+			default:
+				return nil, fmt.Errorf("invalid preset value of %q: %v", key, v)
+			}
+			params = append(params, key+"="+value)
+		}
+	}
+	return params, nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+type verifyResult struct {
+	URL              string     `json:"url"`
+	Signed           bool       `json:"signed"`
+	Valid            bool       `json:"valid"`
+	SignatureVersion string     `json:"signature_version,omitempty"`
+	KeyIndex         int        `json:"key_index"`
+	Expires          *time.Time `json:"expires,omitempty"`
+	Expired          bool       `json:"expired"`
+	Warnings         []string   `json:"warnings,omitempty"`
+}
+
+// ok reports whether the URL is signed with a valid signature and not expired.
+func (r *verifyResult) ok() bool {
+	return r.Valid && !r.Expired
+}
+
+func runVerify(e *env, cmd command, args []string) int {
+	fs := e.newFlagSet(cmd)
+	var secret secretFlags
+	secret.register(fs)
+	batchMode := fs.Bool("batch", false, "read requests in JSON Lines from stdin")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	key, err := secret.load(e)
+	if err != nil {
+		return e.fail(err)
+	}
+	if len(key) == 0 {
+		return e.fail(fmt.Errorf("the signing secret is required; use $%s or -secret-file", secret.env))
+	}
+	proxy := &imageflux.Proxy{
+		SecretBytes: key,
+	}
+
+	if *batchMode {
+		// like the single mode, exit with 1 if any URL fails the verification.
+		var failed bool
+		status := batch(e, func(req *urlRequest) (any, error) {
+			result, err := verify(proxy, req.URL)
+			if err == nil && !result.ok() {
+				failed = true
+			}
+			return result, err
+		})
+		if failed && status == 0 {
+			return 1
+		}
+		return status
+	}
+
+	rawURL, err := oneArg(fs)
+	if err != nil {
+		return e.fail(err)
+	}
+	result, err := verify(proxy, rawURL)
+	if err != nil {
+		return e.fail(err)
+	}
+	if status := e.writeJSON(result); status != 0 {
+		return status
+	}
+	if !result.ok() {
+		return 1
+	}
+	return 0
+}
+
+func verify(proxy *imageflux.Proxy, rawURL string) (*verifyResult, error) {
+	res, err := proxy.Verify(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	result := &verifyResult{
+		URL:              rawURL,
+		Signed:           res.Signed,
+		Valid:            res.Valid,
+		SignatureVersion: res.SignatureVersion,
+		KeyIndex:         res.KeyIndex,
+		Expired:          res.Expired,
+		Warnings:         res.Warnings,
+	}
+	if !res.Expires.IsZero() {
+		result.Expires = &res.Expires
+	}
+	return result, nil
+}
@@ -0,0 +1,245 @@
+package imageflux
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+// DefaultMaxURLLength is the default limit of the length of collage URLs.
+// Some CDNs and browsers reject URLs longer than about 2KB.
+const DefaultMaxURLLength = 2048
+
+// CollageLayout is the layout of a collage.
+type CollageLayout int
+
+const (
+	// CollageLayoutGrid arranges the items in a grid of the same cells.
+	// The items are cropped to fill the cells.
+	CollageLayoutGrid CollageLayout = iota
+
+	// CollageLayoutMasonry arranges the items in columns of the same width,
+	// keeping the aspect ratios of the items.
+	// Each item is placed in the shortest column.
+	CollageLayoutMasonry
+)
+
+// CollageItem is an item of a collage.
+type CollageItem struct {
+	// Path is the path of the image.
+	Path string
+
+	// Width and Height are the size of the image in pixel.
+	// They are used only for the aspect ratio in the masonry layout.
+	Width, Height int
+}
+
+// Collage is the layout of a collage, e.g. a contact sheet of product thumbnails.
+// The items are composed on the base image as overlays.
+type Collage struct {
+	// Base is the path of the base image, e.g. a blank image.
+	// It is scaled to fit in the canvas, and the rest of the canvas is filled with Background.
+	// The canvas is always Width x Height, whether Background is set or not.
+	Base string
+
+	// Width and Height are the size of the canvas in pixel.
+	Width, Height int
+
+	// Items are the images arranged in the collage.
+	Items []CollageItem
+
+	// Layout is the layout of the items.
+	Layout CollageLayout
+
+	// Columns and Rows are the number of the columns and the rows.
+	// If both of them are zero, they are chosen to make the grid close to square.
+	// If one of them is zero, it is chosen to contain all the items.
+	// Rows are ignored in the masonry layout.
+	Columns, Rows int
+
+	// Gutter is the space between the items and around them in pixel.
+	Gutter int
+
+	// Background is the background color of the canvas.
+	// If it is nil, the default background of ImageFlux is used.
+	Background color.Color
+
+	// MaxURLLength is the limit of the length of the URL.
+	// If it is zero, DefaultMaxURLLength is used.
+	// Longer URLs are not an error, but they are reported as warnings.
+	MaxURLLength int
+}
+
+// CollageResult is the result of Collage.Build.
+type CollageResult struct {
+	// Image is the image of the collage.
+	Image *Image
+
+	// URL is the signed URL of Image.
+	URL string
+
+	// Warnings are non-fatal problems of the collage, e.g. the URL is too long.
+	Warnings []string
+}
+
+// Config returns the config that composes the collage on the base image.
+func (c *Collage) Config() (*Config, error) {
+	if c.Width <= 0 || c.Height <= 0 {
+		return nil, fmt.Errorf("imageflux: the size of the collage must be positive, but got %dx%d", c.Width, c.Height)
+	}
+	if len(c.Items) == 0 {
+		return nil, errors.New("imageflux: the collage has no items")
+	}
+	if c.Gutter < 0 {
+		return nil, fmt.Errorf("imageflux: the gutter of the collage must not be negative, but got %d", c.Gutter)
+	}
+	if c.Columns < 0 || c.Rows < 0 {
+		return nil, fmt.Errorf("imageflux: the number of the columns and the rows must not be negative, but got %d and %d", c.Columns, c.Rows)
+	}
+
+	var overlays []*Overlay
+	var err error
+	switch c.Layout {
+	case CollageLayoutGrid:
+		overlays, err = c.grid()
+	case CollageLayoutMasonry:
+		overlays, err = c.masonry()
+	default:
+		err = fmt.Errorf("imageflux: unknown collage layout: %d", c.Layout)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// pad the base image so that the canvas is always Width x Height,
+	// and the overlays are placed at the offsets from the top-left corner of the canvas.
+	cfg := &Config{
+		Width:      c.Width,
+		Height:     c.Height,
+		AspectMode: AspectModePad,
+		Background: c.Background,
+		Overlays:   overlays,
+	}
+	return cfg, nil
+}
+
+// gridSize returns the number of the columns and the rows.
+func (c *Collage) gridSize() (cols, rows int) {
+	n := len(c.Items)
+	cols, rows = c.Columns, c.Rows
+	switch {
+	case cols == 0 && rows == 0:
+		cols = int(math.Ceil(math.Sqrt(float64(n))))
+		rows = (n + cols - 1) / cols
+	case cols == 0:
+		cols = (n + rows - 1) / rows
+	case rows == 0:
+		rows = (n + cols - 1) / cols
+	}
+	return cols, rows
+}
+
+// cellSize returns the size of a cell for n cells along the length in pixel.
+func (c *Collage) cellSize(length, n int) int {
+	return (length - c.Gutter*(n+1)) / n
+}
+
+func (c *Collage) grid() ([]*Overlay, error) {
+	cols, rows := c.gridSize()
+	if cols*rows < len(c.Items) {
+		return nil, fmt.Errorf("imageflux: %d items don't fit in %dx%d cells", len(c.Items), cols, rows)
+	}
+	w, h := c.cellSize(c.Width, cols), c.cellSize(c.Height, rows)
+	if w <= 0 || h <= 0 {
+		return nil, errors.New("imageflux: the gutter of the collage is too large")
+	}
+
+	overlays := make([]*Overlay, 0, len(c.Items))
+	for i, item := range c.Items {
+		col, row := i%cols, i/cols
+		overlays = append(overlays, &Overlay{
+			Path:          item.Path,
+			Width:         w,
+			Height:        h,
+			AspectMode:    AspectModeCrop,
+			Offset:        image.Pt(c.Gutter+col*(w+c.Gutter), c.Gutter+row*(h+c.Gutter)),
+			OverlayOrigin: OriginTopLeft,
+		})
+	}
+	return overlays, nil
+}
+
+func (c *Collage) masonry() ([]*Overlay, error) {
+	cols := c.Columns
+	if cols == 0 {
+		cols = int(math.Ceil(math.Sqrt(float64(len(c.Items)))))
+	}
+	w := c.cellSize(c.Width, cols)
+	if w <= 0 {
+		return nil, errors.New("imageflux: the gutter of the collage is too large")
+	}
+
+	// bottoms are the y coordinates of the bottoms of the columns.
+	bottoms := make([]int, cols)
+	for i := range bottoms {
+		bottoms[i] = c.Gutter
+	}
+	overlays := make([]*Overlay, 0, len(c.Items))
+	for _, item := range c.Items {
+		if item.Width <= 0 || item.Height <= 0 {
+			return nil, fmt.Errorf("imageflux: the size of %q is required in the masonry layout", item.Path)
+		}
+		col := 0
+		for i, bottom := range bottoms {
+			if bottom < bottoms[col] {
+				col = i
+			}
+		}
+		h := max(int(math.Round(float64(w)*float64(item.Height)/float64(item.Width))), 1)
+		overlays = append(overlays, &Overlay{
+			Path:          item.Path,
+			Width:         w,
+			Height:        h,
+			AspectMode:    AspectModeForceScale,
+			Offset:        image.Pt(c.Gutter+col*(w+c.Gutter), bottoms[col]),
+			OverlayOrigin: OriginTopLeft,
+		})
+		bottoms[col] += h + c.Gutter
+	}
+	return overlays, nil
+}
+
+// Build returns the image of the collage served by p.
+// The URL of the image is signed if p has a signing secret.
+func (c *Collage) Build(p *Proxy) (*CollageResult, error) {
+	if c.Base == "" {
+		return nil, errors.New("imageflux: the base image of the collage is required")
+	}
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	img := p.Image(c.Base, cfg)
+	ret := &CollageResult{
+		Image: img,
+		URL:   img.SignedURL(),
+	}
+
+	limit := c.MaxURLLength
+	if limit == 0 {
+		limit = DefaultMaxURLLength
+	}
+	if len(ret.URL) > limit {
+		ret.Warnings = append(ret.Warnings, fmt.Sprintf("the URL is %d bytes, longer than the limit %d bytes", len(ret.URL), limit))
+	}
+	if c.Layout == CollageLayoutMasonry {
+		for i, o := range cfg.Overlays {
+			if o.Offset.Y+o.Height > c.Height {
+				ret.Warnings = append(ret.Warnings, fmt.Sprintf("item %d (%s) overflows the bottom of the canvas", i, o.Path))
+			}
+		}
+	}
+	return ret, nil
+}
@@ -0,0 +1,272 @@
+package imageflux
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestCollage_Config(t *testing.T) {
+	tests := []struct {
+		collage *Collage
+		want    *Config
+	}{
+		{
+			collage: &Collage{
+				Width:  1000,
+				Height: 500,
+				Items: []CollageItem{
+					{Path: "/1.jpg"},
+					{Path: "/2.jpg"},
+					{Path: "/3.jpg"},
+				},
+				Gutter:     10,
+				Background: color.White,
+			},
+			want: &Config{
+				Width:      1000,
+				Height:     500,
+				AspectMode: AspectModePad,
+				Background: color.White,
+				Overlays: []*Overlay{
+					{
+						Path:          "/1.jpg",
+						Width:         485,
+						Height:        235,
+						AspectMode:    AspectModeCrop,
+						Offset:        image.Pt(10, 10),
+						OverlayOrigin: OriginTopLeft,
+					},
+					{
+						Path:          "/2.jpg",
+						Width:         485,
+						Height:        235,
+						AspectMode:    AspectModeCrop,
+						Offset:        image.Pt(505, 10),
+						OverlayOrigin: OriginTopLeft,
+					},
+					{
+						Path:          "/3.jpg",
+						Width:         485,
+						Height:        235,
+						AspectMode:    AspectModeCrop,
+						Offset:        image.Pt(10, 255),
+						OverlayOrigin: OriginTopLeft,
+					},
+				},
+			},
+		},
+		{
+			collage: &Collage{
+				Width:  900,
+				Height: 300,
+				Items: []CollageItem{
+					{Path: "/1.jpg"},
+					{Path: "/2.jpg"},
+					{Path: "/3.jpg"},
+				},
+				Rows: 1,
+			},
+			// the canvas is padded to the size without the background.
+			want: &Config{
+				Width:      900,
+				Height:     300,
+				AspectMode: AspectModePad,
+				Overlays: []*Overlay{
+					{
+						Path:          "/1.jpg",
+						Width:         300,
+						Height:        300,
+						AspectMode:    AspectModeCrop,
+						Offset:        image.Pt(0, 0),
+						OverlayOrigin: OriginTopLeft,
+					},
+					{
+						Path:          "/2.jpg",
+						Width:         300,
+						Height:        300,
+						AspectMode:    AspectModeCrop,
+						Offset:        image.Pt(300, 0),
+						OverlayOrigin: OriginTopLeft,
+					},
+					{
+						Path:          "/3.jpg",
+						Width:         300,
+						Height:        300,
+						AspectMode:    AspectModeCrop,
+						Offset:        image.Pt(600, 0),
+						OverlayOrigin: OriginTopLeft,
+					},
+				},
+			},
+		},
+		{
+			collage: &Collage{
+				Width:  630,
+				Height: 1000,
+				Items: []CollageItem{
+					{Path: "/1.jpg", Width: 400, Height: 600},
+					{Path: "/2.jpg", Width: 400, Height: 200},
+					{Path: "/3.jpg", Width: 400, Height: 400},
+				},
+				Layout:  CollageLayoutMasonry,
+				Columns: 2,
+				Gutter:  10,
+			},
+			want: &Config{
+				Width:      630,
+				Height:     1000,
+				AspectMode: AspectModePad,
+				Overlays: []*Overlay{
+					{
+						Path:          "/1.jpg",
+						Width:         300,
+						Height:        450,
+						AspectMode:    AspectModeForceScale,
+						Offset:        image.Pt(10, 10),
+						OverlayOrigin: OriginTopLeft,
+					},
+					{
+						Path:          "/2.jpg",
+						Width:         300,
+						Height:        150,
+						AspectMode:    AspectModeForceScale,
+						Offset:        image.Pt(320, 10),
+						OverlayOrigin: OriginTopLeft,
+					},
+					{
+						Path:          "/3.jpg",
+						Width:         300,
+						Height:        300,
+						AspectMode:    AspectModeForceScale,
+						Offset:        image.Pt(320, 170),
+						OverlayOrigin: OriginTopLeft,
+					},
+				},
+			},
+		},
+	}
+	for i, tt := range tests {
+		got, err := tt.collage.Config()
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%d: Config() mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestCollage_Config_error(t *testing.T) {
+	items := []CollageItem{{Path: "/1.jpg"}, {Path: "/2.jpg"}, {Path: "/3.jpg"}}
+	tests := []struct {
+		collage *Collage
+		want    string
+	}{
+		{&Collage{Items: items}, "size of the collage"},
+		{&Collage{Width: 100, Height: 100}, "no items"},
+		{&Collage{Width: 100, Height: 100, Items: items, Gutter: -1}, "gutter"},
+		{&Collage{Width: 100, Height: 100, Items: items, Gutter: 50}, "gutter of the collage is too large"},
+		{&Collage{Width: 100, Height: 100, Items: items, Columns: 1, Rows: 2}, "don't fit"},
+		{&Collage{Width: 100, Height: 100, Items: items, Layout: CollageLayoutMasonry}, "size of \"/1.jpg\" is required"},
+		{&Collage{Width: 100, Height: 100, Items: items, Layout: 10}, "unknown collage layout"},
+	}
+	for i, tt := range tests {
+		_, err := tt.collage.Config()
+		if err == nil {
+			t.Errorf("%d: want error, got nil", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%d: want error containing %q, got %v", i, tt.want, err)
+		}
+	}
+}
+
+func TestCollage_Config_noBackground(t *testing.T) {
+	c := &Collage{
+		Width:  400,
+		Height: 200,
+		Items: []CollageItem{
+			{Path: "/1.jpg"},
+		},
+	}
+	cfg, err := c.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the canvas is padded to 400x200 without "b=".
+	want := "w=400%2Ch=200%2Ca=3%2Cl=(w=400%2Ch=200%2Ca=2%2Clg=1%2F1.jpg)"
+	if got := cfg.String(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestCollage_Build(t *testing.T) {
+	p := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	c := &Collage{
+		Base:   "/blank.png",
+		Width:  400,
+		Height: 200,
+		Items: []CollageItem{
+			{Path: "/1.jpg"},
+			{Path: "/2.jpg"},
+		},
+	}
+	res, err := c.Build(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.URL != res.Image.SignedURL() {
+		t.Errorf("want %s, got %s", res.Image.SignedURL(), res.URL)
+	}
+	verified, err := p.Verify(res.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !verified.Valid {
+		t.Errorf("the signature of %s is invalid", res.URL)
+	}
+	if len(res.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", res.Warnings)
+	}
+
+	// too long URL.
+	c.MaxURLLength = 100
+	res, err = c.Build(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "longer than the limit 100 bytes") {
+		t.Errorf("unexpected warnings: %v", res.Warnings)
+	}
+
+	// overflow in the masonry layout.
+	c.MaxURLLength = 0
+	c.Layout = CollageLayoutMasonry
+	c.Columns = 2
+	c.Items = []CollageItem{
+		{Path: "/1.jpg", Width: 100, Height: 100},
+		{Path: "/2.jpg", Width: 100, Height: 300},
+	}
+	res, err = c.Build(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Warnings) != 1 || !strings.Contains(res.Warnings[0], "item 1 (/2.jpg) overflows") {
+		t.Errorf("unexpected warnings: %v", res.Warnings)
+	}
+
+	c.Base = ""
+	if _, err := c.Build(p); err == nil {
+		t.Error("want error for the missing base, got nil")
+	}
+}
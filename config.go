@@ -2,16 +2,15 @@ package imageflux
 
 import (
 	"bytes"
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
 	"errors"
 	"fmt"
 	"image"
 	"image/color"
+	"maps"
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -156,6 +155,11 @@ type Config struct {
 
 	// Texts are the texts to be used for the image.
 	Texts []*Text
+
+	// Extra is the values of the custom parameters registered by RegisterParam.
+	// The key is the canonical key of the parameter,
+	// and the value is the raw value as it appears in the URL.
+	Extra map[string]string
 }
 
 // Unsharp is an unsharp filter config.
@@ -671,248 +675,26 @@ func (c *Config) String() string {
 	return str
 }
 
+// AppendText appends the string representation of c to b and returns the extended buffer.
+// The format is same as String.
+// It implements the encoding.TextAppender interface.
+func (c *Config) AppendText(b []byte) ([]byte, error) {
+	return c.append(b), nil
+}
+
 func (c *Config) append(buf []byte) []byte {
-	var zr image.Rectangle
-	var zp image.Point
 	if c == nil {
 		buf = append(buf, "f=auto"...)
 		return buf
 	}
 
 	l := len(buf)
-	if c.Width != 0 {
-		buf = append(buf, "w="...)
-		buf = strconv.AppendInt(buf, int64(c.Width), 10)
-		buf = appendComma(buf)
-	}
-	if c.Height != 0 {
-		buf = append(buf, "h="...)
-		buf = strconv.AppendInt(buf, int64(c.Height), 10)
-		buf = appendComma(buf)
-	}
-	if !c.Expires.IsZero() {
-		buf = append(buf, "expires="...)
-		buf = c.Expires.In(time.UTC).Truncate(time.Second).AppendFormat(buf, time.RFC3339)
-		buf = appendComma(buf)
-	}
-	if c.DisableEnlarge {
-		buf = append(buf, "u=0"...)
-		buf = appendComma(buf)
-	}
-	if c.AspectMode != AspectModeDefault {
-		buf = append(buf, "a="...)
-		buf = strconv.AppendInt(buf, int64(c.AspectMode-1), 10)
-		buf = appendComma(buf)
-	}
-	if c.DevicePixelRatio != 0 {
-		buf = append(buf, "dpr="...)
-		buf = strconv.AppendFloat(buf, c.DevicePixelRatio, 'f', -1, 64)
-		buf = appendComma(buf)
-	}
-
-	// clipping parameters
-	if ic := c.InputClip; ic != zr {
-		buf = append(buf, "ic="...)
-		buf = strconv.AppendInt(buf, int64(ic.Min.X), 10)
-		buf = append(buf, ':')
-		buf = strconv.AppendInt(buf, int64(ic.Min.Y), 10)
-		buf = append(buf, ':')
-		buf = strconv.AppendInt(buf, int64(ic.Max.X), 10)
-		buf = append(buf, ':')
-		buf = strconv.AppendInt(buf, int64(ic.Max.Y), 10)
-		buf = appendComma(buf)
-	}
-	if cm, ic := c.ClipMax, c.InputClipRatio; cm != zp && ic != zr {
-		x1 := float64(ic.Min.X) / float64(cm.X)
-		y1 := float64(ic.Min.Y) / float64(cm.Y)
-		x2 := float64(ic.Max.X) / float64(cm.X)
-		y2 := float64(ic.Max.Y) / float64(cm.Y)
-		buf = append(buf, "icr="...)
-		buf = strconv.AppendFloat(buf, x1, 'f', -1, 64)
-		buf = append(buf, ':')
-		buf = strconv.AppendFloat(buf, y1, 'f', -1, 64)
-		buf = append(buf, ':')
-		buf = strconv.AppendFloat(buf, x2, 'f', -1, 64)
-		buf = append(buf, ':')
-		buf = strconv.AppendFloat(buf, y2, 'f', -1, 64)
-		buf = appendComma(buf)
-	}
-	if ig := c.InputOrigin; ig != OriginDefault {
-		buf = append(buf, "ig="...)
-		buf = strconv.AppendInt(buf, int64(ig), 10)
-		buf = appendComma(buf)
-	}
-	if c, oc := c.Clip, c.OutputClip; c != zr || oc != zr {
-		if oc == zr {
-			oc = c
-		}
-		buf = append(buf, "oc="...)
-		buf = strconv.AppendInt(buf, int64(oc.Min.X), 10)
-		buf = append(buf, ':')
-		buf = strconv.AppendInt(buf, int64(oc.Min.Y), 10)
-		buf = append(buf, ':')
-		buf = strconv.AppendInt(buf, int64(oc.Max.X), 10)
-		buf = append(buf, ':')
-		buf = strconv.AppendInt(buf, int64(oc.Max.Y), 10)
-		buf = appendComma(buf)
-	}
-	if c, oc, cm := c.ClipRatio, c.OutputClipRatio, c.ClipMax; cm != zp && (c != zr || oc != zr) {
-		if oc == zr {
-			oc = c
-		}
-		x1 := float64(oc.Min.X) / float64(cm.X)
-		y1 := float64(oc.Min.Y) / float64(cm.Y)
-		x2 := float64(oc.Max.X) / float64(cm.X)
-		y2 := float64(oc.Max.Y) / float64(cm.Y)
-		buf = append(buf, "ocr="...)
-		buf = strconv.AppendFloat(buf, x1, 'f', -1, 64)
-		buf = append(buf, ':')
-		buf = strconv.AppendFloat(buf, y1, 'f', -1, 64)
-		buf = append(buf, ':')
-		buf = strconv.AppendFloat(buf, x2, 'f', -1, 64)
-		buf = append(buf, ':')
-		buf = strconv.AppendFloat(buf, y2, 'f', -1, 64)
-		buf = appendComma(buf)
-	}
-	if og := c.OutputOrigin; og != OriginDefault {
-		buf = append(buf, "og="...)
-		buf = strconv.AppendInt(buf, int64(og), 10)
-		buf = appendComma(buf)
-	}
-
-	if c.Origin != OriginDefault {
-		buf = append(buf, "g="...)
-		buf = strconv.AppendInt(buf, int64(c.Origin), 10)
-		buf = appendComma(buf)
-	}
-	if c.Background != nil {
-		b := color.NRGBAModel.Convert(c.Background).(color.NRGBA)
-		if b.A == 0xff {
-			// opaque background
-			buf = append(buf, "b="...)
-			buf = appendByte(buf, b.R)
-			buf = appendByte(buf, b.G)
-			buf = appendByte(buf, b.B)
-			buf = appendComma(buf)
-		} else {
-			buf = append(buf, "b="...)
-			buf = appendByte(buf, b.R)
-			buf = appendByte(buf, b.G)
-			buf = appendByte(buf, b.B)
-			buf = appendByte(buf, b.A)
-			buf = appendComma(buf)
-		}
-	}
-
-	// rotation
-	if ir := c.InputRotate; ir != RotateDefault {
-		if ir == RotateAuto {
-			buf = append(buf, "ir=auto"...)
-			buf = appendComma(buf)
-		} else {
-			buf = append(buf, "ir="...)
-			buf = strconv.AppendInt(buf, int64(ir), 10)
-			buf = appendComma(buf)
-		}
-	}
-	if r, or := c.Rotate, c.OutputRotate; r != RotateDefault || or != RotateDefault {
-		if or == RotateDefault {
-			or = r
-		}
-		if or == RotateAuto {
-			buf = append(buf, "or=auto"...)
-			buf = appendComma(buf)
-		} else {
-			buf = append(buf, "or="...)
-			buf = strconv.AppendInt(buf, int64(or), 10)
-			buf = appendComma(buf)
-		}
-	}
-
-	if c.Through != 0 {
-		buf = append(buf, "through="...)
-		buf = c.Through.append(buf)
-		buf = appendComma(buf)
-	}
-
-	if len(c.Overlays) > 0 {
-		for _, overlay := range c.Overlays {
-			buf = append(buf, "l=("...)
-			buf = overlay.append(buf)
-			buf = append(buf, ')')
-			buf = appendComma(buf)
-		}
-	}
-
-	// output formats
-	if c.Format != "" {
-		buf = append(buf, "f="...)
-		buf = append(buf, c.Format...)
-		buf = appendComma(buf)
-	}
-	if c.Quality != 0 {
-		buf = append(buf, "q="...)
-		buf = strconv.AppendInt(buf, int64(c.Quality), 10)
-		buf = appendComma(buf)
-	}
-	if c.DisableOptimization {
-		buf = append(buf, "o=0"...)
-		buf = appendComma(buf)
-	}
-	if c.Lossless {
-		buf = append(buf, "lossless=1"...)
-		buf = appendComma(buf)
-	}
-	if c.ExifOption != ExifOptionDefault {
-		buf = append(buf, "s="...)
-		buf = strconv.AppendInt(buf, int64(c.ExifOption), 10)
-		buf = appendComma(buf)
-	}
-
-	// image filters
-	if c.Unsharp.Radius != 0 {
-		buf = append(buf, "unsharp="...)
-		buf = c.Unsharp.append(buf)
-		buf = appendComma(buf)
-	}
-	if c.Blur.Radius != 0 {
-		buf = append(buf, "blur="...)
-		buf = c.Blur.append(buf)
-		buf = appendComma(buf)
-	}
-	if c.GrayScale != 0 {
-		buf = append(buf, "grayscale="...)
-		buf = strconv.AppendInt(buf, int64(c.GrayScale), 10)
-		buf = appendComma(buf)
-	}
-	if c.Sepia != 0 {
-		buf = append(buf, "sepia="...)
-		buf = strconv.AppendInt(buf, int64(c.Sepia), 10)
-		buf = appendComma(buf)
-	}
-	if c.Brightness != 0 {
-		buf = append(buf, "brightness="...)
-		buf = strconv.AppendInt(buf, int64(c.Brightness+100), 10)
-		buf = appendComma(buf)
-	}
-	if c.Contrast != 0 {
-		buf = append(buf, "contrast="...)
-		buf = strconv.AppendInt(buf, int64(c.Contrast+100), 10)
-		buf = appendComma(buf)
-	}
-	if c.Invert {
-		buf = append(buf, "invert=1"...)
-		buf = appendComma(buf)
-	}
-
-	if len(c.Texts) > 0 {
-		for _, text := range c.Texts {
-			buf = append(buf, "t=("...)
-			buf = text.append(buf)
-			buf = append(buf, ')')
-			buf = appendComma(buf)
+	for _, p := range configParams {
+		if p.appendConfig != nil {
+			buf = p.appendConfig(buf, c)
 		}
 	}
+	buf = appendExtra(buf, c.Extra)
 
 	if len(buf) == l {
 		buf = append(buf, "f=auto"...)
@@ -939,6 +721,8 @@ func (a AspectMode) String() string {
 		return "scale"
 	case AspectModeForceScale:
 		return "force-scale"
+	case AspectModeCrop:
+		return "crop"
 	case AspectModePad:
 		return "pad"
 	}
@@ -947,87 +731,157 @@ func (a AspectMode) String() string {
 
 func ParseConfig(s string) (config *Config, rest string, err error) {
 	state := parseState{
-		s:      s,
-		config: &Config{},
+		Tokenizer: Tokenizer{s: s},
+		config:    &Config{},
 	}
 	return state.parseConfig()
 }
 
+// reset resets c to the zero value, keeping the backing arrays of Overlays and Texts and the map of Extra.
+func (c *Config) reset() {
+	// drop the references to old overlays and texts for GC.
+	clear(c.Overlays)
+	clear(c.Texts)
+	clear(c.Extra)
+
+	overlays := c.Overlays[:0]
+	texts := c.Texts[:0]
+	*c = Config{
+		Overlays: overlays,
+		Texts:    texts,
+		Extra:    c.Extra,
+	}
+}
+
+// clone returns a deep copy of c.
+// It returns nil if c is nil.
+func (c *Config) clone() *Config {
+	if c == nil {
+		return nil
+	}
+	ret := *c
+	if c.Overlays != nil {
+		ret.Overlays = make([]*Overlay, len(c.Overlays))
+		for i, o := range c.Overlays {
+			ret.Overlays[i] = o.clone()
+		}
+	}
+	if c.Texts != nil {
+		ret.Texts = make([]*Text, len(c.Texts))
+		for i, t := range c.Texts {
+			ret.Texts[i] = t.clone()
+		}
+	}
+	ret.Extra = maps.Clone(c.Extra)
+	return &ret
+}
+
+// clone returns a deep copy of o.
+func (o *Overlay) clone() *Overlay {
+	if o == nil {
+		return nil
+	}
+	ret := *o
+	ret.Extra = maps.Clone(o.Extra)
+	return &ret
+}
+
+// clone returns a deep copy of t.
+func (t *Text) clone() *Text {
+	if t == nil {
+		return nil
+	}
+	ret := *t
+	if t.Font != nil {
+		font := *t.Font
+		font.Variables = maps.Clone(t.Font.Variables)
+		ret.Font = &font
+	}
+	ret.Extra = maps.Clone(t.Extra)
+	return &ret
+}
+
+var parseStatePool = sync.Pool{
+	New: func() any {
+		return new(parseState)
+	},
+}
+
 type parseState struct {
-	s      string
-	idx    int
+	Tokenizer
 	config *Config
 
 	// the signature that the user provided.
 	signature string
+
+	// payloadPrefix is prepended to the payload of the signature.
+	payloadPrefix string
+
+	// allowExpired disables the expiration check.
+	// The caller is responsible for checking config.Expires.
+	allowExpired bool
+
+	// warnings are non-fatal problems found while parsing.
+	warnings []string
 }
 
 func (s *parseState) parseConfig() (*Config, string, error) {
-	if !s.hasParameter() {
-		return s.config, s.rest(), nil
-	}
-
-	for {
-		key, foundEqual := s.getKey()
-		if !foundEqual {
-			if key != "" {
-				return nil, "", fmt.Errorf("imageflux: missing '=' after key %q", key)
-			}
-			break
-		}
-		value, err := s.getValue()
-		if err != nil {
-			return nil, "", err
-		}
-		s.skipComma()
-		if err := s.setValue(key, value); err != nil {
+	for s.Next() {
+		tok := s.Token()
+		if err := s.setValue(tok.Key, tok.RawValue); err != nil {
 			return nil, "", err
 		}
 	}
+	if err := s.Err(); err != nil {
+		return nil, "", err
+	}
+	return s.config, s.Rest(), nil
+}
+
+func (s *parseState) parseConfigAndVerifySignature(p *Proxy) (*Config, string, error) {
+	pbuf := bufPool.Get().(*[]byte)
+	defer bufPool.Put(pbuf)
 
-	return s.config, s.rest(), nil
+	config, rest, payload, err := s.parseConfigAndPayload((*pbuf)[:0])
+	if err != nil {
+		return nil, "", err
+	}
+	*pbuf = payload
+	if _, err := p.verifySignature(s.signature, payload); err != nil {
+		return nil, "", err
+	}
+	return config, rest, nil
 }
 
-func (s *parseState) parseConfigAndVerifySignature(secret []byte) (*Config, string, error) {
-	if !s.hasParameter() {
-		buf := []byte(s.s)
-		if err := s.verifySignature(secret, buf); err != nil {
-			return nil, "", err
-		}
-		return s.config, s.rest(), nil
+// parseConfigAndPayload parses the config and appends the payload of the signature to buf.
+func (s *parseState) parseConfigAndPayload(buf []byte) (*Config, string, []byte, error) {
+	buf = append(buf, s.payloadPrefix...)
+	if !s.begin() {
+		buf = append(buf, s.s...)
+		return s.config, s.Rest(), buf, nil
 	}
 
-	buf := make([]byte, 0, len(s.s))
+	payloadStart := len(buf)
 	if len(s.s) == 0 || s.s[0] != '/' {
 		buf = append(buf, '/')
 	}
 	buf = append(buf, s.s[:s.idx]...)
 
 	hasParam := false
-	for {
-		start := s.idx
-		key, foundEqual := s.getKey()
-		if !foundEqual {
-			if key != "" {
-				return nil, "", fmt.Errorf("imageflux: missing '=' after key %q", key)
-			}
-			break
-		}
-		value, err := s.getValue()
-		if err != nil {
-			return nil, "", err
-		}
-		s.skipComma()
-		if err := s.setValue(key, value); err != nil {
-			return nil, "", err
+	for s.Next() {
+		tok := s.Token()
+		if err := s.setValue(tok.Key, tok.RawValue); err != nil {
+			return nil, "", nil, err
 		}
-		end := s.idx
-
-		if key != "sig" {
+		if tok.Key != "sig" {
+			// keep the original separator after the parameter.
 			hasParam = true
-			buf = append(buf, s.s[start:end]...)
+			buf = append(buf, s.s[tok.Start:s.idx]...)
 		}
 	}
+	if err := s.Err(); err != nil {
+		return nil, "", nil, err
+	}
 
 	if hasParam {
 		if len(buf) >= 1 && buf[len(buf)-1] == ',' {
@@ -1038,518 +892,37 @@ func (s *parseState) parseConfigAndVerifySignature(secret []byte) (*Config, stri
 			buf = buf[:len(buf)-3]
 		}
 	} else {
-		buf = buf[:0]
-	}
-	buf = append(buf, s.rest()...)
-
-	if err := s.verifySignature(secret, buf); err != nil {
-		return nil, "", err
-	}
-
-	return s.config, s.rest(), nil
-}
-
-func (s *parseState) verifySignature(secret, data []byte) error {
-	if strings.HasPrefix(s.signature, "1.") {
-		// signature version 1
-		sig, err := base64.URLEncoding.DecodeString(s.signature[len("1."):])
-		if err != nil {
-			return ErrInvalidSignature
-		}
-
-		w := hmac.New(sha256.New, secret)
-		w.Write(data) // hash.hash never returns an error, so no need to check errors.
-		sum := w.Sum(nil)
-
-		if !hmac.Equal(sig, sum) {
-			return ErrInvalidSignature
-		}
-		return nil
+		buf = buf[:payloadStart]
 	}
-	return ErrInvalidSignature
-}
-
-func (s *parseState) hasParameter() bool {
-	i := s.idx
-	if i >= len(s.s) {
-		return false
-	}
-
-	// skip leading slash
-	if s.s[i] == '/' {
-		i++
-	}
-
-	// parameters may start with 'c/' or 'c!/'.
-	if strings.HasPrefix(s.s[i:], "c/") {
-		s.idx = i + len("c/")
-		return true
-	}
-	if strings.HasPrefix(s.s[i:], "c!/") {
-		s.idx += i + len("c!/")
-		return true
-	}
-
-	// guess whether the string has parameters.
-	// parameters always have '=', so we search for it.
-	for ; i < len(s.s); i++ {
-		if s.s[i] == '/' {
-			// we didn't find any parameter.
-			return false
-		}
+	buf = append(buf, s.Rest()...)
 
-		if s.s[i] == '=' {
-			// we might find a parameter.
-			if s.s[s.idx] == '/' {
-				s.idx++
-			}
-			return true
-		}
-	}
-	return false
+	return s.config, s.Rest(), buf, nil
 }
 
 func (s *parseState) setValue(key, value string) error {
-	var zr image.Rectangle
-
-	switch key {
-	// Width
-	case "w":
-		w, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid width %q: %w", value, err)
-		}
-		if w <= 0 {
-			return fmt.Errorf("imageflux: invalid width %q: validation error", value)
-		}
-		s.config.Width = w
-
-	// Height
-	case "h":
-		h, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid height %q: %w", value, err)
-		}
-		if h <= 0 {
-			return fmt.Errorf("imageflux: invalid height %q: validation error", value)
-		}
-		s.config.Height = h
-
-	// DisableEnlarge
-	case "u":
-		switch value {
-		case "0":
-			s.config.DisableEnlarge = true
-		case "1":
-			s.config.DisableEnlarge = false
-		default:
-			return fmt.Errorf("imageflux: invalid disable enlarge %q", value)
-		}
-
-	// AspectMode
-	case "a":
-		a, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid aspect mode %q: %w", value, err)
-		}
-		if a < 0 || AspectMode(a+1) >= aspectModeMax {
-			return fmt.Errorf("imageflux: invalid aspect mode %q: validation error", value)
-		}
-		s.config.AspectMode = AspectMode(a + 1)
-
-	// DevicePixelRatio
-	case "dpr":
-		dpr, err := strconv.ParseFloat(value, 64)
-		if err != nil || dpr <= 0 || math.IsNaN(dpr) || math.IsInf(dpr, 0) {
-			return fmt.Errorf("imageflux: invalid device pixel ratio %q", value)
-		}
-		s.config.DevicePixelRatio = dpr
-
-	// InputClip
-	case "ic":
-		v0, v1, v2, v3, ok := split4(value)
-		if !ok {
-			return fmt.Errorf("imageflux: invalid input clip %q", value)
-		}
-		minX, err0 := strconv.Atoi(v0)
-		minY, err1 := strconv.Atoi(v1)
-		maxX, err2 := strconv.Atoi(v2)
-		maxY, err3 := strconv.Atoi(v3)
-		ic := image.Rect(minX, minY, maxX, maxY)
-		if err0 != nil || err1 != nil || err2 != nil || err3 != nil || ic == zr {
-			return fmt.Errorf("imageflux: invalid input clip %q", value)
-		}
-		s.config.InputClip = ic
-
-	// InputClipRatio
-	case "icr":
-		v0, v1, v2, v3, ok := split4(value)
-		minX, err0 := strconv.ParseFloat(v0, 64)
-		minY, err1 := strconv.ParseFloat(v1, 64)
-		maxX, err2 := strconv.ParseFloat(v2, 64)
-		maxY, err3 := strconv.ParseFloat(v3, 64)
-		icr := image.Rect(
-			int(math.Round(minX*rectangleScale)),
-			int(math.Round(minY*rectangleScale)),
-			int(math.Round(maxX*rectangleScale)),
-			int(math.Round(maxY*rectangleScale)),
-		)
-		ok = ok && err0 == nil && err1 == nil && err2 == nil && err3 == nil && icr != zr
-		ok = ok && minX >= 0 && minX <= 1 && minY >= 0 && minY <= 1 && maxX >= 0 && maxX <= 1 && maxY >= 0 && maxY <= 1
-		if !ok {
-			return fmt.Errorf("imageflux: invalid input clip ratio %q", value)
-		}
-		s.config.InputClipRatio = icr
-		s.config.ClipMax = image.Pt(rectangleScale, rectangleScale)
-
-	// InputOrigin
-	case "ig":
-		ig, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid input origin %q: %w", value, err)
-		}
-		if ig < 0 || Origin(ig) >= originMax {
-			return fmt.Errorf("imageflux: invalid input origin %q: validation error", value)
-		}
-		s.config.InputOrigin = Origin(ig)
-
-	// OutputClip
-	case "oc", "c":
-		v0, v1, v2, v3, ok := split4(value)
-		if !ok {
-			return fmt.Errorf("imageflux: invalid output clip %q", value)
-		}
-		minX, err0 := strconv.Atoi(v0)
-		minY, err1 := strconv.Atoi(v1)
-		maxX, err2 := strconv.Atoi(v2)
-		maxY, err3 := strconv.Atoi(v3)
-		oc := image.Rect(minX, minY, maxX, maxY)
-		if err0 != nil || err1 != nil || err2 != nil || err3 != nil || oc == zr {
-			return fmt.Errorf("imageflux: invalid input clip %q", value)
-		}
-		s.config.OutputClip = oc
-
-	// OutputClipRatio
-	case "ocr", "cr":
-		v0, v1, v2, v3, ok := split4(value)
-		minX, err0 := strconv.ParseFloat(v0, 64)
-		minY, err1 := strconv.ParseFloat(v1, 64)
-		maxX, err2 := strconv.ParseFloat(v2, 64)
-		maxY, err3 := strconv.ParseFloat(v3, 64)
-		ocr := image.Rect(
-			int(math.Round(minX*rectangleScale)),
-			int(math.Round(minY*rectangleScale)),
-			int(math.Round(maxX*rectangleScale)),
-			int(math.Round(maxY*rectangleScale)),
-		)
-		ok = ok && err0 == nil && err1 == nil && err2 == nil && err3 == nil && ocr != zr
-		ok = ok && minX >= 0 && minX <= 1 && minY >= 0 && minY <= 1 && maxX >= 0 && maxX <= 1 && maxY >= 0 && maxY <= 1
-		if !ok {
-			return fmt.Errorf("imageflux: invalid input clip ratio %q", value)
-		}
-
-		s.config.OutputClipRatio = ocr
-		s.config.ClipMax = image.Pt(rectangleScale, rectangleScale)
-
-	// OutputOrigin
-	case "og":
-		og, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid output origin %q: %w", value, err)
-		}
-		if og < 0 || Origin(og) >= originMax {
-			return fmt.Errorf("imageflux: invalid output origin %q: validation error", value)
-		}
-		s.config.OutputOrigin = Origin(og)
-
-	// Origin
-	case "g":
-		g, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid origin %q: %w", value, err)
-		}
-		if g < 0 || Origin(g) >= originMax {
-			return fmt.Errorf("imageflux: invalid origin %q: validation error", value)
-		}
-		s.config.Origin = Origin(g)
-
-	// Background
-	case "b":
-		if len(value) == 6 {
-			rgb, err := strconv.ParseUint(value, 16, 32)
-			if err != nil {
-				return fmt.Errorf("imageflux: invalid background %q", value)
-			}
-			s.config.Background = color.NRGBA{
-				R: uint8(rgb >> 16),
-				G: uint8(rgb >> 8),
-				B: uint8(rgb),
-				A: 0xff,
-			}
-		} else if len(value) == 8 {
-			rgba, err := strconv.ParseUint(value, 16, 32)
-			if err != nil {
-				return fmt.Errorf("imageflux: invalid background %q", value)
-			}
-			s.config.Background = color.NRGBA{
-				R: uint8(rgba >> 24),
-				G: uint8(rgba >> 16),
-				B: uint8(rgba >> 8),
-				A: uint8(rgba),
-			}
-		} else {
-			return fmt.Errorf("imageflux: invalid background %q", value)
-		}
-
-	// InputRotate
-	case "ir":
-		if value == "auto" {
-			s.config.InputRotate = RotateAuto
-		} else {
-			ir, err := strconv.Atoi(value)
-			if err != nil || Rotate(ir) < rotateMin || Rotate(ir) >= rotateMax {
-				return fmt.Errorf("imageflux: invalid input rotate %q", value)
-			}
-			s.config.InputRotate = Rotate(ir)
-		}
-
-	// OutputRotate
-	case "or", "r":
-		if value == "auto" {
-			s.config.OutputRotate = RotateAuto
-		} else {
-			ir, err := strconv.Atoi(value)
-			if err != nil || Rotate(ir) < rotateMin || Rotate(ir) >= rotateMax {
-				return fmt.Errorf("imageflux: invalid output rotate %q", value)
-			}
-			s.config.OutputRotate = Rotate(ir)
-		}
-
-	// Through
-	case "through":
-		t, err := parseThrough(value)
-		if err != nil {
-			return err
-		}
-		s.config.Through = t
-
-	// Overlays
-	case "l":
-		if len(value) < 2 || value[0] != '(' || value[len(value)-1] != ')' {
-			return fmt.Errorf("imageflux: invalid overlays %q", value)
-		}
-		value = value[1 : len(value)-1]
-		overlay, err := ParseOverlay(value)
-		if err != nil {
-			return err
-		}
-		s.config.Overlays = append(s.config.Overlays, overlay)
-
-	// Format
-	case "f":
-		f, err := newFormat(value)
-		if err != nil {
-			return err
-		}
-		s.config.Format = f
-
-	// Quality
-	case "q":
-		q, err := strconv.Atoi(value)
-		if err != nil || q < 0 || q > 100 {
-			return fmt.Errorf("imageflux: invalid quality %q", value)
-		}
-		s.config.Quality = q
-
-	// DisableOptimization
-	case "o":
-		v, err := parseBoolean(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid optimization %q: %w", value, err)
-		}
-		s.config.DisableOptimization = !v
-
-	// Lossless
-	case "lossless":
-		v, err := parseBoolean(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid lossless %q: %w", value, err)
-		}
-		s.config.Lossless = v
-
-	// ExifOption
-	case "s":
-		v, err := strconv.Atoi(value)
-		if err != nil || ExifOption(v) < exifOptionMin || ExifOption(v) >= exifOptionMax {
-			return fmt.Errorf("imageflux: invalid exif option %q", value)
-		}
-		s.config.ExifOption = ExifOption(v)
-
-	// Unsharp
-	case "unsharp":
-		unsharp, err := parseUnsharp(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid unsharp %q", value)
-		}
-		s.config.Unsharp = unsharp
-
-	// Blur
-	case "blur":
-		blur, err := parseBlur(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid blur %q", value)
-		}
-		s.config.Blur = blur
-
-	// GrayScale
-	case "grayscale":
-		grayscale, err := strconv.Atoi(value)
-		if err != nil || grayscale < 0 || grayscale > 100 {
-			return fmt.Errorf("imageflux: invalid grayscale %q", value)
-		}
-		s.config.GrayScale = grayscale
-
-	// Sepia
-	case "sepia":
-		sepia, err := strconv.Atoi(value)
-		if err != nil || sepia < 0 || sepia > 100 {
-			return fmt.Errorf("imageflux: invalid sepia %q", value)
-		}
-		s.config.Sepia = sepia
-
-	// Brightness
-	case "brightness":
-		brightness, err := strconv.Atoi(value)
-		if err != nil || brightness < 0 {
-			return fmt.Errorf("imageflux: invalid brightness %q", value)
-		}
-		s.config.Brightness = brightness - 100
-
-	// Contrast
-	case "contrast":
-		contrast, err := strconv.Atoi(value)
-		if err != nil || contrast < 0 {
-			return fmt.Errorf("imageflux: invalid contrast %q", value)
-		}
-		s.config.Contrast = contrast - 100
-
-	// Invert
-	case "invert":
-		v, err := parseBoolean(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid invert %q: %w", value, err)
-		}
-		s.config.Invert = v
-
-	// Texts
-	case "t":
-		if len(value) < 2 || value[0] != '(' || value[len(value)-1] != ')' {
-			return fmt.Errorf("imageflux: invalid texts %q", value)
-		}
-		value = value[1 : len(value)-1]
-		text, err := ParseText(value)
-		if err != nil {
-			return err
-		}
-		s.config.Texts = append(s.config.Texts, text)
-
-	// Expires
-	case "expires":
-		expires, err := time.Parse(time.RFC3339, value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid expires %q", value)
-		}
-		expires = expires.Truncate(time.Second)
-		if !expires.After(nowFunc()) {
-			return ErrExpired
-		}
-		s.config.Expires = expires
-
-	case "sig":
-		// if signature is already set, ignore this
-		if s.signature == "" {
-			s.signature = value
-		}
-	}
-	return nil
-}
-
-// getKey returns the key at the current index and advances the index.
-func (s *parseState) getKey() (key string, foundEqual bool) {
-	i := s.idx
-	for ; i < len(s.s); i++ {
-		switch s.s[i] {
-		case '=':
-			key = s.s[s.idx:i]
-			s.idx = i + 1
-			foundEqual = true
-			return
-		case '/', ',':
-			key = s.s[s.idx:i]
-			s.idx = i
-			foundEqual = false
-			return
-		}
-	}
-	return s.s[s.idx:i], false
-}
-
-// getValue returns the value at the current index and advances the index.
-func (s *parseState) getValue() (string, error) {
-	var nest int
-	i := s.idx
-LOOP:
-	for ; i < len(s.s); i++ {
-		switch s.s[i] {
-		case '(':
-			nest++
-		case ')':
-			nest--
-		case ',', '/':
-			if nest == 0 {
-				break LOOP
-			}
-		case '%':
-			if nest != 0 {
-				break
-			}
-			if i+3 <= len(s.s) && (s.s[i:i+3] == "%2c" || s.s[i:i+3] == "%2C") {
-				// "%2C" is encoded comma ','.
-				break LOOP
-			}
-		}
-	}
-	if nest != 0 {
-		return "", errors.New("imageflux: invalid value: parenthesis is not closed")
-	}
-	value := s.s[s.idx:i]
-	s.idx = i
-	return value, nil
-}
-
-// skipComma skips the ',' at the current index and returns true if it was found.
-func (s *parseState) skipComma() (skipped bool) {
-	if s.idx < len(s.s) && s.s[s.idx] == ',' {
-		s.idx++
-		return true
+	p, ok := builtinParamsByKey[paramKey{TargetConfig, key}]
+	if !ok {
+		_, err := setExtra(&s.config.Extra, &s.warnings, TargetConfig, key, value)
+		return err
 	}
-	if s.idx+3 <= len(s.s) && (s.s[s.idx:s.idx+3] == "%2c" || s.s[s.idx:s.idx+3] == "%2C") {
-		// "%2C" is encoded comma ','.
-		s.idx += 3
-		return true
+	if key != p.Key {
+		s.warnings = append(s.warnings, deprecatedKeyWarning(key, p.Key))
 	}
-	return false
+	return p.parseConfig(s, value)
 }
 
-func (s *parseState) rest() string {
-	return s.s[s.idx:]
-}
+// errInvalidColor and errInvalidBoolean are the errors of parseColor and parseBoolean.
+// They are not prefixed because the callers wrap them with the name of the parameter.
+var (
+	errInvalidColor   = errors.New("must be RRGGBB or RRGGBBAA in hexadecimal")
+	errInvalidBoolean = errors.New("must be 0 or 1")
+)
 
 func parseColor(s string) (color.NRGBA, error) {
 	if len(s) == 6 {
 		rgb, err := strconv.ParseUint(s, 16, 32)
 		if err != nil {
-			return color.NRGBA{}, fmt.Errorf("imageflux: invalid color %q", s)
+			return color.NRGBA{}, errInvalidColor
 		}
 		return color.NRGBA{
 			R: uint8(rgb >> 16),
@@ -1560,7 +933,7 @@ func parseColor(s string) (color.NRGBA, error) {
 	} else if len(s) == 8 {
 		rgba, err := strconv.ParseUint(s, 16, 32)
 		if err != nil {
-			return color.NRGBA{}, fmt.Errorf("imageflux: invalid color %q", s)
+			return color.NRGBA{}, errInvalidColor
 		}
 		return color.NRGBA{
 			R: uint8(rgba >> 24),
@@ -1569,7 +942,7 @@ func parseColor(s string) (color.NRGBA, error) {
 			A: uint8(rgba),
 		}, nil
 	}
-	return color.NRGBA{}, fmt.Errorf("imageflux: invalid color %q", s)
+	return color.NRGBA{}, errInvalidColor
 }
 
 func parseBoolean(s string) (bool, error) {
@@ -1579,6 +952,6 @@ func parseBoolean(s string) (bool, error) {
 	case "1":
 		return true, nil
 	default:
-		return false, fmt.Errorf("imageflux: invalid boolean %q", s)
+		return false, errInvalidBoolean
 	}
 }
@@ -197,6 +197,10 @@ func TestAspectMode_String(t *testing.T) {
 			AspectModeForceScale,
 			"force-scale",
 		},
+		{
+			AspectModeCrop,
+			"crop",
+		},
 		{
 			AspectModePad,
 			"pad",
@@ -754,6 +758,19 @@ func TestConfig(t *testing.T) {
 	}
 }
 
+func TestConfig_AppendText(t *testing.T) {
+	for _, c := range configStringCases {
+		got, err := c.config.AppendText([]byte("prefix:"))
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %v", c.config, err)
+			continue
+		}
+		if want := "prefix:" + c.output; string(got) != want {
+			t.Errorf("%#v: want %q, got %q", c.config, want, got)
+		}
+	}
+}
+
 var parseConfigCases = []struct {
 	input string
 	want  *Config
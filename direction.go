@@ -0,0 +1,146 @@
+package imageflux
+
+import "unicode"
+
+// rtlScripts are the scripts whose letters are strong right-to-left characters,
+// i.e. the bidirectional character type R or AL.
+var rtlScripts = []*unicode.RangeTable{
+	unicode.Adlam,
+	unicode.Arabic,
+	unicode.Avestan,
+	unicode.Chorasmian,
+	unicode.Cypriot,
+	unicode.Elymaic,
+	unicode.Hanifi_Rohingya,
+	unicode.Hatran,
+	unicode.Hebrew,
+	unicode.Imperial_Aramaic,
+	unicode.Inscriptional_Pahlavi,
+	unicode.Inscriptional_Parthian,
+	unicode.Kharoshthi,
+	unicode.Lydian,
+	unicode.Mandaic,
+	unicode.Manichaean,
+	unicode.Mende_Kikakui,
+	unicode.Meroitic_Cursive,
+	unicode.Meroitic_Hieroglyphs,
+	unicode.Nabataean,
+	unicode.Nko,
+	unicode.Old_Hungarian,
+	unicode.Old_North_Arabian,
+	unicode.Old_Sogdian,
+	unicode.Old_South_Arabian,
+	unicode.Old_Turkic,
+	unicode.Palmyrene,
+	unicode.Phoenician,
+	unicode.Psalter_Pahlavi,
+	unicode.Samaritan,
+	unicode.Sogdian,
+	unicode.Syriac,
+	unicode.Thaana,
+	unicode.Yezidi,
+}
+
+// The explicit directional marks and isolates.
+const (
+	lrm = '\u200E' // LEFT-TO-RIGHT MARK
+	rlm = '\u200F' // RIGHT-TO-LEFT MARK
+	alm = '\u061C' // ARABIC LETTER MARK
+	lri = '\u2066' // LEFT-TO-RIGHT ISOLATE
+	rli = '\u2067' // RIGHT-TO-LEFT ISOLATE
+	fsi = '\u2068' // FIRST STRONG ISOLATE
+	pdi = '\u2069' // POP DIRECTIONAL ISOLATE
+)
+
+// DetectDirection returns the direction of the first paragraph of s,
+// determined by the Unicode Bidirectional Algorithm (UAX #9, rules P2 and P3):
+// the direction of the first strong character, ignoring the characters between isolate initiators and matching PDIs.
+// It returns TextDirectionAuto if s has no strong characters, e.g. digits and punctuation only.
+//
+// The strong characters are approximated by the tables of the unicode package:
+// the letters and the spacing marks of the right-to-left scripts, such as Arabic and Hebrew, are right-to-left,
+// and those of the other scripts are left-to-right.
+func DetectDirection(s string) TextDirection {
+	var isolates int
+	for _, r := range s {
+		switch r {
+		case '\n', '\r', '\u001C', '\u001D', '\u001E', '\u0085', '\u2029':
+			// the end of the first paragraph.
+			return TextDirectionAuto
+		case lri, rli, fsi:
+			isolates++
+			continue
+		case pdi:
+			if isolates > 0 {
+				isolates--
+			}
+			continue
+		}
+		if isolates > 0 {
+			continue
+		}
+		switch {
+		case r == lrm:
+			return TextDirectionLTR
+		case r == rlm || r == alm:
+			return TextDirectionRTL
+		case unicode.IsLetter(r) || unicode.Is(unicode.Mc, r):
+			if unicode.In(r, rtlScripts...) {
+				return TextDirectionRTL
+			}
+			return TextDirectionLTR
+		}
+	}
+	return TextDirectionAuto
+}
+
+// Mirror returns the alignment mirrored horizontally.
+// TextAlignLeft and TextAlignRight are swapped, and TextAlignCenter is kept as is.
+func (a TextAlign) Mirror() TextAlign {
+	switch a {
+	case TextAlignLeft:
+		return TextAlignRight
+	case TextAlignRight:
+		return TextAlignLeft
+	}
+	return a
+}
+
+// Mirror returns the origin mirrored horizontally, e.g. OriginTopLeft becomes OriginTopRight.
+// The center origins and OriginDefault are kept as they are.
+func (o Origin) Mirror() Origin {
+	switch o {
+	case OriginTopLeft:
+		return OriginTopRight
+	case OriginTopRight:
+		return OriginTopLeft
+	case OriginMiddleLeft:
+		return OriginMiddleRight
+	case OriginMiddleRight:
+		return OriginMiddleLeft
+	case OriginBottomLeft:
+		return OriginBottomRight
+	case OriginBottomRight:
+		return OriginBottomLeft
+	}
+	return o
+}
+
+// ResolveDirection returns a copy of t with the direction resolved.
+// If t.Direction is TextDirectionAuto, the direction is detected from t.Text by DetectDirection.
+//
+// Align and OverlayOrigin of t are regarded as the layout for left-to-right text.
+// If the resolved direction is right-to-left, they are mirrored,
+// so that right-to-left captions, such as Arabic and Hebrew, anchor to the opposite edge.
+// Offset and OffsetRatio are not changed.
+func (t *Text) ResolveDirection() *Text {
+	ret := *t
+	if ret.Direction == TextDirectionAuto {
+		ret.Direction = DetectDirection(t.Text)
+	}
+	if ret.Direction == TextDirectionRTL {
+		ret.Align = t.Align.Mirror()
+		ret.OverlayOrigin = t.OverlayOrigin.Mirror()
+	}
+	return &ret
+}
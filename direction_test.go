@@ -0,0 +1,156 @@
+package imageflux
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestDetectDirection(t *testing.T) {
+	tests := []struct {
+		input string
+		want  TextDirection
+	}{
+		{"", TextDirectionAuto},
+		{"Hello, world", TextDirectionLTR},
+		{"こんにちは", TextDirectionLTR},
+		{"שלום", TextDirectionRTL},
+		{"مرحبا", TextDirectionRTL},
+
+		// the first strong character wins.
+		{"50% خصم", TextDirectionRTL},
+		{"Sale: خصم", TextDirectionLTR},
+		{"خصم Sale", TextDirectionRTL},
+
+		// no strong characters.
+		{"1,000 - 2,000", TextDirectionAuto},
+
+		// the characters in isolates are ignored.
+		{"⁧Sale⁩ שלום", TextDirectionRTL},
+		{"⁨שלום⁩", TextDirectionAuto},
+
+		// the other right-to-left scripts.
+		{"ܫܠܡܐ", TextDirectionRTL},
+		{"ދިވެހި", TextDirectionRTL},
+
+		// the explicit marks are strong characters.
+		{"\u200f123", TextDirectionRTL},
+		{"\u200e123 שלום", TextDirectionLTR},
+
+		// the combining marks are not strong characters.
+		{"\u0301שלום", TextDirectionRTL},
+
+		// only the first paragraph is used.
+		{"123\nשלום", TextDirectionAuto},
+	}
+	for _, tt := range tests {
+		got := DetectDirection(tt.input)
+		if got != tt.want {
+			t.Errorf("DetectDirection(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestOrigin_Mirror(t *testing.T) {
+	tests := []struct {
+		input Origin
+		want  Origin
+	}{
+		{OriginDefault, OriginDefault},
+		{OriginTopLeft, OriginTopRight},
+		{OriginTopCenter, OriginTopCenter},
+		{OriginTopRight, OriginTopLeft},
+		{OriginMiddleLeft, OriginMiddleRight},
+		{OriginMiddleCenter, OriginMiddleCenter},
+		{OriginMiddleRight, OriginMiddleLeft},
+		{OriginBottomLeft, OriginBottomRight},
+		{OriginBottomCenter, OriginBottomCenter},
+		{OriginBottomRight, OriginBottomLeft},
+	}
+	for _, tt := range tests {
+		if got := tt.input.Mirror(); got != tt.want {
+			t.Errorf("%v.Mirror() = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestText_ResolveDirection(t *testing.T) {
+	tests := []struct {
+		input *Text
+		want  *Text
+	}{
+		{
+			input: &Text{
+				Align:         TextAlignLeft,
+				OverlayOrigin: OriginBottomLeft,
+				Text:          "Hello",
+			},
+			want: &Text{
+				Align:         TextAlignLeft,
+				Direction:     TextDirectionLTR,
+				OverlayOrigin: OriginBottomLeft,
+				Text:          "Hello",
+			},
+		},
+		{
+			input: &Text{
+				Align:         TextAlignLeft,
+				OverlayOrigin: OriginBottomLeft,
+				Text:          "שלום",
+			},
+			want: &Text{
+				Align:         TextAlignRight,
+				Direction:     TextDirectionRTL,
+				OverlayOrigin: OriginBottomRight,
+				Text:          "שלום",
+			},
+		},
+		{
+			// the explicit direction is respected.
+			input: &Text{
+				Align:         TextAlignCenter,
+				Direction:     TextDirectionRTL,
+				OverlayOrigin: OriginTopLeft,
+				Text:          "123",
+			},
+			want: &Text{
+				Align:         TextAlignCenter,
+				Direction:     TextDirectionRTL,
+				OverlayOrigin: OriginTopRight,
+				Text:          "123",
+			},
+		},
+		{
+			input: &Text{
+				Direction:     TextDirectionLTR,
+				OverlayOrigin: OriginTopLeft,
+				Text:          "שלום",
+			},
+			want: &Text{
+				Direction:     TextDirectionLTR,
+				OverlayOrigin: OriginTopLeft,
+				Text:          "שלום",
+			},
+		},
+		{
+			input: &Text{
+				OverlayOrigin: OriginTopLeft,
+				Text:          "123",
+			},
+			want: &Text{
+				OverlayOrigin: OriginTopLeft,
+				Text:          "123",
+			},
+		},
+	}
+	for _, tt := range tests {
+		input := *tt.input
+		got := tt.input.ResolveDirection()
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("ResolveDirection(%q) mismatch (-want +got):\n%s", tt.input.Text, diff)
+		}
+		if diff := cmp.Diff(&input, tt.input); diff != "" {
+			t.Errorf("ResolveDirection(%q) modified the input (-want +got):\n%s", tt.input.Text, diff)
+		}
+	}
+}
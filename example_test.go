@@ -88,3 +88,72 @@ func ExampleProxy_Parse_signed() {
 	// path = /images/1.jpg
 	// width = 200
 }
+
+func ExampleTokenizer() {
+	t := imageflux.NewTokenizer("/c/w=200,l=(g=tl%2Cl=/logo.png),t=hello%20world/images/1.jpg")
+	for t.Next() {
+		tok := t.Token()
+		value, err := tok.Value()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("%d-%d %s=%s\n", tok.Start, tok.End, tok.Key, value)
+	}
+	if err := t.Err(); err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(t.Rest())
+
+	// Output:
+	// 3-8 w=200
+	// 9-31 l=(g=tl,l=/logo.png)
+	// 32-47 t=hello world
+	// /images/1.jpg
+}
+
+func ExampleConfig_Explain() {
+	cfg, _, err := imageflux.ParseConfig("w=200,a=2,ic=0:0:100:100,ig=5,or=6,through=jpg:png")
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, step := range cfg.Explain() {
+		fmt.Println(step)
+	}
+
+	// Output:
+	// through: through jpg, png
+	// input clip: input clip (0, 0)-(100, 100) px, 100x100 px
+	// input clip: input origin middle-center
+	// resize: width 200 px, aspect mode crop
+	// output rotate: output rotate right-top (rotate 90 degrees left)
+	// output: format auto
+}
+
+func ExampleSocialCard_Image() {
+	proxy := &imageflux.Proxy{
+		Host: "demo.imageflux.jp",
+	}
+	card := &imageflux.SocialCard{
+		Background: "/images/photo.jpg",
+		Logo:       "/images/logo.png",
+		Title:      "Hello, world!",
+		Subtitle:   "by gopher",
+		Theme: imageflux.CardTheme{
+			TitleFont: &imageflux.Font{Name: "Ryumin R-KL"},
+		},
+	}
+	img, err := card.Image(proxy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, step := range img.Config.Explain() {
+		fmt.Println(step)
+	}
+
+	// Output:
+	// resize: width 1200 px, height 630 px, aspect mode crop
+	// overlay: overlay "/images/logo.png"
+	// text: text "Hello, world!"
+	// text: text "by gopher"
+	// output: format auto
+}
@@ -0,0 +1,359 @@
+package imageflux
+
+import (
+	"cmp"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Step is a step of the image processing, returned by Explain.
+type Step struct {
+	// Stage is the name of the processing stage, e.g. "resize".
+	Stage string
+
+	// Description is the human-readable description of the step.
+	Description string
+
+	// Params are the keys of the parameters used in the step.
+	Params []string
+
+	// Steps are the nested steps, e.g. the steps of an overlay image.
+	Steps []Step
+}
+
+// String returns the step in the form of "stage: description".
+func (s Step) String() string {
+	return s.Stage + ": " + s.Description
+}
+
+// stages are the processing stages in the order ImageFlux applies them.
+var stages = []string{
+	"through",
+	"input rotate",
+	"input clip",
+	"resize",
+	"output clip",
+	"output rotate",
+	"filter",
+	"overlay",
+	"text",
+	"font",
+	"box",
+	"layout",
+	"position",
+	"mask",
+	"output",
+	"expires",
+}
+
+// mergedStages are the stages whose parameters are described in one step.
+var mergedStages = map[string]bool{
+	"resize":   true,
+	"font":     true,
+	"box":      true,
+	"layout":   true,
+	"position": true,
+	"output":   true,
+}
+
+// Explain returns the human-readable steps of the transformation
+// in the order ImageFlux applies them:
+// through, input rotation, input clipping, resizing, output clipping, output rotation,
+// filters, overlays, texts and output encoding.
+// The expiration and the custom parameters come last.
+//
+// Each description is the name of the parameter in the table returned by Params,
+// followed by its value.
+func (c *Config) Explain() []Step {
+	if c == nil {
+		c = &Config{}
+	}
+	g := c.geometry()
+	steps := explainParams(configParams, func(def *paramDef) []Step {
+		if def.explainGeometry != nil {
+			return def.explainGeometry(&g)
+		}
+		if def.explainConfig != nil {
+			return def.explainConfig(c)
+		}
+		return nil
+	})
+	return appendExtraSteps(steps, TargetConfig, c.Extra)
+}
+
+// Explain returns the human-readable steps of processing the overlay image
+// in the order ImageFlux applies them.
+func (o *Overlay) Explain() []Step {
+	g := o.geometry()
+	p := o.position()
+	steps := explainParams(overlayParams, func(def *paramDef) []Step {
+		if def.explainGeometry != nil {
+			return def.explainGeometry(&g)
+		}
+		if def.explainPosition != nil {
+			return def.explainPosition(&p)
+		}
+		return nil
+	})
+	return appendExtraSteps(steps, TargetOverlay, o.Extra)
+}
+
+// Explain returns the human-readable steps of drawing the text.
+func (t *Text) Explain() []Step {
+	p := t.position()
+	steps := explainParams(textParams, func(def *paramDef) []Step {
+		if def.explainPosition != nil {
+			return def.explainPosition(&p)
+		}
+		if def.explainText != nil {
+			return def.explainText(t)
+		}
+		return nil
+	})
+	return appendExtraSteps(steps, TargetText, t.Extra)
+}
+
+// explainParams collects the steps of the built-in parameters params,
+// sorts them by stage, and merges the steps of the same stage in mergedStages.
+func explainParams(params []*paramDef, explain func(def *paramDef) []Step) []Step {
+	var steps []Step
+	for _, def := range params {
+		for _, step := range explain(def) {
+			step.Stage = def.stage
+			step.Params = []string{def.Key}
+			if step.Description == "" {
+				step.Description = def.Name
+			} else {
+				step.Description = def.Name + " " + step.Description
+			}
+			steps = append(steps, step)
+		}
+	}
+
+	slices.SortStableFunc(steps, func(a, b Step) int {
+		return cmp.Compare(slices.Index(stages, a.Stage), slices.Index(stages, b.Stage))
+	})
+
+	var ret []Step
+	for _, step := range steps {
+		if n := len(ret); n > 0 && ret[n-1].Stage == step.Stage && mergedStages[step.Stage] {
+			ret[n-1].Description += ", " + step.Description
+			ret[n-1].Params = append(ret[n-1].Params, step.Params...)
+			continue
+		}
+		ret = append(ret, step)
+	}
+	return ret
+}
+
+// appendExtraSteps appends the steps of the custom parameters sorted by key.
+func appendExtraSteps(steps []Step, target ParamTarget, extra map[string]string) []Step {
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		desc := key + "=" + extra[key]
+		if p, ok := LookupParam(key, target); ok && p.Name != "" {
+			desc = p.Name + " (" + desc + ")"
+		}
+		steps = append(steps, Step{
+			Stage:       "custom",
+			Description: desc,
+			Params:      []string{key},
+		})
+	}
+	return steps
+}
+
+// geometry is the geometric parameters shared by Config and Overlay.
+type geometry struct {
+	width, height   int
+	disableEnlarge  bool
+	aspectMode      AspectMode
+	inputClip       image.Rectangle
+	inputClipRatio  image.Rectangle
+	inputOrigin     Origin
+	outputClip      image.Rectangle
+	outputClipRatio image.Rectangle
+	outputOrigin    Origin
+	clipMax         image.Point
+	origin          Origin
+	background      color.Color
+	inputRotate     Rotate
+	outputRotate    Rotate
+}
+
+func (c *Config) geometry() geometry {
+	return geometry{
+		width:           c.Width,
+		height:          c.Height,
+		disableEnlarge:  c.DisableEnlarge,
+		aspectMode:      c.AspectMode,
+		inputClip:       c.InputClip,
+		inputClipRatio:  c.InputClipRatio,
+		inputOrigin:     c.InputOrigin,
+		outputClip:      clipOrAlias(c.OutputClip, c.Clip),
+		outputClipRatio: clipOrAlias(c.OutputClipRatio, c.ClipRatio),
+		outputOrigin:    c.OutputOrigin,
+		clipMax:         c.ClipMax,
+		origin:          c.Origin,
+		background:      c.Background,
+		inputRotate:     c.InputRotate,
+		outputRotate:    rotateOrAlias(c.OutputRotate, c.Rotate),
+	}
+}
+
+func (o *Overlay) geometry() geometry {
+	return geometry{
+		width:           o.Width,
+		height:          o.Height,
+		disableEnlarge:  o.DisableEnlarge,
+		aspectMode:      o.AspectMode,
+		inputClip:       o.InputClip,
+		inputClipRatio:  o.InputClipRatio,
+		inputOrigin:     o.InputOrigin,
+		outputClip:      clipOrAlias(o.OutputClip, o.Clip),
+		outputClipRatio: clipOrAlias(o.OutputClipRatio, o.ClipRatio),
+		outputOrigin:    o.OutputOrigin,
+		clipMax:         o.ClipMax,
+		origin:          o.Origin,
+		background:      o.Background,
+		inputRotate:     o.InputRotate,
+		outputRotate:    rotateOrAlias(o.OutputRotate, o.Rotate),
+	}
+}
+
+// position is the position parameters shared by Overlay and Text.
+type position struct {
+	offset      image.Point
+	offsetRatio image.Point
+	offsetMax   image.Point
+	origin      Origin
+	maskType    MaskType
+	paddingMode PaddingMode
+}
+
+func (o *Overlay) position() position {
+	return position{
+		offset:      o.Offset,
+		offsetRatio: o.OffsetRatio,
+		offsetMax:   o.OffsetMax,
+		origin:      o.OverlayOrigin,
+		maskType:    o.MaskType,
+		paddingMode: o.PaddingMode,
+	}
+}
+
+func (t *Text) position() position {
+	return position{
+		offset:      t.Offset,
+		offsetRatio: t.OffsetRatio,
+		offsetMax:   t.OffsetMax,
+		origin:      t.OverlayOrigin,
+		maskType:    t.MaskType,
+		paddingMode: t.PaddingMode,
+	}
+}
+
+// describe returns the step that describes the value of a parameter.
+// If value is empty, the name of the parameter describes the step by itself.
+func describe(value string) []Step {
+	return []Step{{Description: value}}
+}
+
+func describeFlag(b bool) []Step {
+	if !b {
+		return nil
+	}
+	return describe("")
+}
+
+func describePixels(v int) []Step {
+	if v == 0 {
+		return nil
+	}
+	return describe(strconv.Itoa(v) + " px")
+}
+
+func describeOrigin(o Origin) []Step {
+	if o == OriginDefault {
+		return nil
+	}
+	return describe(o.String())
+}
+
+func describeColor(c color.Color) []Step {
+	if c == nil {
+		return nil
+	}
+	return describe(formatColor(c))
+}
+
+func describeClip(clip image.Rectangle) []Step {
+	if clip == (image.Rectangle{}) {
+		return nil
+	}
+	return describe(fmt.Sprintf("(%d, %d)-(%d, %d) px, %dx%d px",
+		clip.Min.X, clip.Min.Y, clip.Max.X, clip.Max.Y, clip.Dx(), clip.Dy()))
+}
+
+func describeClipRatio(ratio image.Rectangle, clipMax image.Point) []Step {
+	if ratio == (image.Rectangle{}) || clipMax.X == 0 || clipMax.Y == 0 {
+		return nil
+	}
+	return describe(fmt.Sprintf("(%s, %s)-(%s, %s) of the image",
+		formatPercent(ratio.Min.X, clipMax.X), formatPercent(ratio.Min.Y, clipMax.Y),
+		formatPercent(ratio.Max.X, clipMax.X), formatPercent(ratio.Max.Y, clipMax.Y)))
+}
+
+func describeRotate(r Rotate) []Step {
+	var desc string
+	switch r {
+	case RotateDefault:
+		return nil
+	case RotateTopLeft:
+		desc = "no rotation"
+	case RotateTopRight:
+		desc = "flip horizontally"
+	case RotateBottomRight:
+		desc = "rotate 180 degrees"
+	case RotateBottomLeft:
+		desc = "flip vertically"
+	case RotateLeftTop:
+		desc = "mirror around the diagonal axis"
+	case RotateRightTop:
+		desc = "rotate 90 degrees left"
+	case RotateRightBottom:
+		desc = "rotate 180 degrees and mirror around the diagonal axis"
+	case RotateLeftBottom:
+		desc = "rotate 90 degrees right"
+	case RotateAuto:
+		desc = "rotate by the Exif orientation"
+	default:
+		return describe(r.String())
+	}
+	return describe(r.String() + " (" + desc + ")")
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
+
+// formatPercent formats v/max in percent, rounded to 2 decimal places.
+func formatPercent(v, max int) string {
+	return formatFloat(math.Round(float64(v)/float64(max)*10000)/100) + "%"
+}
+
+func formatColor(c color.Color) string {
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	if nrgba.A == 0xff {
+		return fmt.Sprintf("#%02x%02x%02x", nrgba.R, nrgba.G, nrgba.B)
+	}
+	return fmt.Sprintf("#%02x%02x%02x%02x", nrgba.R, nrgba.G, nrgba.B, nrgba.A)
+}
@@ -0,0 +1,156 @@
+package imageflux
+
+import (
+	"image"
+	"image/color"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfig_Explain(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		input string
+		want  []Step
+	}{
+		{
+			input: "",
+			want: []Step{
+				{Stage: "output", Description: "format auto", Params: []string{"f"}},
+			},
+		},
+		{
+			input: "w=200,a=2,ic=0:0:100:100,ig=5,or=6,through=jpg:png",
+			want: []Step{
+				{Stage: "through", Description: "through jpg, png", Params: []string{"through"}},
+				{Stage: "input clip", Description: "input clip (0, 0)-(100, 100) px, 100x100 px", Params: []string{"ic"}},
+				{Stage: "input clip", Description: "input origin middle-center", Params: []string{"ig"}},
+				{Stage: "resize", Description: "width 200 px, aspect mode crop", Params: []string{"w", "a"}},
+				{Stage: "output rotate", Description: "output rotate right-top (rotate 90 degrees left)", Params: []string{"or"}},
+				{Stage: "output", Description: "format auto", Params: []string{"f"}},
+			},
+		},
+		{
+			input: "ir=auto,icr=0.1:0.2:0.9:0.8,w=100,h=100,a=3,b=ffffff80,u=0,r=2,grayscale=50,f=webp,q=80,s=2,expires=2023-06-24T09:23:00Z",
+			want: []Step{
+				{Stage: "input rotate", Description: "input rotate auto (rotate by the Exif orientation)", Params: []string{"ir"}},
+				{Stage: "input clip", Description: "input clip ratio (10%, 20%)-(90%, 80%) of the image", Params: []string{"icr"}},
+				{Stage: "resize", Description: "width 100 px, height 100 px, enlarge disabled, aspect mode pad, background #ffffff80", Params: []string{"w", "h", "u", "a", "b"}},
+				{Stage: "output rotate", Description: "output rotate top-right (flip horizontally)", Params: []string{"or"}},
+				{Stage: "filter", Description: "grayscale 50%", Params: []string{"grayscale"}},
+				{Stage: "output", Description: "format webp, quality 80, exif option strip except orientation", Params: []string{"f", "q", "s"}},
+				{Stage: "expires", Description: "expires 2023-06-24T09:23:00Z", Params: []string{"expires"}},
+			},
+		},
+		{
+			input: "w=400,l=(w=100,b=000000,x=10,y=20,lg=9,mask=alpha:1/logo.png),t=(font=Ryumin%20R-KL,size=30,f=ffffff,w=400,h=80,align=1,text=hello)",
+			want: []Step{
+				{Stage: "resize", Description: "width 400 px", Params: []string{"w"}},
+				{
+					Stage:       "overlay",
+					Description: `overlay "/logo.png"`,
+					Params:      []string{"l"},
+					Steps: []Step{
+						{Stage: "resize", Description: "width 100 px, background #000000", Params: []string{"w", "b"}},
+						{Stage: "position", Description: "offset x 10 px, offset y 20 px, overlay origin bottom-right", Params: []string{"x", "y", "lg"}},
+						{Stage: "mask", Description: "mask alpha, leaving the overflow area", Params: []string{"mask"}},
+					},
+				},
+				{
+					Stage:       "text",
+					Description: `text "hello"`,
+					Params:      []string{"t"},
+					Steps: []Step{
+						{Stage: "font", Description: `font "Ryumin R-KL", size 30, foreground #ffffff`, Params: []string{"font", "size", "f"}},
+						{Stage: "box", Description: "width 400 px, height 80 px", Params: []string{"w", "h"}},
+						{Stage: "layout", Description: "align center", Params: []string{"align"}},
+					},
+				},
+				{Stage: "output", Description: "format auto", Params: []string{"f"}},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		c, _, err := ParseConfig(tt.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		got := c.Explain()
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", tt.input, diff)
+		}
+	}
+}
+
+func TestOverlay_Explain(t *testing.T) {
+	o := &Overlay{
+		Width:         100,
+		Offset:        image.Pt(10, 20),
+		OffsetRatio:   image.Pt(1, 1),
+		OffsetMax:     image.Pt(2, 4),
+		OverlayOrigin: OriginBottomRight,
+		MaskType:      MaskTypeAlpha,
+		PaddingMode:   PaddingModeLeave,
+		Background:    color.NRGBA{A: 0xff},
+	}
+	want := []Step{
+		{Stage: "resize", Description: "width 100 px, background #000000", Params: []string{"w", "b"}},
+		{Stage: "position", Description: "offset x 10 px, offset y 20 px, offset x ratio 50% of the image, offset y ratio 25% of the image, overlay origin bottom-right", Params: []string{"x", "y", "xr", "yr", "lg"}},
+		{Stage: "mask", Description: "mask alpha, leaving the overflow area", Params: []string{"mask"}},
+	}
+	if diff := cmp.Diff(want, o.Explain()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestExplain_Stages(t *testing.T) {
+	for _, def := range builtinParams {
+		if !slices.Contains(stages, def.stage) {
+			t.Errorf("%s: unknown stage %q", def.Key, def.stage)
+		}
+		if def.Name == "" {
+			t.Errorf("%s: missing name", def.Key)
+		}
+	}
+}
+
+func TestExplain_Custom(t *testing.T) {
+	err := RegisterParam(Param{
+		Key:         "explain-custom",
+		Targets:     TargetConfig,
+		Name:        "custom filter",
+		Description: "the custom filter for testing Explain.",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Config{
+		Width: 200,
+		Extra: map[string]string{
+			"explain-custom": "1",
+			"explain-other":  "2",
+		},
+	}
+	want := []Step{
+		{Stage: "resize", Description: "width 200 px", Params: []string{"w"}},
+		{Stage: "output", Description: "format auto", Params: []string{"f"}},
+		{Stage: "custom", Description: "custom filter (explain-custom=1)", Params: []string{"explain-custom"}},
+		{Stage: "custom", Description: "explain-other=2", Params: []string{"explain-other"}},
+	}
+	if diff := cmp.Diff(want, c.Explain()); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestStep_String(t *testing.T) {
+	s := Step{Stage: "resize", Description: "width 200 px"}
+	if got, want := s.String(), "resize: width 200 px"; got != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,253 @@
+package imageflux
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+)
+
+// FontCatalog is the list of the fonts available on an ImageFlux account.
+// It validates the fonts of texts before they are rendered,
+// because ImageFlux doesn't report invalid fonts but renders broken images.
+//
+// A FontCatalog can be written in JSON:
+//
+//	{
+//	  "fonts": [
+//	    {
+//	      "name": "Noto Sans JP",
+//	      "instances": ["Regular", "Bold"],
+//	      "axes": [
+//	        {"tag": "wght", "min": 100, "max": 900, "default": 400}
+//	      ]
+//	    }
+//	  ]
+//	}
+type FontCatalog struct {
+	// Fonts are the available fonts.
+	Fonts []*FontInfo `json:"fonts"`
+}
+
+// FontInfo describes an available font.
+type FontInfo struct {
+	// Name is the name of the font.
+	Name string `json:"name"`
+
+	// Instances are the names of the named instances of the variable font.
+	Instances []string `json:"instances,omitempty"`
+
+	// Axes are the axes of the variable font.
+	Axes []FontAxis `json:"axes,omitempty"`
+}
+
+// FontAxis describes an axis of a variable font.
+type FontAxis struct {
+	// Tag is the tag of the axis, e.g. "wght".
+	// It must be 4 printable ASCII characters.
+	Tag string `json:"tag"`
+
+	// Min and Max are the range of the values of the axis.
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+
+	// Default is the default value of the axis.
+	Default float64 `json:"default"`
+}
+
+// LoadFontCatalog reads the JSON file of a font catalog.
+func LoadFontCatalog(name string) (*FontCatalog, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("imageflux: failed to read the font catalog: %w", err)
+	}
+	return ParseFontCatalog(data)
+}
+
+// ParseFontCatalog parses the JSON representation of a font catalog.
+// Unknown fields are rejected so that typos in the catalog don't go unnoticed.
+func ParseFontCatalog(data []byte) (*FontCatalog, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var c FontCatalog
+	if err := dec.Decode(&c); err != nil {
+		return nil, fmt.Errorf("imageflux: failed to parse the font catalog: %w", err)
+	}
+	if err := c.check(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// check validates the catalog itself.
+func (c *FontCatalog) check() error {
+	var errs []error
+	names := make(map[string]struct{}, len(c.Fonts))
+	for i, info := range c.Fonts {
+		if info == nil || info.Name == "" {
+			errs = append(errs, fmt.Errorf("imageflux: font %d of the catalog has no name", i))
+			continue
+		}
+		if _, ok := names[info.Name]; ok {
+			errs = append(errs, fmt.Errorf("imageflux: font %q is duplicated in the catalog", info.Name))
+		}
+		names[info.Name] = struct{}{}
+
+		tags := make(map[string]struct{}, len(info.Axes))
+		for _, axis := range info.Axes {
+			if !validFontTag(axis.Tag) {
+				errs = append(errs, fmt.Errorf("imageflux: font %q: invalid axis tag %q", info.Name, axis.Tag))
+			}
+			if _, ok := tags[axis.Tag]; ok {
+				errs = append(errs, fmt.Errorf("imageflux: font %q: axis %q is duplicated", info.Name, axis.Tag))
+			}
+			tags[axis.Tag] = struct{}{}
+			if !(axis.Min <= axis.Default && axis.Default <= axis.Max) {
+				errs = append(errs, fmt.Errorf("imageflux: font %q: axis %q must satisfy min <= default <= max, but got %g, %g, %g",
+					info.Name, axis.Tag, axis.Min, axis.Default, axis.Max))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// validFontTag reports whether tag is a valid OpenType tag: 4 printable ASCII characters.
+func validFontTag(tag string) bool {
+	if len(tag) != 4 {
+		return false
+	}
+	for i := 0; i < len(tag); i++ {
+		if tag[i] < 0x20 || tag[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// Lookup returns the font named name.
+func (c *FontCatalog) Lookup(name string) (*FontInfo, bool) {
+	for _, info := range c.Fonts {
+		if info != nil && info.Name == name {
+			return info, true
+		}
+	}
+	return nil, false
+}
+
+// Axis returns the axis tagged tag.
+func (info *FontInfo) Axis(tag string) (FontAxis, bool) {
+	for _, axis := range info.Axes {
+		if axis.Tag == tag {
+			return axis, true
+		}
+	}
+	return FontAxis{}, false
+}
+
+// Validate reports whether f is available in the catalog.
+// It returns an error if the font is unknown, the instance is unknown,
+// a tag of the variables is invalid or unknown, or a value of the variables is out of the range of the axis.
+// All problems are reported at once.
+func (c *FontCatalog) Validate(f *Font) error {
+	_, errs := c.resolve(f, false)
+	return joinErrors("imageflux: ", errs)
+}
+
+// Clamp returns a copy of f whose values of the variables are clamped into the ranges of the axes.
+// The other problems, which can't be fixed, are reported as Validate does.
+func (c *FontCatalog) Clamp(f *Font) (*Font, error) {
+	ret, errs := c.resolve(f, true)
+	if len(errs) > 0 {
+		return nil, joinErrors("imageflux: ", errs)
+	}
+	return ret, nil
+}
+
+// ValidateConfig validates the fonts of all the texts in cfg.
+// The nil entries of cfg.Texts are skipped.
+func (c *FontCatalog) ValidateConfig(cfg *Config) error {
+	if cfg == nil {
+		return nil
+	}
+	var errs []error
+	for i, t := range cfg.Texts {
+		if t == nil {
+			continue
+		}
+		_, textErrs := c.resolve(t.Font, false)
+		if err := joinErrors(fmt.Sprintf("imageflux: text %d: ", i), textErrs); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// resolve returns the copy of f, or the problems of f without the prefix of the errors.
+func (c *FontCatalog) resolve(f *Font, clamp bool) (*Font, []error) {
+	if f == nil {
+		return nil, []error{errors.New("font is not specified")}
+	}
+	info, ok := c.Lookup(f.Name)
+	if !ok {
+		return nil, []error{fmt.Errorf("unknown font %q", f.Name)}
+	}
+
+	ret := *f
+	var errs []error
+	if f.Instance != "" && !slices.Contains(info.Instances, f.Instance) {
+		errs = append(errs, fmt.Errorf("font %q has no instance %q", f.Name, f.Instance))
+	}
+	if len(f.Variables) > 0 {
+		ret.Variables = make(map[string]float64, len(f.Variables))
+	}
+	tags := make([]string, 0, len(f.Variables))
+	for tag := range f.Variables {
+		tags = append(tags, tag)
+	}
+	slices.Sort(tags)
+	for _, tag := range tags {
+		v := f.Variables[tag]
+		ret.Variables[tag] = v
+		if !validFontTag(tag) {
+			errs = append(errs, fmt.Errorf("invalid axis tag %q: it must be 4 characters", tag))
+			continue
+		}
+		axis, ok := info.Axis(tag)
+		if !ok {
+			errs = append(errs, fmt.Errorf("font %q has no axis %q", f.Name, tag))
+			continue
+		}
+		if math.IsNaN(v) {
+			errs = append(errs, fmt.Errorf("invalid value of axis %q: %g", tag, v))
+			continue
+		}
+		if v >= axis.Min && v <= axis.Max {
+			continue
+		}
+		if clamp {
+			ret.Variables[tag] = min(max(v, axis.Min), axis.Max)
+			continue
+		}
+		errs = append(errs, fmt.Errorf("axis %q of font %q must be between %g and %g, but got %g", tag, f.Name, axis.Min, axis.Max, v))
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &ret, nil
+}
+
+// joinErrors joins errs into one error, prefixing each error with prefix.
+// It returns nil if errs is empty.
+func joinErrors(prefix string, errs []error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	prefixed := make([]error, 0, len(errs))
+	for _, err := range errs {
+		prefixed = append(prefixed, fmt.Errorf("%s%w", prefix, err))
+	}
+	return errors.Join(prefixed...)
+}
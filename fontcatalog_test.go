@@ -0,0 +1,163 @@
+package imageflux
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func loadTestFontCatalog(t *testing.T) *FontCatalog {
+	t.Helper()
+	c, err := LoadFontCatalog("testdata/fonts.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestLoadFontCatalog(t *testing.T) {
+	c := loadTestFontCatalog(t)
+	info, ok := c.Lookup("Noto Sans JP")
+	if !ok {
+		t.Fatal("Noto Sans JP is not found")
+	}
+	want := &FontInfo{
+		Name:      "Noto Sans JP",
+		Instances: []string{"Regular", "Bold"},
+		Axes: []FontAxis{
+			{Tag: "wght", Min: 100, Max: 900, Default: 400},
+		},
+	}
+	if diff := cmp.Diff(want, info); diff != "" {
+		t.Errorf("Lookup() mismatch (-want +got):\n%s", diff)
+	}
+	if _, ok := c.Lookup("Unknown"); ok {
+		t.Error("Unknown is found")
+	}
+
+	if _, err := LoadFontCatalog("testdata/not-found.json"); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestParseFontCatalog_error(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{`{"fonts": [`, "failed to parse"},
+		{`{"fonts": [{"name": "A", "weight": 400}]}`, "unknown field"},
+		{`{"fonts": [{}]}`, "has no name"},
+		{`{"fonts": [{"name": "A"}, {"name": "A"}]}`, "duplicated"},
+		{`{"fonts": [{"name": "A", "axes": [{"tag": "weight", "min": 100, "max": 900, "default": 400}]}]}`, "invalid axis tag"},
+		{`{"fonts": [{"name": "A", "axes": [{"tag": "wght", "min": 900, "max": 100, "default": 400}]}]}`, "min <= default <= max"},
+		{`{"fonts": [{"name": "A", "axes": [{"tag": "wght", "min": 100, "max": 900}, {"tag": "wght", "min": 100, "max": 900}]}]}`, "duplicated"},
+	}
+	for _, tt := range tests {
+		_, err := ParseFontCatalog([]byte(tt.input))
+		if err == nil {
+			t.Errorf("ParseFontCatalog(%s): want error, got nil", tt.input)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseFontCatalog(%s): want error containing %q, got %v", tt.input, tt.want, err)
+		}
+	}
+}
+
+func TestFontCatalog_Validate(t *testing.T) {
+	c := loadTestFontCatalog(t)
+	tests := []struct {
+		font *Font
+		want string // empty if the font is valid
+	}{
+		{&Font{Name: "Ryumin R-KL"}, ""},
+		{&Font{Name: "Noto Sans JP", Instance: "Bold"}, ""},
+		{&Font{Name: "Noto Sans JP", Variables: map[string]float64{"wght": 100}}, ""},
+		{&Font{Name: "Noto Sans JP", Variables: map[string]float64{"wght": 900}}, ""},
+		{&Font{Name: "Roboto Flex", Variables: map[string]float64{"wght": 1000, "slnt": -10}}, ""},
+		{nil, "font is not specified"},
+		{&Font{Name: "Unknown"}, `unknown font "Unknown"`},
+		{&Font{Name: "Noto Sans JP", Instance: "Black"}, `has no instance "Black"`},
+		{&Font{Name: "Noto Sans JP", Variables: map[string]float64{"wght": 1000}}, "must be between 100 and 900, but got 1000"},
+		{&Font{Name: "Noto Sans JP", Variables: map[string]float64{"wght": 50}}, "must be between 100 and 900, but got 50"},
+		{&Font{Name: "Noto Sans JP", Variables: map[string]float64{"weight": 400}}, `invalid axis tag "weight"`},
+		{&Font{Name: "Noto Sans JP", Variables: map[string]float64{"wdth": 100}}, `has no axis "wdth"`},
+		{&Font{Name: "Ryumin R-KL", Variables: map[string]float64{"wght": 400}}, `has no axis "wght"`},
+	}
+	for _, tt := range tests {
+		err := c.Validate(tt.font)
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("Validate(%s): unexpected error: %v", tt.font, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("Validate(%s): want error, got nil", tt.font)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Validate(%s): want error containing %q, got %v", tt.font, tt.want, err)
+		}
+	}
+}
+
+func TestFontCatalog_Clamp(t *testing.T) {
+	c := loadTestFontCatalog(t)
+	font := &Font{
+		Name: "Roboto Flex",
+		Variables: map[string]float64{
+			"wght": 1200,
+			"wdth": 10,
+			"slnt": -5,
+		},
+	}
+	got, err := c.Clamp(font)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Font{
+		Name: "Roboto Flex",
+		Variables: map[string]float64{
+			"wght": 1000,
+			"wdth": 25,
+			"slnt": -5,
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Clamp() mismatch (-want +got):\n%s", diff)
+	}
+	if font.Variables["wght"] != 1200 {
+		t.Error("Clamp() modified the input")
+	}
+
+	// unknown axes can't be clamped.
+	if _, err := c.Clamp(&Font{Name: "Roboto Flex", Variables: map[string]float64{"opsz": 12}}); err == nil {
+		t.Error("want error, got nil")
+	}
+}
+
+func TestFontCatalog_ValidateConfig(t *testing.T) {
+	c := loadTestFontCatalog(t)
+	cfg := &Config{
+		Texts: []*Text{
+			{Font: &Font{Name: "Ryumin R-KL"}},
+			nil,
+			{Font: &Font{Name: "Unknown"}},
+		},
+	}
+	err := c.ValidateConfig(cfg)
+	if err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if want := `imageflux: text 2: unknown font "Unknown"`; err.Error() != want {
+		t.Errorf("want error %q, got %v", want, err)
+	}
+
+	cfg.Texts = cfg.Texts[:2]
+	if err := c.ValidateConfig(cfg); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
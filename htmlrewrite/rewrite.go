@@ -0,0 +1,458 @@
+// Package htmlrewrite rewrites the URLs of images in HTML documents into ImageFlux URLs.
+//
+// The rewriter scans through the document, and rewrites the URLs in
+// the src and srcset attributes of <img> and <source> elements,
+// and url() in the inline style attributes, e.g. style="background-image:url(...)".
+// The other parts of the document are written as they are.
+package htmlrewrite
+
+import (
+	"fmt"
+	"html"
+	"io"
+	"net/url"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/shogo82148/go-imageflux"
+)
+
+// DefaultPresetAttr is the default attribute that chooses the preset.
+const DefaultPresetAttr = "data-imageflux-preset"
+
+// DefaultClassPrefix is the default prefix of the CSS classes that choose the preset.
+const DefaultClassPrefix = "imageflux-"
+
+// Rewriter rewrites the URLs of images in HTML documents.
+type Rewriter struct {
+	// Proxy is the ImageFlux proxy.
+	// The URLs are signed if it has a signing secret.
+	Proxy *imageflux.Proxy
+
+	// OriginHosts are the hosts of the origin servers, e.g. "cms.example.com".
+	// Only the URLs of these hosts are rewritten.
+	// The path of the origin URL is used as the path of the ImageFlux URL as it is.
+	OriginHosts []string
+
+	// Presets are the configs of the images keyed by the preset names.
+	Presets map[string]*imageflux.Config
+
+	// DefaultPreset is the name of the preset used when the element doesn't choose any preset.
+	// If it is empty, the URLs are rewritten with an empty config.
+	DefaultPreset string
+
+	// PresetAttr is the attribute that chooses the preset, e.g. data-imageflux-preset="thumbnail".
+	// If it is empty, DefaultPresetAttr is used.
+	PresetAttr string
+
+	// ClassPrefix is the prefix of the CSS classes that choose the preset,
+	// e.g. class="imageflux-thumbnail".
+	// If it is empty, DefaultClassPrefix is used.
+	ClassPrefix string
+
+	// Widths are the widths of the images in the srcset attribute added to <img> elements.
+	// If it is empty, srcset attributes are not added.
+	// The existing srcset attributes are rewritten but not replaced.
+	Widths []int
+
+	// Sizes is the sizes attribute added to <img> elements with the added srcset attribute.
+	Sizes string
+
+	// SetDimensions adds the width and height attributes to <img> elements
+	// from the preset if they are missing.
+	// The height is added only if the preset fixes both the width and the height,
+	// i.e. the aspect mode is force-scale, crop or pad.
+	SetDimensions bool
+}
+
+// Rewrite reads the HTML document from r, and writes the rewritten document to w.
+// It returns an error if an element chooses an unknown preset.
+func (rw *Rewriter) Rewrite(w io.Writer, r io.Reader) error {
+	buf, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	z := newTokenizer(buf)
+
+	// picturePreset is the preset chosen by the enclosing <picture> element.
+	var picturePreset string
+	for {
+		tok, ok := z.next()
+		if !ok {
+			return nil
+		}
+		raw := tok.raw
+		switch tok.typ {
+		case endTagToken:
+			if tok.name == "picture" {
+				picturePreset = ""
+			}
+		case startTagToken:
+			if tok.name == "picture" {
+				picturePreset = rw.presetName(&tok)
+			}
+			orig := slices.Clone(tok.attrs)
+			changed, err := rw.rewriteTag(&tok, picturePreset)
+			if err != nil {
+				return err
+			}
+			if changed {
+				raw = spliceAttrs(raw, tok.spans, orig, tok.attrs)
+			}
+		}
+		if _, err := w.Write(raw); err != nil {
+			return err
+		}
+	}
+}
+
+// RewriteString rewrites the HTML document s.
+func (rw *Rewriter) RewriteString(s string) (string, error) {
+	var buf strings.Builder
+	if err := rw.Rewrite(&buf, strings.NewReader(s)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// rewriteTag rewrites the attributes of the start tag, and reports whether they are changed.
+func (rw *Rewriter) rewriteTag(tok *token, picturePreset string) (bool, error) {
+	name := rw.presetName(tok)
+	if name == "" {
+		name = picturePreset
+	}
+	if name == "" {
+		name = rw.DefaultPreset
+	}
+	resolve := func() (*imageflux.Config, error) {
+		if name == "" {
+			return &imageflux.Config{}, nil
+		}
+		cfg, ok := rw.Presets[name]
+		if !ok {
+			return nil, fmt.Errorf("htmlrewrite: unknown preset %q in <%s>", name, tok.name)
+		}
+		return cfg, nil
+	}
+
+	var changed bool
+	var hasSrcset, hasWidth, hasHeight, hasSizes bool
+	var src string
+	for i := range tok.attrs {
+		attr := &tok.attrs[i]
+		switch attr.Key {
+		case "width":
+			hasWidth = true
+		case "height":
+			hasHeight = true
+		case "sizes":
+			hasSizes = true
+		}
+
+		var rewritten string
+		var ok bool
+		var err error
+		switch {
+		case attr.Key == "src" && (tok.name == "img" || tok.name == "source"):
+			rewritten, ok, err = rw.rewriteURL(attr.Val, resolve)
+			if ok {
+				src = attr.Val
+			}
+		case attr.Key == "srcset" && (tok.name == "img" || tok.name == "source"):
+			hasSrcset = true
+			rewritten, ok, err = rw.rewriteSrcset(attr.Val, resolve)
+		case attr.Key == "style":
+			rewritten, ok, err = rw.rewriteStyle(attr.Val, resolve)
+		}
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			attr.Val = rewritten
+			changed = true
+		}
+	}
+	if tok.name != "img" || src == "" {
+		return changed, nil
+	}
+
+	// add srcset, sizes, width and height to <img> elements.
+	cfg, err := resolve()
+	if err != nil {
+		return false, err
+	}
+	if !hasSrcset && len(rw.Widths) > 0 {
+		srcset, err := rw.srcset(src, cfg)
+		if err != nil {
+			return false, err
+		}
+		tok.attrs = append(tok.attrs, attribute{Key: "srcset", Val: srcset})
+		if rw.Sizes != "" && !hasSizes {
+			tok.attrs = append(tok.attrs, attribute{Key: "sizes", Val: rw.Sizes})
+		}
+	}
+	if rw.SetDimensions {
+		if !hasWidth && cfg.Width > 0 {
+			tok.attrs = append(tok.attrs, attribute{Key: "width", Val: strconv.Itoa(cfg.Width)})
+		}
+		if !hasHeight && fixesSize(cfg) {
+			tok.attrs = append(tok.attrs, attribute{Key: "height", Val: strconv.Itoa(cfg.Height)})
+		}
+	}
+	return true, nil
+}
+
+// fixesSize reports whether the size of the images transformed by cfg is always cfg.Width x cfg.Height.
+func fixesSize(cfg *imageflux.Config) bool {
+	if cfg.Width <= 0 || cfg.Height <= 0 {
+		return false
+	}
+	switch cfg.AspectMode {
+	case imageflux.AspectModeForceScale, imageflux.AspectModeCrop, imageflux.AspectModePad:
+		return true
+	}
+	return false
+}
+
+// spliceAttrs replaces the values of the changed attributes in the raw start tag,
+// and inserts the added attributes before the end of the tag.
+// spans are the positions of orig in raw, and attrs are the rewritten attributes.
+// The other parts of the tag, such as the quotes and the whitespaces, are kept as they are.
+func spliceAttrs(raw []byte, spans []attrSpan, orig, attrs []attribute) []byte {
+	ret := make([]byte, 0, len(raw)+256)
+	pos := 0
+	for i, span := range spans {
+		if attrs[i].Val == orig[i].Val {
+			continue
+		}
+		val := html.EscapeString(attrs[i].Val)
+		switch {
+		case span.quoted:
+			ret = append(ret, raw[pos:span.valStart]...)
+			ret = append(ret, val...)
+		case span.hasValue:
+			ret = append(ret, raw[pos:span.valStart]...)
+			ret = append(ret, '"')
+			ret = append(ret, val...)
+			ret = append(ret, '"')
+		default:
+			ret = append(ret, raw[pos:span.keyEnd]...)
+			ret = append(ret, `="`...)
+			ret = append(ret, val...)
+			ret = append(ret, '"')
+		}
+		pos = span.valEnd
+	}
+
+	// insert the added attributes before "/>" or ">".
+	end := len(raw) - 1
+	if end > pos && raw[end-1] == '/' {
+		end--
+	}
+	ret = append(ret, raw[pos:end]...)
+	for _, attr := range attrs[len(orig):] {
+		ret = append(ret, ' ')
+		ret = append(ret, attr.Key...)
+		ret = append(ret, `="`...)
+		ret = append(ret, html.EscapeString(attr.Val)...)
+		ret = append(ret, '"')
+	}
+	ret = append(ret, raw[end:]...)
+	return ret
+}
+
+// presetName returns the name of the preset chosen by the attributes of tok.
+// The attribute takes precedence over the CSS classes.
+func (rw *Rewriter) presetName(tok *token) string {
+	attrName := rw.PresetAttr
+	if attrName == "" {
+		attrName = DefaultPresetAttr
+	}
+	prefix := rw.ClassPrefix
+	if prefix == "" {
+		prefix = DefaultClassPrefix
+	}
+
+	var fromClass string
+	for _, attr := range tok.attrs {
+		switch attr.Key {
+		case attrName:
+			return attr.Val
+		case "class":
+			for _, class := range strings.Fields(attr.Val) {
+				if name, ok := strings.CutPrefix(class, prefix); ok && name != "" && fromClass == "" {
+					fromClass = name
+				}
+			}
+		}
+	}
+	return fromClass
+}
+
+// imagePath returns the path of the image on ImageFlux if rawURL is an URL of the origin servers.
+func (rw *Rewriter) imagePath(rawURL string) (string, bool) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", false
+	}
+	if u.Scheme != "" && u.Scheme != "http" && u.Scheme != "https" {
+		return "", false
+	}
+	if !slices.Contains(rw.OriginHosts, u.Host) {
+		return "", false
+	}
+	// the query and the fragment can't be passed through ImageFlux.
+	if u.RawQuery != "" || u.Fragment != "" {
+		return "", false
+	}
+	return u.EscapedPath(), true
+}
+
+func (rw *Rewriter) rewriteURL(rawURL string, resolve func() (*imageflux.Config, error)) (string, bool, error) {
+	path, ok := rw.imagePath(rawURL)
+	if !ok {
+		return "", false, nil
+	}
+	cfg, err := resolve()
+	if err != nil {
+		return "", false, err
+	}
+	return rw.Proxy.Image(path, cfg).SignedURL(), true, nil
+}
+
+// srcset returns the srcset attribute of the image at src for each width of rw.Widths.
+// If cfg has both the width and the height, the height is scaled to keep the aspect ratio.
+func (rw *Rewriter) srcset(src string, cfg *imageflux.Config) (string, error) {
+	path, _ := rw.imagePath(src)
+	candidates := make([]string, 0, len(rw.Widths))
+	for _, width := range rw.Widths {
+		if width <= 0 {
+			return "", fmt.Errorf("htmlrewrite: the width of srcset must be positive, but got %d", width)
+		}
+		c := *cfg
+		if c.Width > 0 && c.Height > 0 {
+			c.Height = max(c.Height*width/c.Width, 1)
+		}
+		c.Width = width
+		candidates = append(candidates, rw.Proxy.Image(path, &c).SignedURL()+" "+strconv.Itoa(width)+"w")
+	}
+	return strings.Join(candidates, ", "), nil
+}
+
+// rewriteSrcset rewrites the URLs in the srcset attribute, keeping the descriptors.
+func (rw *Rewriter) rewriteSrcset(srcset string, resolve func() (*imageflux.Config, error)) (string, bool, error) {
+	candidates := parseSrcset(srcset)
+	var changed bool
+	for i, c := range candidates {
+		rewritten, ok, err := rw.rewriteURL(c.url, resolve)
+		if err != nil {
+			return "", false, err
+		}
+		if ok {
+			candidates[i].url = rewritten
+			changed = true
+		}
+	}
+	if !changed {
+		return "", false, nil
+	}
+
+	list := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if c.descriptor == "" {
+			list = append(list, c.url)
+		} else {
+			list = append(list, c.url+" "+c.descriptor)
+		}
+	}
+	return strings.Join(list, ", "), true, nil
+}
+
+type srcsetCandidate struct {
+	url        string
+	descriptor string
+}
+
+// parseSrcset parses the srcset attribute.
+// It follows the parsing algorithm of the HTML standard,
+// so the URLs can contain commas, e.g. ImageFlux URLs.
+func parseSrcset(s string) []srcsetCandidate {
+	var candidates []srcsetCandidate
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\f' || c == '\r'
+	}
+	i := 0
+	for {
+		// skip the whitespaces and the commas.
+		for i < len(s) && (isSpace(s[i]) || s[i] == ',') {
+			i++
+		}
+		if i >= len(s) {
+			return candidates
+		}
+
+		// collect the URL.
+		start := i
+		for i < len(s) && !isSpace(s[i]) {
+			i++
+		}
+		u := s[start:i]
+		if strings.HasSuffix(u, ",") {
+			candidates = append(candidates, srcsetCandidate{url: strings.TrimRight(u, ",")})
+			continue
+		}
+
+		// collect the descriptors until the comma outside of parentheses.
+		start = i
+		var inParens bool
+	DESCRIPTORS:
+		for ; i < len(s); i++ {
+			switch s[i] {
+			case '(':
+				inParens = true
+			case ')':
+				inParens = false
+			case ',':
+				if !inParens {
+					break DESCRIPTORS
+				}
+			}
+		}
+		candidates = append(candidates, srcsetCandidate{
+			url:        u,
+			descriptor: strings.TrimSpace(s[start:i]),
+		})
+	}
+}
+
+// styleURLPattern matches url() in CSS.
+var styleURLPattern = regexp.MustCompile(`url\(\s*(?:"([^"]*)"|'([^']*)'|([^"'()\s]*))\s*\)`)
+
+// rewriteStyle rewrites the URLs of url() in the inline style.
+func (rw *Rewriter) rewriteStyle(style string, resolve func() (*imageflux.Config, error)) (string, bool, error) {
+	var changed bool
+	var err error
+	ret := styleURLPattern.ReplaceAllStringFunc(style, func(m string) string {
+		if err != nil {
+			return m
+		}
+		sub := styleURLPattern.FindStringSubmatch(m)
+		rawURL := sub[1] + sub[2] + sub[3]
+		rewritten, ok, e := rw.rewriteURL(rawURL, resolve)
+		if e != nil {
+			err = e
+			return m
+		}
+		if !ok {
+			return m
+		}
+		changed = true
+		return `url("` + rewritten + `")`
+	})
+	if err != nil {
+		return "", false, err
+	}
+	return ret, changed, nil
+}
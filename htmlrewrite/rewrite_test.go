@@ -0,0 +1,169 @@
+package htmlrewrite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/shogo82148/go-imageflux"
+)
+
+func newTestRewriter() *Rewriter {
+	return &Rewriter{
+		Proxy:       &imageflux.Proxy{Host: "demo.imageflux.jp"},
+		OriginHosts: []string{"cms.example.com"},
+		Presets: map[string]*imageflux.Config{
+			"thumb": {Width: 200, Height: 100},
+			"hero":  {Width: 1200},
+			"card":  {Width: 300, Height: 200, AspectMode: imageflux.AspectModeCrop},
+		},
+	}
+}
+
+func TestRewriter_Rewrite(t *testing.T) {
+	tests := []struct {
+		name  string
+		setup func(rw *Rewriter)
+		input string
+		want  string
+	}{
+		{
+			name:  "img",
+			input: `<p class=x>Hello &amp; <img class="a imageflux-thumb" src="https://cms.example.com/a.jpg" alt="A"></p>`,
+			want:  `<p class=x>Hello &amp; <img class="a imageflux-thumb" src="https://demo.imageflux.jp/c/w=200%2Ch=100/a.jpg" alt="A"></p>`,
+		},
+		{
+			name:  "data attribute",
+			input: `<img data-imageflux-preset="hero" class="imageflux-thumb" src="https://cms.example.com/a.jpg">`,
+			want:  `<img data-imageflux-preset="hero" class="imageflux-thumb" src="https://demo.imageflux.jp/c/w=1200/a.jpg">`,
+		},
+		{
+			name:  "default preset",
+			setup: func(rw *Rewriter) { rw.DefaultPreset = "thumb" },
+			input: `<img src="http://cms.example.com/a.jpg">`,
+			want:  `<img src="https://demo.imageflux.jp/c/w=200%2Ch=100/a.jpg">`,
+		},
+		{
+			name:  "no preset",
+			input: `<img src="//cms.example.com/a.jpg"/>`,
+			want:  `<img src="https://demo.imageflux.jp/c/f=auto/a.jpg"/>`,
+		},
+		{
+			name:  "picture",
+			input: `<picture data-imageflux-preset="hero"><source srcset="https://cms.example.com/b.webp 1x, https://cms.example.com/b@2x.webp 2x"><img src="https://cms.example.com/b.jpg"></picture><img src="https://cms.example.com/c.jpg">`,
+			want:  `<picture data-imageflux-preset="hero"><source srcset="https://demo.imageflux.jp/c/w=1200/b.webp 1x, https://demo.imageflux.jp/c/w=1200/b@2x.webp 2x"><img src="https://demo.imageflux.jp/c/w=1200/b.jpg"></picture><img src="https://demo.imageflux.jp/c/f=auto/c.jpg">`,
+		},
+		{
+			name:  "style",
+			input: `<div class="imageflux-hero" style="color: red; background-image: url('https://cms.example.com/bg.jpg')">text</div>`,
+			want:  `<div class="imageflux-hero" style="color: red; background-image: url(&#34;https://demo.imageflux.jp/c/w=1200/bg.jpg&#34;)">text</div>`,
+		},
+		{
+			name:  "other hosts",
+			input: `<img src="https://other.example.com/c.jpg"><img src="https://cms.example.com/c.jpg?v=1"><a href="https://cms.example.com/a.jpg">link</a>`,
+			want:  `<img src="https://other.example.com/c.jpg"><img src="https://cms.example.com/c.jpg?v=1"><a href="https://cms.example.com/a.jpg">link</a>`,
+		},
+		{
+			name:  "script",
+			input: `<script>var s = '<img src="https://cms.example.com/a.jpg">';</script>`,
+			want:  `<script>var s = '<img src="https://cms.example.com/a.jpg">';</script>`,
+		},
+		{
+			name:  "comments and upper case",
+			input: `<!-- <img src="https://cms.example.com/a.jpg"> --><IMG SRC='https://cms.example.com/a.jpg'>`,
+			want:  `<!-- <img src="https://cms.example.com/a.jpg"> --><IMG SRC='https://demo.imageflux.jp/c/f=auto/a.jpg'>`,
+		},
+		{
+			name: "srcset, sizes and dimensions",
+			setup: func(rw *Rewriter) {
+				rw.Widths = []int{400, 800}
+				rw.Sizes = "100vw"
+				rw.SetDimensions = true
+			},
+			input: `<img class="imageflux-thumb" src="https://cms.example.com/a.jpg"><img class="imageflux-hero" src="https://cms.example.com/b.jpg" width="600" srcset="https://cms.example.com/b.jpg 1x">`,
+			want:  `<img class="imageflux-thumb" src="https://demo.imageflux.jp/c/w=200%2Ch=100/a.jpg" srcset="https://demo.imageflux.jp/c/w=400%2Ch=200/a.jpg 400w, https://demo.imageflux.jp/c/w=800%2Ch=400/a.jpg 800w" sizes="100vw" width="200"><img class="imageflux-hero" src="https://demo.imageflux.jp/c/w=1200/b.jpg" width="600" srcset="https://demo.imageflux.jp/c/w=1200/b.jpg 1x">`,
+		},
+		{
+			name:  "fixed size",
+			setup: func(rw *Rewriter) { rw.SetDimensions = true },
+			input: `<img class="imageflux-card" src="https://cms.example.com/a.jpg" /><img class="imageflux-card" src="https://cms.example.com/b.jpg" height="100">`,
+			want:  `<img class="imageflux-card" src="https://demo.imageflux.jp/c/w=300%2Ch=200%2Ca=2/a.jpg"  width="300" height="200"/><img class="imageflux-card" src="https://demo.imageflux.jp/c/w=300%2Ch=200%2Ca=2/b.jpg" height="100" width="300">`,
+		},
+		{
+			name:  "raw attributes",
+			input: `<IMG  SRC='https://cms.example.com/a.jpg' data-x=1 alt=foo ><img src=https://cms.example.com/b.jpg alt="B &amp; C">`,
+			want:  `<IMG  SRC='https://demo.imageflux.jp/c/f=auto/a.jpg' data-x=1 alt=foo ><img src="https://demo.imageflux.jp/c/f=auto/b.jpg" alt="B &amp; C">`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := newTestRewriter()
+			if tt.setup != nil {
+				tt.setup(rw)
+			}
+			got, err := rw.RewriteString(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("want %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestRewriter_Rewrite_signed(t *testing.T) {
+	rw := newTestRewriter()
+	rw.Proxy = &imageflux.Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	got, err := rw.RewriteString(`<img src="https://cms.example.com/images/1.jpg" class="imageflux-thumb">`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `<img src="` + rw.Proxy.Image("/images/1.jpg", rw.Presets["thumb"]).SignedURL() + `" class="imageflux-thumb">`
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestRewriter_Rewrite_unknownPreset(t *testing.T) {
+	rw := newTestRewriter()
+	_, err := rw.RewriteString(`<img src="https://cms.example.com/a.jpg" data-imageflux-preset="unknown">`)
+	if err == nil || !strings.Contains(err.Error(), `unknown preset "unknown"`) {
+		t.Errorf("want error for the unknown preset, got %v", err)
+	}
+
+	// the unknown preset is not an error if there are no URLs to rewrite.
+	if _, err := rw.RewriteString(`<img src="https://other.example.com/a.jpg" data-imageflux-preset="unknown">`); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []srcsetCandidate
+	}{
+		{"", nil},
+		{"a.jpg", []srcsetCandidate{{url: "a.jpg"}}},
+		{"a.jpg 1x, b.jpg 2x", []srcsetCandidate{{"a.jpg", "1x"}, {"b.jpg", "2x"}}},
+		{"a.jpg, b.jpg 200w", []srcsetCandidate{{url: "a.jpg"}, {"b.jpg", "200w"}}},
+		{"a.jpg,, b.jpg", []srcsetCandidate{{url: "a.jpg"}, {url: "b.jpg"}}},
+		{
+			"https://demo.imageflux.jp/c/w=200,h=100/a.jpg 200w,https://demo.imageflux.jp/c/w=400,h=200/a.jpg 400w",
+			[]srcsetCandidate{
+				{"https://demo.imageflux.jp/c/w=200,h=100/a.jpg", "200w"},
+				{"https://demo.imageflux.jp/c/w=400,h=200/a.jpg", "400w"},
+			},
+		},
+		{"  a.jpg   100w  ,  ", []srcsetCandidate{{"a.jpg", "100w"}}},
+	}
+	for _, tt := range tests {
+		got := parseSrcset(tt.input)
+		if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(srcsetCandidate{})); diff != "" {
+			t.Errorf("parseSrcset(%q) mismatch (-want +got):\n%s", tt.input, diff)
+		}
+	}
+}
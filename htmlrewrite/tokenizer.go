@@ -0,0 +1,317 @@
+package htmlrewrite
+
+import (
+	"bytes"
+	"html"
+)
+
+// tokenType is the type of a token.
+type tokenType int
+
+const (
+	// textToken is a text, a comment, a doctype or any other part that is not a tag.
+	textToken tokenType = iota
+
+	// startTagToken is a start tag, e.g. <img src="...">, including self-closing tags.
+	startTagToken
+
+	// endTagToken is an end tag, e.g. </picture>.
+	endTagToken
+)
+
+// attribute is an attribute of a start tag.
+type attribute struct {
+	// Key is the lower-cased name of the attribute.
+	Key string
+
+	// Val is the unescaped value of the attribute.
+	Val string
+}
+
+// token is a part of an HTML document.
+type token struct {
+	typ tokenType
+
+	// raw is the token as it appears in the document.
+	raw []byte
+
+	// name is the lower-cased tag name of the start and end tags.
+	name string
+
+	// attrs are the attributes of the start tag.
+	attrs []attribute
+
+	// spans are the positions of attrs in raw.
+	spans []attrSpan
+}
+
+// rawTextElements are the elements whose contents are not parsed as tags.
+var rawTextElements = map[string]bool{
+	"iframe":    true,
+	"noembed":   true,
+	"noframes":  true,
+	"noscript":  true,
+	"plaintext": true,
+	"script":    true,
+	"style":     true,
+	"textarea":  true,
+	"title":     true,
+	"xmp":       true,
+}
+
+// tokenizer splits an HTML document into tokens.
+// It recognizes only the tags that the rewriter needs;
+// the other parts of the document, such as texts and comments, are text tokens.
+type tokenizer struct {
+	buf []byte
+	pos int
+
+	// rawTag is the name of the raw text element that the tokenizer is in.
+	rawTag string
+}
+
+func newTokenizer(buf []byte) *tokenizer {
+	return &tokenizer{buf: buf}
+}
+
+// next returns the next token. It reports false at the end of the document.
+func (z *tokenizer) next() (token, bool) {
+	if z.pos >= len(z.buf) {
+		return token{}, false
+	}
+	if z.rawTag != "" {
+		return z.rawText(), true
+	}
+
+	start := z.pos
+	for z.pos < len(z.buf) {
+		i := bytes.IndexByte(z.buf[z.pos:], '<')
+		if i < 0 {
+			z.pos = len(z.buf)
+			break
+		}
+		z.pos += i
+		if z.pos == start {
+			if tok, ok := z.markup(); ok {
+				return tok, true
+			}
+			z.pos++
+			continue
+		}
+		if z.isMarkup() {
+			break
+		}
+		z.pos++
+	}
+	return token{typ: textToken, raw: z.buf[start:z.pos]}, true
+}
+
+// isMarkup reports whether '<' at the current position begins a tag, a comment or a doctype.
+func (z *tokenizer) isMarkup() bool {
+	if z.pos+1 >= len(z.buf) {
+		return false
+	}
+	switch c := z.buf[z.pos+1]; {
+	case c == '!', c == '?':
+		return true
+	case c == '/':
+		return z.pos+2 < len(z.buf) && (isASCIIAlpha(z.buf[z.pos+2]) || z.buf[z.pos+2] == '>')
+	default:
+		return isASCIIAlpha(c)
+	}
+}
+
+// markup reads the markup at the current position.
+// It reports false if '<' at the current position is a part of a text.
+func (z *tokenizer) markup() (token, bool) {
+	if !z.isMarkup() {
+		return token{}, false
+	}
+	start := z.pos
+	rest := z.buf[start:]
+	switch {
+	case bytes.HasPrefix(rest, []byte("<!--")):
+		z.pos = skipTo(z.buf, start+4, "-->")
+		return token{typ: textToken, raw: z.buf[start:z.pos]}, true
+	case rest[1] == '!', rest[1] == '?', rest[1] == '/' && rest[2] == '>':
+		// a doctype, a processing instruction, or an empty end tag.
+		z.pos = skipTo(z.buf, start+2, ">")
+		return token{typ: textToken, raw: z.buf[start:z.pos]}, true
+	case rest[1] == '/':
+		z.pos = skipTo(z.buf, start+2, ">")
+		raw := z.buf[start:z.pos]
+		return token{typ: endTagToken, raw: raw, name: tagName(raw[2:])}, true
+	}
+
+	spans, end := scanAttrs(rest)
+	if end < 0 {
+		// the tag is not closed; the rest of the document is a text.
+		z.pos = len(z.buf)
+		return token{typ: textToken, raw: rest}, true
+	}
+	z.pos = start + end + 1
+	raw := z.buf[start:z.pos]
+	tok := token{
+		typ:   startTagToken,
+		raw:   raw,
+		name:  tagName(raw[1:]),
+		spans: spans,
+		attrs: make([]attribute, 0, len(spans)),
+	}
+	for _, span := range spans {
+		tok.attrs = append(tok.attrs, attribute{
+			Key: string(bytes.ToLower(raw[span.keyStart:span.keyEnd])),
+			Val: html.UnescapeString(string(raw[span.valStart:span.valEnd])),
+		})
+	}
+	if rawTextElements[tok.name] && !bytes.HasSuffix(raw, []byte("/>")) {
+		z.rawTag = tok.name
+	}
+	return tok, true
+}
+
+// rawText reads the contents of the raw text element until its end tag.
+func (z *tokenizer) rawText() token {
+	start := z.pos
+	end := len(z.buf)
+	if z.rawTag != "plaintext" {
+		// the end tag is "</" + the tag name, followed by a whitespace, '/' or '>'.
+		closing := []byte("</" + z.rawTag)
+		for i := start; i < len(z.buf); i++ {
+			j := i + len(closing)
+			if j > len(z.buf) || !bytes.EqualFold(z.buf[i:j], closing) {
+				continue
+			}
+			if j == len(z.buf) || isSpace(z.buf[j]) || z.buf[j] == '/' || z.buf[j] == '>' {
+				end = i
+				break
+			}
+		}
+	}
+	z.pos = end
+	z.rawTag = ""
+	return token{typ: textToken, raw: z.buf[start:end]}
+}
+
+// skipTo returns the position after the first sep in buf[i:], or len(buf) if sep is not found.
+func skipTo(buf []byte, i int, sep string) int {
+	if i > len(buf) {
+		return len(buf)
+	}
+	j := bytes.Index(buf[i:], []byte(sep))
+	if j < 0 {
+		return len(buf)
+	}
+	return i + j + len(sep)
+}
+
+// tagName returns the lower-cased tag name at the beginning of b.
+func tagName(b []byte) string {
+	i := 0
+	for i < len(b) && !isSpace(b[i]) && b[i] != '/' && b[i] != '>' {
+		i++
+	}
+	return string(bytes.ToLower(b[:i]))
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f'
+}
+
+func isASCIIAlpha(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+// attrSpan is the position of an attribute in the raw start tag.
+type attrSpan struct {
+	// keyStart and keyEnd are the position of the key.
+	keyStart, keyEnd int
+
+	// valStart and valEnd are the position of the value, excluding the quotes.
+	valStart, valEnd int
+
+	// hasValue reports whether the attribute has a value, e.g. "k=v".
+	hasValue bool
+
+	// quoted reports whether the value is quoted.
+	quoted bool
+}
+
+// scanAttrs returns the positions of the attributes in the start tag at the beginning of raw,
+// and the position of the '>' that closes the tag.
+// The position is -1 if the tag is not closed.
+// It reads the tag in the same way as the tokenizer of the HTML standard.
+func scanAttrs(raw []byte) ([]attrSpan, int) {
+	skipSpace := func(i int) int {
+		for i < len(raw) && isSpace(raw[i]) {
+			i++
+		}
+		return i
+	}
+
+	// skip '<' and the tag name.
+	i := 1
+	for i < len(raw) && !isSpace(raw[i]) && raw[i] != '/' && raw[i] != '>' {
+		i++
+	}
+	i = skipSpace(i)
+
+	var spans []attrSpan
+	for i < len(raw) && raw[i] != '>' {
+		// read the key.
+		keyStart := i
+		for ; i < len(raw); i++ {
+			c := raw[i]
+			if c == '=' && i == keyStart {
+				// an equals sign before the key begins is a part of the key.
+				continue
+			}
+			if isSpace(c) || c == '/' || c == '>' || c == '=' {
+				break
+			}
+		}
+		span := attrSpan{keyStart: keyStart, keyEnd: i, valStart: i, valEnd: i}
+
+		// read the value.
+		j := skipSpace(i)
+		switch {
+		case j < len(raw) && raw[j] == '/':
+			i = j + 1
+		case j < len(raw) && raw[j] == '=':
+			j = skipSpace(j + 1)
+			if j >= len(raw) || raw[j] == '>' {
+				i = j
+				break
+			}
+			span.hasValue = true
+			if q := raw[j]; q == '"' || q == '\'' {
+				span.quoted = true
+				span.valStart = j + 1
+				end := bytes.IndexByte(raw[j+1:], q)
+				if end < 0 {
+					return nil, -1
+				}
+				span.valEnd = j + 1 + end
+				i = span.valEnd + 1
+			} else {
+				span.valStart = j
+				for j < len(raw) && !isSpace(raw[j]) && raw[j] != '>' {
+					j++
+				}
+				span.valEnd = j
+				i = j
+			}
+		default:
+			i = j
+		}
+
+		if span.keyEnd != keyStart {
+			spans = append(spans, span)
+		}
+		i = skipSpace(i)
+	}
+	if i >= len(raw) {
+		return nil, -1
+	}
+	return spans, i
+}
@@ -0,0 +1,83 @@
+package htmlrewrite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenizer(t *testing.T) {
+	type tok struct {
+		typ   tokenType
+		raw   string
+		name  string
+		attrs []attribute
+	}
+	tests := []struct {
+		input string
+		want  []tok
+	}{
+		{
+			input: `<p class=x>a &lt; b</P>`,
+			want: []tok{
+				{typ: startTagToken, raw: `<p class=x>`, name: "p", attrs: []attribute{{Key: "class", Val: "x"}}},
+				{typ: textToken, raw: `a &lt; b`},
+				{typ: endTagToken, raw: `</P>`, name: "p"},
+			},
+		},
+		{
+			input: `<IMG SRC="a.jpg?a=1&amp;b=2" alt='x > y' hidden/>`,
+			want: []tok{
+				{typ: startTagToken, raw: `<IMG SRC="a.jpg?a=1&amp;b=2" alt='x > y' hidden/>`, name: "img", attrs: []attribute{
+					{Key: "src", Val: "a.jpg?a=1&b=2"},
+					{Key: "alt", Val: "x > y"},
+					{Key: "hidden", Val: ""},
+				}},
+			},
+		},
+		{
+			input: `<!DOCTYPE html><!-- <img src="a.jpg"> -->1 < 2 <3`,
+			want: []tok{
+				{typ: textToken, raw: `<!DOCTYPE html>`},
+				{typ: textToken, raw: `<!-- <img src="a.jpg"> -->`},
+				{typ: textToken, raw: `1 < 2 <3`},
+			},
+		},
+		{
+			input: `<script>"</scripts>" + "<img>"</SCRIPT ><img>`,
+			want: []tok{
+				{typ: startTagToken, raw: `<script>`, name: "script", attrs: []attribute{}},
+				{typ: textToken, raw: `"</scripts>" + "<img>"`},
+				{typ: endTagToken, raw: `</SCRIPT >`, name: "script"},
+				{typ: startTagToken, raw: `<img>`, name: "img", attrs: []attribute{}},
+			},
+		},
+		{
+			input: `<img src="a.jpg`,
+			want: []tok{
+				{typ: textToken, raw: `<img src="a.jpg`},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		z := newTokenizer([]byte(tt.input))
+		var got []tok
+		var concat strings.Builder
+		for {
+			token, ok := z.next()
+			if !ok {
+				break
+			}
+			got = append(got, tok{typ: token.typ, raw: string(token.raw), name: token.name, attrs: token.attrs})
+			concat.Write(token.raw)
+		}
+		if diff := cmp.Diff(tt.want, got, cmp.AllowUnexported(tok{})); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", tt.input, diff)
+		}
+		if concat.String() != tt.input {
+			t.Errorf("%q: the tokens don't cover the input: %q", tt.input, concat.String())
+		}
+	}
+}
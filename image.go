@@ -1,10 +1,6 @@
 package imageflux
 
 import (
-	"crypto/hmac"
-	"crypto/sha256"
-	"encoding/base64"
-	"strings"
 	"sync"
 	"time"
 )
@@ -34,15 +30,57 @@ type Image struct {
 	Expires time.Time
 }
 
+// Host returns the host that serves the image.
+// If Proxy.Hosts is not empty, it is chosen by a stable hash of Path.
+func (img *Image) Host() string {
+	return img.Proxy.hostFor(img.Path)
+}
+
 // SignedURL returns the signed URL of the image.
 // As of v1.3.0, the URL no longer contains commas.
 // This is useful for the srcset attribute of an HTML img tag.
 func (img *Image) SignedURL() string {
-	path, s := img.pathAndSign()
-	if s == "" {
-		return "https://" + img.Proxy.Host + path
+	pbuf := bufPool.Get().(*[]byte)
+	buf := img.AppendSignedURL((*pbuf)[:0])
+	str := string(buf)
+	*pbuf = buf
+	bufPool.Put(pbuf)
+	return str
+}
+
+// AppendSignedURL appends the signed URL of the image to dst and returns the extended buffer.
+// It is same as SignedURL, but it doesn't allocate if dst has enough capacity.
+func (img *Image) AppendSignedURL(dst []byte) []byte {
+	dst = img.Proxy.appendOrigin(dst, img.Host())
+	return img.appendSignedPath(dst)
+}
+
+// appendSignedPath appends the path prefix and the signed path of the image.
+func (img *Image) appendSignedPath(dst []byte) []byte {
+	p := img.Proxy
+	prefixStart := len(dst)
+	dst = p.appendPathPrefix(dst)
+	if !p.hasSecret() {
+		return img.appendPath(dst)
 	}
-	return "https://" + img.Proxy.Host + "/c/sig=" + s + "%2C" + strings.TrimPrefix(path, "/c/")
+
+	// the signature is placed in front of the other parameters,
+	// but it is calculated from them.
+	// so reserve the space for the signature here, and fill it later.
+	payloadStart := len(dst)
+	if !p.SignPathPrefix {
+		prefixStart = payloadStart
+	}
+	dst = append(dst, "/c/sig="...)
+	sigStart := len(dst)
+	dst = append(dst, signaturePlaceholder...)
+	dst = appendComma(dst)
+	configStart := len(dst)
+	dst = img.appendConfigAndPath(dst)
+
+	// the payload is the path prefix (if it is signed), "/c/", the config, and the path.
+	p.encodeSignature(dst[sigStart:configStart], dst[prefixStart:payloadStart+len("/c/")], dst[configStart:])
+	return dst
 }
 
 // SignedURLWithoutComma is same as SignedURL.
@@ -54,71 +92,64 @@ func (img *Image) SignedURLWithoutComma() string {
 
 // Sign returns the signature.
 func (img *Image) Sign() string {
-	_, s := img.pathAndSign()
-	return s
-}
+	p := img.Proxy
+	if !p.hasSecret() {
+		return ""
+	}
 
-func (img *Image) pathAndSign() (string, string) {
 	pbuf := bufPool.Get().(*[]byte)
 	buf := (*pbuf)[:0]
-	buf = append(buf, "/c/"...)
-	buf = img.Config.append(buf)
-	if !img.Expires.IsZero() {
-		buf = appendComma(buf)
-		buf = append(buf, "expires="...)
-		buf = img.Expires.UTC().AppendFormat(buf, time.RFC3339)
-	}
-	if len(img.Path) == 0 || img.Path[0] != '/' {
-		buf = append(buf, '/')
-	}
-	buf = append(buf, img.Path...)
-	path := string(buf)
-
-	secret := img.Proxy.SecretBytes
-	if len(secret) == 0 && img.Proxy.Secret != "" {
-		secret = []byte(img.Proxy.Secret)
+	if p.SignPathPrefix {
+		buf = p.appendPathPrefix(buf)
 	}
+	buf = img.appendPath(buf)
 
-	if len(secret) == 0 {
-		*pbuf = buf
-		bufPool.Put(pbuf)
-		return path, ""
-	}
-
-	mac := hmac.New(sha256.New, secret)
-	mac.Write(buf)
-	buf = mac.Sum(buf[:0])
-
-	var buf2 [46]byte // 2 bytes for "1.", and 44 bytes for base64 encoding of 32 bytes.
-	buf2[0] = '1'
-	buf2[1] = '.'
-	base64.URLEncoding.Encode(buf2[2:], buf)
+	var sig [signatureLen]byte
+	p.encodeSignature(sig[:], nil, buf)
 
 	*pbuf = buf
 	bufPool.Put(pbuf)
-	return path, string(buf2[:])
+	return string(sig[:])
 }
 
-// String returns the URL of the image without the signature.
-func (img *Image) String() string {
-	pbuf := bufPool.Get().(*[]byte)
-	buf := (*pbuf)[:0]
-
-	buf = append(buf, "https://"...)
-	buf = append(buf, img.Proxy.Host...)
+// appendPath appends "/c/", the config, and the path of the image.
+func (img *Image) appendPath(buf []byte) []byte {
 	buf = append(buf, "/c/"...)
+	return img.appendConfigAndPath(buf)
+}
+
+func (img *Image) appendConfigAndPath(buf []byte) []byte {
 	buf = img.Config.append(buf)
 	if !img.Expires.IsZero() {
 		buf = appendComma(buf)
 		buf = append(buf, "expires="...)
 		buf = img.Expires.UTC().AppendFormat(buf, time.RFC3339)
 	}
-	if len(img.Path) == 0 || img.Path[0] != '/' {
+	return appendImagePath(buf, img.Path)
+}
+
+// appendImagePath appends path with the leading slash.
+func appendImagePath(buf []byte, path string) []byte {
+	if len(path) == 0 || path[0] != '/' {
 		buf = append(buf, '/')
 	}
-	buf = append(buf, img.Path...)
+	return append(buf, path...)
+}
+
+// String returns the URL of the image without the signature.
+func (img *Image) String() string {
+	pbuf := bufPool.Get().(*[]byte)
+	buf := img.AppendString((*pbuf)[:0])
 	str := string(buf)
 	*pbuf = buf
 	bufPool.Put(pbuf)
 	return str
 }
+
+// AppendString appends the URL of the image without the signature to dst and returns the extended buffer.
+// It is same as String, but it doesn't allocate if dst has enough capacity.
+func (img *Image) AppendString(dst []byte) []byte {
+	dst = img.Proxy.appendOrigin(dst, img.Host())
+	dst = img.Proxy.appendPathPrefix(dst)
+	return img.appendPath(dst)
+}
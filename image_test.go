@@ -7,6 +7,9 @@ import (
 
 var jst *time.Location = time.FixedZone("Asia/Tokyo", 9*60*60)
 
+// raceEnabled is true if the race detector is enabled.
+var raceEnabled bool
+
 func BenchmarkImage(b *testing.B) {
 	img := &Image{
 		Proxy: &Proxy{
@@ -23,6 +26,119 @@ func BenchmarkImage(b *testing.B) {
 	}
 }
 
+func BenchmarkImage_AppendSignedURL(b *testing.B) {
+	img := &Image{
+		Proxy: &Proxy{
+			Host:        "demo.imageflux.jp",
+			SecretBytes: []byte("testsigningsecret"),
+		},
+		Path: "/images/1.jpg",
+		Config: &Config{
+			Width: 200,
+		},
+	}
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = img.AppendSignedURL(buf[:0])
+	}
+}
+
+func BenchmarkImage_AppendString(b *testing.B) {
+	img := &Image{
+		Proxy: &Proxy{
+			Host: "demo.imageflux.jp",
+		},
+		Path: "/images/1.jpg",
+		Config: &Config{
+			Width: 200,
+		},
+	}
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = img.AppendString(buf[:0])
+	}
+}
+
+func TestImage_AppendSignedURL(t *testing.T) {
+	img := &Image{
+		Proxy: &Proxy{
+			Host:       "demo.imageflux.jp",
+			Secret:     "testsigningsecret",
+			PathPrefix: "img",
+			Port:       8080,
+			Hosts:      []string{"img1.example.com", "img2.example.com"},
+			Scheme:     "http",
+		},
+		Path: "/images/1.jpg",
+		Config: &Config{
+			Width: 200,
+		},
+		Expires: time.Date(2023, 6, 24, 18, 23, 0, 0, jst),
+	}
+	buf := []byte("prefix ")
+	got := string(img.AppendSignedURL(buf))
+	want := "prefix " + img.SignedURL()
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	got = string(img.AppendString(buf))
+	want = "prefix " + img.String()
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	if raceEnabled {
+		// sync.Pool drops the cached HMAC states randomly in the race mode.
+		t.Skip("skipping allocation tests in the race mode")
+	}
+	buf = make([]byte, 0, 256)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = img.AppendSignedURL(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocation, got %f", allocs)
+	}
+	allocs = testing.AllocsPerRun(100, func() {
+		buf = img.AppendString(buf[:0])
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocation, got %f", allocs)
+	}
+}
+
+func TestImage_Sign(t *testing.T) {
+	img := &Image{
+		Proxy: &Proxy{
+			Host:        "demo.imageflux.jp",
+			SecretBytes: []byte("testsigningsecret"),
+		},
+		Path: "/images/1.jpg",
+		Config: &Config{
+			Width: 200,
+		},
+	}
+	if got, want := img.Sign(), "1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg="; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// the secret is changed.
+	img.Proxy.SecretBytes = []byte("oldsecret")
+	if got, want := img.Sign(), "1.V5PHZWHTmE_TGmwBgGpKzbGm2Lo2R4uTxcB2hE3vLLs="; got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// no secret
+	img.Proxy.SecretBytes = nil
+	if got := img.Sign(); got != "" {
+		t.Errorf("want empty, got %s", got)
+	}
+}
+
 func TestImage_SignedURL(t *testing.T) {
 	cases := []struct {
 		image  *Image
@@ -127,6 +243,69 @@ func TestImage_SignedURL(t *testing.T) {
 			"https://demo.imageflux.jp/c/w=400%2Cl=(w=300%2Fimages%2F1.png)%2Cf=webp:auto/bridge.jpg",
 		},
 
+		// scheme, port and path prefix
+		{
+			&Image{
+				Proxy: &Proxy{
+					Host:   "127.0.0.1",
+					Scheme: "http",
+					Port:   8080,
+				},
+				Path: "/images/1.jpg",
+				Config: &Config{
+					Width: 200,
+				},
+			},
+			"http://127.0.0.1:8080/c/w=200/images/1.jpg",
+		},
+		{
+			&Image{
+				Proxy: &Proxy{
+					Host:        "cdn.example.com",
+					PathPrefix:  "/img/",
+					SecretBytes: []byte("testsigningsecret"),
+				},
+				Path: "/images/1.jpg",
+				Config: &Config{
+					Width: 200,
+				},
+			},
+			// the path prefix is not signed.
+			"https://cdn.example.com/img/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg",
+		},
+		{
+			&Image{
+				Proxy: &Proxy{
+					Host:           "cdn.example.com",
+					PathPrefix:     "img",
+					SignPathPrefix: true,
+					SecretBytes:    []byte("testsigningsecret"),
+				},
+				Path: "/images/1.jpg",
+				Config: &Config{
+					Width: 200,
+				},
+			},
+			// the path prefix is signed.
+			"https://cdn.example.com/img/c/sig=1.Z6f5eEb9nSBnNu7ztRSRmRo2Ki79WwoipV8cu3KH2Ks=%2Cw=200/images/1.jpg",
+		},
+
+		// host sharding
+		{
+			&Image{
+				Proxy: &Proxy{
+					Hosts:       []string{"img1.example.com", "img2.example.com", "img3.example.com"},
+					SecretBytes: []byte("testsigningsecret"),
+				},
+				Path: "/images/1.jpg",
+				Config: &Config{
+					Width: 200,
+				},
+			},
+			// the signature doesn't depend on the host.
+			"https://img2.example.com/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg",
+		},
+
 		// tests for backward compatibility with Secret field.
 		{
 			&Image{
@@ -311,6 +490,34 @@ func TestImage_SignedURLWithoutComma(t *testing.T) {
 	}
 }
 
+func TestImage_Host(t *testing.T) {
+	proxy := &Proxy{
+		Hosts: []string{"img1.example.com", "img2.example.com", "img3.example.com"},
+	}
+	cases := []struct {
+		path string
+		want string
+	}{
+		{"/images/1.jpg", "img2.example.com"},
+		{"images/1.jpg", "img2.example.com"},
+		{"/images/2.jpg", "img3.example.com"},
+		{"/images/3.jpg", "img2.example.com"},
+		{"/images/4.jpg", "img1.example.com"},
+	}
+	for _, c := range cases {
+		img := proxy.Image(c.path, nil)
+		if got := img.Host(); got != c.want {
+			t.Errorf("%q: want %s, got %s", c.path, c.want, got)
+		}
+	}
+
+	// without sharding
+	img := (&Proxy{Host: "demo.imageflux.jp"}).Image("/images/1.jpg", nil)
+	if got := img.Host(); got != "demo.imageflux.jp" {
+		t.Errorf("want demo.imageflux.jp, got %s", got)
+	}
+}
+
 func TestImage_String(t *testing.T) {
 	cases := []struct {
 		image  *Image
@@ -347,6 +554,21 @@ func TestImage_String(t *testing.T) {
 			},
 			"https://demo.imageflux.jp/c/f=auto%2Cexpires=2023-06-24T09:23:00Z/images/1.jpg",
 		},
+		{
+			&Image{
+				Proxy: &Proxy{
+					Host:       "127.0.0.1",
+					Scheme:     "http",
+					Port:       8080,
+					PathPrefix: "/img",
+				},
+				Path: "/images/1.jpg",
+				Config: &Config{
+					Width: 200,
+				},
+			},
+			"http://127.0.0.1:8080/img/c/w=200/images/1.jpg",
+		},
 	}
 
 	for _, c := range cases {
@@ -0,0 +1,250 @@
+package imageflux
+
+import (
+	"fmt"
+	"image"
+	"net/url"
+)
+
+// Finding is a deprecated usage found by the linter.
+type Finding struct {
+	// Field is where the deprecated usage is found.
+	// For values, it is the name of the field, e.g. "Clip" or "Overlays[0].URL".
+	// For URLs, it is the key of the parameter, e.g. "c" or "l[0].r".
+	Field string
+
+	// Replacement is the canonical replacement of the deprecated usage,
+	// e.g. "OutputClip" or "oc".
+	Replacement string
+
+	// Message describes the finding.
+	Message string
+}
+
+func (f Finding) String() string {
+	return f.Field + ": " + f.Message
+}
+
+func deprecatedFieldFinding(prefix, field, canonical string) Finding {
+	return Finding{
+		Field:       prefix + field,
+		Replacement: prefix + canonical,
+		Message:     fmt.Sprintf("deprecated field %s is used, use %s instead", field, canonical),
+	}
+}
+
+// Lint reports the deprecated fields and values used in c.
+// If c is nil, it returns nil.
+func (c *Config) Lint() []Finding {
+	if c == nil {
+		return nil
+	}
+	var findings []Finding
+	if c.Clip != (image.Rectangle{}) {
+		findings = append(findings, deprecatedFieldFinding("", "Clip", "OutputClip"))
+	}
+	if c.ClipRatio != (image.Rectangle{}) {
+		findings = append(findings, deprecatedFieldFinding("", "ClipRatio", "OutputClipRatio"))
+	}
+	if c.Rotate != RotateDefault {
+		findings = append(findings, deprecatedFieldFinding("", "Rotate", "OutputRotate"))
+	}
+	if c.Format == FormatWebPFromJPEG {
+		findings = append(findings, Finding{
+			Field:       "Format",
+			Replacement: string(FormatWebPJPEG),
+			Message:     deprecatedFormatWarning(c.Format, FormatWebPJPEG),
+		})
+	}
+	for i, o := range c.Overlays {
+		findings = o.lint(findings, fmt.Sprintf("Overlays[%d].", i))
+	}
+	return findings
+}
+
+func (o *Overlay) lint(findings []Finding, prefix string) []Finding {
+	if o == nil {
+		return findings
+	}
+	if o.URL != "" {
+		findings = append(findings, deprecatedFieldFinding(prefix, "URL", "Path"))
+	}
+	if o.Clip != (image.Rectangle{}) {
+		findings = append(findings, deprecatedFieldFinding(prefix, "Clip", "OutputClip"))
+	}
+	if o.ClipRatio != (image.Rectangle{}) {
+		findings = append(findings, deprecatedFieldFinding(prefix, "ClipRatio", "OutputClipRatio"))
+	}
+	if o.Rotate != RotateDefault {
+		findings = append(findings, deprecatedFieldFinding(prefix, "Rotate", "OutputRotate"))
+	}
+	return findings
+}
+
+// Modernize returns a copy of c that uses the canonical fields and values
+// instead of the deprecated ones.
+// The copy encodes into the same parameters as c,
+// except that the deprecated format "webp:jpeg" is replaced by "webp:jpg".
+// The copy shares nothing with c, including the overlays and the texts.
+// If c is nil, it returns an empty Config.
+func (c *Config) Modernize() *Config {
+	if c == nil {
+		return &Config{}
+	}
+	ret := c.clone()
+	ret.OutputClip = clipOrAlias(c.OutputClip, c.Clip)
+	ret.Clip = image.Rectangle{}
+	ret.OutputClipRatio = clipOrAlias(c.OutputClipRatio, c.ClipRatio)
+	ret.ClipRatio = image.Rectangle{}
+	ret.OutputRotate = rotateOrAlias(c.OutputRotate, c.Rotate)
+	ret.Rotate = RotateDefault
+	if ret.Format == FormatWebPFromJPEG {
+		ret.Format = FormatWebPJPEG
+	}
+	for _, o := range ret.Overlays {
+		o.modernize()
+	}
+	return ret
+}
+
+// modernize replaces the deprecated fields of o in place.
+func (o *Overlay) modernize() {
+	if o == nil {
+		return
+	}
+	if o.Path == "" {
+		o.Path = o.URL
+	}
+	o.URL = ""
+	o.OutputClip = clipOrAlias(o.OutputClip, o.Clip)
+	o.Clip = image.Rectangle{}
+	o.OutputClipRatio = clipOrAlias(o.OutputClipRatio, o.ClipRatio)
+	o.ClipRatio = image.Rectangle{}
+	o.OutputRotate = rotateOrAlias(o.OutputRotate, o.Rotate)
+	o.Rotate = RotateDefault
+}
+
+// Lint reports the deprecated fields used in p.
+func (p *Proxy) Lint() []Finding {
+	var findings []Finding
+	if p.Secret != "" {
+		findings = append(findings, deprecatedFieldFinding("", "Secret", "SecretBytes"))
+	}
+	return findings
+}
+
+// LintResult is the result of Proxy.LintURL.
+type LintResult struct {
+	// Findings are the deprecated usages found in the URL.
+	Findings []Finding
+
+	// URL is the URL rewritten into the canonical form.
+	// It is the input URL as is if there are no findings.
+	URL string
+
+	// Signed is true if URL has a signature.
+	// The rewritten URL is re-signed if the proxy has a signing secret,
+	// so it is false if the input URL is signed but the proxy has no secret.
+	Signed bool
+}
+
+// LintURL reports the deprecated parameter keys and values used in rawURL,
+// and rewrites rawURL into the canonical form.
+// If the proxy has a signing secret, the rewritten URL is signed with it,
+// and rawURL must have a valid signature; otherwise ErrInvalidSignature is returned.
+// Expired URLs are accepted because the expiration time is kept in the rewritten URL.
+func (p *Proxy) LintURL(rawURL string) (*LintResult, error) {
+	res, err := p.Verify(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.checkSignature(res); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("imageflux: invalid url %q: %w", rawURL, err)
+	}
+
+	findings, err := lintConfigParams(nil, "", p.trimPathPrefix(u.EscapedPath()))
+	if err != nil {
+		return nil, err
+	}
+	if len(findings) == 0 {
+		return &LintResult{
+			URL:    rawURL,
+			Signed: res.Signed,
+		}, nil
+	}
+
+	img := &Image{
+		Proxy:  p,
+		Path:   res.Image.Path,
+		Config: res.Image.Config.Modernize(),
+	}
+	return &LintResult{
+		Findings: findings,
+		URL:      p.rewriteURL(u, img),
+		Signed:   p.hasSecret(),
+	}, nil
+}
+
+// lintConfigParams reports the deprecated parameters in the parameter segment s.
+func lintConfigParams(findings []Finding, prefix, s string) ([]Finding, error) {
+	t := Tokenizer{s: s}
+	var overlays, texts int
+	for t.Next() {
+		tok := t.Token()
+		switch tok.Key {
+		case "l":
+			inner := tok.RawValue[1 : len(tok.RawValue)-1]
+			findings = lintOverlayParams(findings, fmt.Sprintf("%sl[%d].", prefix, overlays), inner)
+			overlays++
+		case "t":
+			inner := tok.RawValue[1 : len(tok.RawValue)-1]
+			findings = lintTextParams(findings, fmt.Sprintf("%st[%d].", prefix, texts), inner)
+			texts++
+		case "f":
+			if Format(tok.RawValue) == FormatWebPFromJPEG {
+				findings = append(findings, Finding{
+					Field:       prefix + tok.Key,
+					Replacement: string(FormatWebPJPEG),
+					Message:     deprecatedFormatWarning(FormatWebPFromJPEG, FormatWebPJPEG),
+				})
+			}
+		default:
+			findings = lintKey(findings, prefix, tok.Key, TargetConfig)
+		}
+	}
+	return findings, t.Err()
+}
+
+// lintOverlayParams reports the deprecated parameters in the overlay specification s.
+func lintOverlayParams(findings []Finding, prefix, s string) []Finding {
+	t := newNestedTokenizer(s, modeOverlay)
+	for t.Next() {
+		findings = lintKey(findings, prefix, t.Token().Key, TargetOverlay)
+	}
+	return findings
+}
+
+// lintTextParams reports the deprecated parameters in the text specification s.
+func lintTextParams(findings []Finding, prefix, s string) []Finding {
+	t := newNestedTokenizer(s, modeText)
+	for t.Next() {
+		findings = lintKey(findings, prefix, t.Token().Key, TargetText)
+	}
+	return findings
+}
+
+func lintKey(findings []Finding, prefix, key string, target ParamTarget) []Finding {
+	p, ok := LookupParam(key, target)
+	if !ok || p.Key == key {
+		return findings
+	}
+	return append(findings, Finding{
+		Field:       prefix + key,
+		Replacement: p.Key,
+		Message:     deprecatedKeyWarning(key, p.Key),
+	})
+}
@@ -0,0 +1,169 @@
+package imageflux
+
+import (
+	"errors"
+	"image"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfig_Lint(t *testing.T) {
+	c := &Config{
+		Width:     200,
+		Clip:      image.Rect(0, 0, 100, 100),
+		ClipRatio: image.Rect(0, 0, 1, 1),
+		ClipMax:   image.Pt(2, 2),
+		Rotate:    RotateTopRight,
+		Format:    FormatWebPFromJPEG,
+		Overlays: []*Overlay{
+			{
+				URL:    "/images/2.png",
+				Rotate: RotateBottomLeft,
+			},
+		},
+	}
+	want := []Finding{
+		{Field: "Clip", Replacement: "OutputClip", Message: "deprecated field Clip is used, use OutputClip instead"},
+		{Field: "ClipRatio", Replacement: "OutputClipRatio", Message: "deprecated field ClipRatio is used, use OutputClipRatio instead"},
+		{Field: "Rotate", Replacement: "OutputRotate", Message: "deprecated field Rotate is used, use OutputRotate instead"},
+		{Field: "Format", Replacement: "webp:jpg", Message: `deprecated format "webp:jpeg" is used, use "webp:jpg" instead`},
+		{Field: "Overlays[0].URL", Replacement: "Overlays[0].Path", Message: "deprecated field URL is used, use Path instead"},
+		{Field: "Overlays[0].Rotate", Replacement: "Overlays[0].OutputRotate", Message: "deprecated field Rotate is used, use OutputRotate instead"},
+	}
+	if diff := cmp.Diff(want, c.Lint()); diff != "" {
+		t.Errorf("Lint() mismatch (-want +got):\n%s", diff)
+	}
+
+	modern := c.Modernize()
+	if got := modern.Lint(); len(got) != 0 {
+		t.Errorf("Modernize().Lint() = %v, want no findings", got)
+	}
+	if got, want := modern.String(), "w=200%2Coc=0:0:100:100%2Cocr=0:0:0.5:0.5%2Cor=2%2Cl=(or=4%2Fimages%2F2.png)%2Cf=webp:jpg"; got != want {
+		t.Errorf("Modernize().String() = %q, want %q", got, want)
+	}
+
+	// Modernize doesn't modify the original.
+	if c.Clip.Empty() || c.Overlays[0].URL == "" {
+		t.Error("Modernize modified the original config")
+	}
+}
+
+func TestConfig_Modernize_copy(t *testing.T) {
+	c := &Config{
+		Texts: []*Text{
+			{Font: &Font{Name: "Ryumin R-KL"}, Size: 30, Text: "hello"},
+		},
+	}
+	modern := c.Modernize()
+	modern.Texts[0].Text = "modified"
+	modern.Texts[0].Font.Name = "modified"
+	if c.Texts[0].Text != "hello" || c.Texts[0].Font.Name != "Ryumin R-KL" {
+		t.Error("editing the result of Modernize modified the original config")
+	}
+}
+
+func TestConfig_Lint_nil(t *testing.T) {
+	var c *Config
+	if got := c.Lint(); got != nil {
+		t.Errorf("Lint() = %v, want nil", got)
+	}
+	if got := c.Modernize().String(); got != "f=auto" {
+		t.Errorf("Modernize().String() = %q, want %q", got, "f=auto")
+	}
+}
+
+func TestProxy_Lint(t *testing.T) {
+	p := &Proxy{Secret: "testsigningsecret"}
+	want := []Finding{
+		{Field: "Secret", Replacement: "SecretBytes", Message: "deprecated field Secret is used, use SecretBytes instead"},
+	}
+	if diff := cmp.Diff(want, p.Lint()); diff != "" {
+		t.Errorf("Lint() mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestProxy_LintURL(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	cases := []struct {
+		name  string
+		proxy *Proxy
+		input string
+		want  *LintResult
+	}{
+		{
+			name:  "canonical",
+			proxy: &Proxy{},
+			input: "https://demo.imageflux.jp/c/w=200,oc=0:0:100:100/images/1.jpg",
+			want: &LintResult{
+				URL: "https://demo.imageflux.jp/c/w=200,oc=0:0:100:100/images/1.jpg",
+			},
+		},
+		{
+			name:  "without secret",
+			proxy: &Proxy{},
+			input: "https://demo.imageflux.jp/c/c=0:0:100:100%2Cr=2%2Cl=(cr=0:0:0.5:0.5%2Fimages%2F2.png)%2Cf=webp:jpeg/images/1.jpg",
+			want: &LintResult{
+				Findings: []Finding{
+					{Field: "c", Replacement: "oc", Message: `deprecated key "c" is used, use "oc" instead`},
+					{Field: "r", Replacement: "or", Message: `deprecated key "r" is used, use "or" instead`},
+					{Field: "l[0].cr", Replacement: "ocr", Message: `deprecated key "cr" is used, use "ocr" instead`},
+					{Field: "f", Replacement: "webp:jpg", Message: `deprecated format "webp:jpeg" is used, use "webp:jpg" instead`},
+				},
+				URL: "https://demo.imageflux.jp/c/oc=0:0:100:100%2Cor=2%2Cl=(ocr=0:0:0.5:0.5%2Fimages%2F2.png)%2Cf=webp:jpg/images/1.jpg",
+			},
+		},
+		{
+			name: "re-sign",
+			proxy: &Proxy{
+				SecretBytes: []byte("testsigningsecret"),
+			},
+			input: "/c/sig=1.7AQcMhmQ21BVWYDIABFAhb5i-mfXyI27uPhwjJ09bxQ=,c=0:0:100:100,expires=2023-06-24T09:24:00Z/images/1.jpg",
+			want: &LintResult{
+				Findings: []Finding{
+					{Field: "c", Replacement: "oc", Message: `deprecated key "c" is used, use "oc" instead`},
+				},
+				URL:    "/c/sig=1.fc18JNYyrWtCsPEcH9AgE3MBAAxq_RIvMNvnQeQkuis=%2Cexpires=2023-06-24T09:24:00Z%2Coc=0:0:100:100/images/1.jpg",
+				Signed: true,
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.proxy.LintURL(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := cmp.Diff(tt.want, got); diff != "" {
+				t.Errorf("LintURL() mismatch (-want +got):\n%s", diff)
+			}
+
+			// the rewritten URL is valid, and has no findings.
+			again, err := tt.proxy.LintURL(got.URL)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(again.Findings) != 0 {
+				t.Errorf("the rewritten URL has findings: %v", again.Findings)
+			}
+		})
+	}
+}
+
+func TestProxy_LintURL_invalidSignature(t *testing.T) {
+	p := &Proxy{
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	for _, input := range []string{
+		"/c/sig=1.invalid,c=0:0:100:100/images/1.jpg",
+		"/c/c=0:0:100:100/images/1.jpg",
+	} {
+		_, err := p.LintURL(input)
+		if !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%q: want ErrInvalidSignature, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package imageflux
+
+import "fmt"
+
+// Removal is a parameter removed by Config.Minimize.
+type Removal struct {
+	// Key is the key of the removed parameter, e.g. "q" or "l[0].b".
+	Key string
+
+	// Reason describes why the parameter has no effect.
+	Reason string
+}
+
+func (r Removal) String() string {
+	return r.Key + ": " + r.Reason
+}
+
+// outputFormats is the set of the formats that the output image may be encoded in.
+type outputFormats struct {
+	jpeg, png, gif, webp bool
+}
+
+// possibleOutputFormats returns the formats that the output image may be encoded in.
+// ok is false if they are unknown, e.g. f=auto depends on the input image.
+func possibleOutputFormats(f Format) (formats outputFormats, ok bool) {
+	switch f {
+	case FormatJPEG:
+		return outputFormats{jpeg: true}, true
+	case FormatPNG:
+		return outputFormats{png: true}, true
+	case FormatGIF:
+		return outputFormats{gif: true}, true
+	case FormatWebP:
+		return outputFormats{webp: true}, true
+	case FormatWebPJPEG, FormatWebPFromJPEG:
+		return outputFormats{webp: true, jpeg: true}, true
+	case FormatWebPPNG:
+		return outputFormats{webp: true, png: true}, true
+	case FormatWebPGIF:
+		return outputFormats{webp: true, gif: true}, true
+	}
+	return outputFormats{}, false
+}
+
+// Minimize returns a copy of c without the parameters that have no effect,
+// and reports the removed parameters.
+// The result produces the same image as c with shorter URLs.
+//
+// The following parameters are removed:
+//
+//   - q (Quality) if the output format is neither JPEG nor WebP.
+//   - lossless (Lossless) if the output format is not WebP.
+//   - o=0 (DisableOptimization) if the output format is not JPEG.
+//   - b (Background) if the aspect mode is not pad.
+//   - dpr=1 (DevicePixelRatio).
+//   - unsharp (Unsharp) if its gain is zero.
+//
+// The output format is known only if Format is specified explicitly.
+// If it is empty or auto, the format-dependent parameters are kept.
+// Deprecated fields are replaced in the same way as Modernize.
+func (c *Config) Minimize() (*Config, []Removal) {
+	ret := c.Modernize()
+	var removals []Removal
+
+	if formats, ok := possibleOutputFormats(ret.Format); ok {
+		if ret.Quality != 0 && !formats.jpeg && !formats.webp {
+			ret.Quality = 0
+			removals = append(removals, Removal{
+				Key:    "q",
+				Reason: fmt.Sprintf("quality is used only for JPEG and WebP, but the format is %s", ret.Format),
+			})
+		}
+		if ret.Lossless && !formats.webp {
+			ret.Lossless = false
+			removals = append(removals, Removal{
+				Key:    "lossless",
+				Reason: fmt.Sprintf("lossless is used only for WebP, but the format is %s", ret.Format),
+			})
+		}
+		if ret.DisableOptimization && !formats.jpeg {
+			ret.DisableOptimization = false
+			removals = append(removals, Removal{
+				Key:    "o",
+				Reason: fmt.Sprintf("optimization is used only for JPEG, but the format is %s", ret.Format),
+			})
+		}
+	}
+
+	if ret.Background != nil && ret.AspectMode != AspectModePad {
+		ret.Background = nil
+		removals = append(removals, Removal{
+			Key:    "b",
+			Reason: "background is used only in the pad aspect mode",
+		})
+	}
+	if ret.DevicePixelRatio == 1 {
+		ret.DevicePixelRatio = 0
+		removals = append(removals, Removal{
+			Key:    "dpr",
+			Reason: "device pixel ratio 1 is the default",
+		})
+	}
+	if ret.Unsharp.Radius != 0 && ret.Unsharp.Threshold != 0 && ret.Unsharp.Gain == 0 {
+		ret.Unsharp = Unsharp{}
+		removals = append(removals, Removal{
+			Key:    "unsharp",
+			Reason: "unsharp mask with zero gain doesn't sharpen",
+		})
+	}
+
+	for i, o := range ret.Overlays {
+		if o.Background != nil && o.AspectMode != AspectModePad {
+			o.Background = nil
+			removals = append(removals, Removal{
+				Key:    fmt.Sprintf("l[%d].b", i),
+				Reason: "background is used only in the pad aspect mode",
+			})
+		}
+	}
+	return ret, removals
+}
@@ -0,0 +1,106 @@
+package imageflux
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestConfig_Minimize(t *testing.T) {
+	white := color.NRGBA{R: 255, G: 255, B: 255, A: 255}
+	cases := []struct {
+		input    *Config
+		want     string
+		removals []Removal
+	}{
+		{
+			input: &Config{Width: 200, Format: FormatPNG, Quality: 80},
+			want:  "w=200%2Cf=png",
+			removals: []Removal{
+				{Key: "q", Reason: "quality is used only for JPEG and WebP, but the format is png"},
+			},
+		},
+		{
+			input: &Config{Width: 200, Format: FormatWebPJPEG, Quality: 80},
+			want:  "w=200%2Cf=webp:jpg%2Cq=80",
+		},
+		{
+			input: &Config{Format: FormatJPEG, Lossless: true},
+			want:  "f=jpg",
+			removals: []Removal{
+				{Key: "lossless", Reason: "lossless is used only for WebP, but the format is jpg"},
+			},
+		},
+		{
+			input: &Config{Format: FormatWebP, DisableOptimization: true, Lossless: true},
+			want:  "f=webp%2Clossless=1",
+			removals: []Removal{
+				{Key: "o", Reason: "optimization is used only for JPEG, but the format is webp"},
+			},
+		},
+		{
+			// the output format is unknown.
+			input: &Config{Quality: 80, Lossless: true, DisableOptimization: true},
+			want:  "q=80%2Co=0%2Clossless=1",
+		},
+		{
+			input: &Config{Width: 200, Height: 200, AspectMode: AspectModeCrop, Background: white},
+			want:  "w=200%2Ch=200%2Ca=2",
+			removals: []Removal{
+				{Key: "b", Reason: "background is used only in the pad aspect mode"},
+			},
+		},
+		{
+			input: &Config{Width: 200, Height: 200, AspectMode: AspectModePad, Background: white},
+			want:  "w=200%2Ch=200%2Ca=3%2Cb=ffffff",
+		},
+		{
+			input: &Config{Width: 200, DevicePixelRatio: 1},
+			want:  "w=200",
+			removals: []Removal{
+				{Key: "dpr", Reason: "device pixel ratio 1 is the default"},
+			},
+		},
+		{
+			input: &Config{Width: 200, Unsharp: Unsharp{Radius: 2, Sigma: 1, Gain: 0, Threshold: 0.05}},
+			want:  "w=200",
+			removals: []Removal{
+				{Key: "unsharp", Reason: "unsharp mask with zero gain doesn't sharpen"},
+			},
+		},
+		{
+			input: &Config{
+				Overlays: []*Overlay{
+					{Path: "/images/2.png", Background: white},
+				},
+			},
+			want: "l=(%2Fimages%2F2.png)",
+			removals: []Removal{
+				{Key: "l[0].b", Reason: "background is used only in the pad aspect mode"},
+			},
+		},
+	}
+
+	for _, tt := range cases {
+		got, removals := tt.input.Minimize()
+		if got.String() != tt.want {
+			t.Errorf("%s: want %q, got %q", tt.input, tt.want, got)
+		}
+		if diff := cmp.Diff(tt.removals, removals); diff != "" {
+			t.Errorf("%s: removals mismatch (-want +got):\n%s", tt.input, diff)
+		}
+	}
+}
+
+func TestConfig_Minimize_copy(t *testing.T) {
+	c := &Config{
+		Overlays: []*Overlay{
+			{Path: "/images/2.png", Background: color.White},
+		},
+	}
+	c.Minimize()
+	if c.Overlays[0].Background == nil {
+		t.Error("Minimize modified the original config")
+	}
+}
@@ -475,6 +475,43 @@ var parseOverlayCases = []struct {
 			Path:         "/images/1.png",
 		},
 	},
+	{
+		input: "x=10%2Cy=-20%2Fimages%2F1.png",
+		want: &Overlay{
+			Offset: image.Pt(10, -20),
+			Path:   "/images/1.png",
+		},
+	},
+	{
+		input: "xr=0.5%2Cyr=0.25%2Fimages%2F1.png",
+		want: &Overlay{
+			OffsetRatio: image.Pt(32768, 16384),
+			OffsetMax:   image.Pt(65536, 65536),
+			Path:        "/images/1.png",
+		},
+	},
+	{
+		input: "lg=9%2Fimages%2F1.png",
+		want: &Overlay{
+			OverlayOrigin: OriginBottomRight,
+			Path:          "/images/1.png",
+		},
+	},
+	{
+		input: "mask=white%2Fimages%2F1.png",
+		want: &Overlay{
+			MaskType: MaskTypeWhite,
+			Path:     "/images/1.png",
+		},
+	},
+	{
+		input: "mask=alpha:1%2Fimages%2F1.png",
+		want: &Overlay{
+			MaskType:    MaskTypeAlpha,
+			PaddingMode: PaddingModeLeave,
+			Path:        "/images/1.png",
+		},
+	},
 }
 
 func TestParseOverlay(t *testing.T) {
@@ -624,6 +661,30 @@ var parseOverlayErrorCases = []string{
 	"or=ERR",
 	"or=0",
 	"or=9",
+
+	// Offset
+	"x=ERR",
+	"y=ERR",
+
+	// OffsetRatio
+	"xr=ERR",
+	"xr=-0.1",
+	"xr=1.1",
+	"xr=NaN",
+	"yr=ERR",
+	"yr=-0.1",
+	"yr=1.1",
+
+	// OverlayOrigin
+	"lg=ERR",
+	"lg=-1",
+	"lg=10",
+
+	// MaskType and PaddingMode
+	"mask=ERR",
+	"mask=white:ERR",
+	"mask=white:2",
+	"mask=white:1:1",
 }
 
 func TestParseOverlay_error(t *testing.T) {
@@ -635,6 +696,73 @@ func TestParseOverlay_error(t *testing.T) {
 	}
 }
 
+func TestParseOverlay_roundTrip(t *testing.T) {
+	// all fields that can be represented in the URL.
+	want := &Overlay{
+		Path:            "/images/1.png",
+		Width:           100,
+		Height:          200,
+		DisableEnlarge:  true,
+		AspectMode:      AspectModePad,
+		InputClip:       image.Rect(1, 2, 3, 4),
+		InputClipRatio:  image.Rect(0, 0, 32768, 32768),
+		InputOrigin:     OriginTopLeft,
+		OutputClip:      image.Rect(5, 6, 7, 8),
+		OutputClipRatio: image.Rect(16384, 16384, 65536, 65536),
+		ClipMax:         image.Pt(65536, 65536),
+		OutputOrigin:    OriginMiddleCenter,
+		Origin:          OriginBottomLeft,
+		Background:      color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0x44},
+		InputRotate:     RotateTopRight,
+		OutputRotate:    RotateAuto,
+		Offset:          image.Pt(-10, 20),
+		OffsetRatio:     image.Pt(32768, 16384),
+		OffsetMax:       image.Pt(65536, 65536),
+		OverlayOrigin:   OriginBottomRight,
+		MaskType:        MaskTypeBlack,
+		PaddingMode:     PaddingModeLeave,
+	}
+	got, err := ParseOverlay(want.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("%q: mismatch (-want +got):\n%s", want.String(), diff)
+	}
+}
+
+func TestParseOverlay_roundTrip_singleAxis(t *testing.T) {
+	tests := []string{
+		"x=10%2Fimages%2F1.png",
+		"y=-20%2Fimages%2F1.png",
+		"xr=0.5%2Fimages%2F1.png",
+		"yr=0.25%2Fimages%2F1.png",
+		"xr=0%2Fimages%2F1.png",
+		"x=10%2Cyr=0.5%2Fimages%2F1.png",
+	}
+	for _, input := range tests {
+		o, err := ParseOverlay(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", input, err)
+			continue
+		}
+		if got := o.String(); got != input {
+			t.Errorf("%q: want %q, got %q", input, input, got)
+		}
+	}
+}
+
+func TestParseOverlay_invalidRatio(t *testing.T) {
+	// a failed parse doesn't update the overlay.
+	s := overlayParseState{overlay: &Overlay{}}
+	if err := s.setValue("xr", "2"); err == nil {
+		t.Fatal("want error, got nil")
+	}
+	if diff := cmp.Diff(&Overlay{}, s.overlay); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
 func FuzzParseOverlay(f *testing.F) {
 	for _, c := range parseOverlayCases {
 		f.Add(c.input)
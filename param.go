@@ -0,0 +1,201 @@
+package imageflux
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ParamTarget is a set of structs that a parameter applies to.
+type ParamTarget uint8
+
+const (
+	// TargetConfig is the parameter of Config.
+	TargetConfig ParamTarget = 1 << iota
+
+	// TargetOverlay is the parameter of Overlay, used in "l=(...)".
+	TargetOverlay
+
+	// TargetText is the parameter of Text, used in "t=(...)".
+	TargetText
+)
+
+// Param is a definition of an ImageFlux parameter.
+type Param struct {
+	// Key is the canonical key of the parameter, e.g. "w".
+	Key string
+
+	// Aliases are the deprecated keys of the parameter.
+	Aliases []string
+
+	// Targets is the set of structs that the parameter applies to.
+	Targets ParamTarget
+
+	// Name is the human-readable name of the parameter, e.g. "width".
+	Name string
+
+	// Description describes the parameter.
+	Description string
+
+	// Validate validates the raw value of the parameter.
+	// If Validate is nil, any value is accepted.
+	Validate func(value string) error
+}
+
+// customParams is the registry of the parameters registered by RegisterParam.
+var customParams struct {
+	mu     sync.RWMutex
+	params map[paramKey]*Param
+}
+
+type paramKey struct {
+	target ParamTarget
+	key    string
+}
+
+// RegisterParam registers a custom parameter,
+// such as a beta feature of ImageFlux that this package doesn't support yet.
+//
+// The values of the custom parameters are stored in the Extra field
+// of Config, Overlay or Text as they appear in the URL.
+// Unknown keys that are not registered are ignored by ParseConfig and ParseOverlay
+// so that URLs using new parameters of ImageFlux can still be parsed,
+// but they are errors in texts and fonts, whose unknown keys ParseText has always rejected.
+// Register the parameter to keep it in configs and overlays, or to use it in texts.
+// RegisterParam returns an error if the key or an alias conflicts with another parameter.
+func RegisterParam(p Param) error {
+	if p.Targets == 0 || p.Targets&^(TargetConfig|TargetOverlay|TargetText) != 0 {
+		return fmt.Errorf("imageflux: invalid targets of parameter %q", p.Key)
+	}
+	keys := append([]string{p.Key}, p.Aliases...)
+	for _, key := range keys {
+		if key == "" || strings.ContainsAny(key, "=,/()%:") {
+			return fmt.Errorf("imageflux: invalid parameter key %q", key)
+		}
+	}
+
+	p.Aliases = slices.Clone(p.Aliases)
+	customParams.mu.Lock()
+	defer customParams.mu.Unlock()
+	for _, target := range paramTargets {
+		if p.Targets&target == 0 {
+			continue
+		}
+		for _, key := range keys {
+			if _, ok := builtinParamsByKey[paramKey{target, key}]; ok {
+				return fmt.Errorf("imageflux: parameter %q is already defined", key)
+			}
+			if _, ok := customParams.params[paramKey{target, key}]; ok {
+				return fmt.Errorf("imageflux: parameter %q is already defined", key)
+			}
+		}
+	}
+	if customParams.params == nil {
+		customParams.params = make(map[paramKey]*Param)
+	}
+	for _, target := range paramTargets {
+		if p.Targets&target == 0 {
+			continue
+		}
+		for _, key := range keys {
+			customParams.params[paramKey{target, key}] = &p
+		}
+	}
+	return nil
+}
+
+// LookupParam returns the definition of the parameter for key in target.
+// key may be a deprecated alias.
+func LookupParam(key string, target ParamTarget) (Param, bool) {
+	if def, ok := builtinParamsByKey[paramKey{target, key}]; ok {
+		return def.param(target), true
+	}
+	if p, ok := lookupCustomParam(key, target); ok {
+		return *p, true
+	}
+	return Param{}, false
+}
+
+// Params returns the definitions of the parameters in target.
+// The built-in parameters come first in the order of serialization,
+// followed by the custom parameters sorted by key.
+func Params(target ParamTarget) []Param {
+	var params []Param
+	for _, def := range builtinParams {
+		if def.Targets&target != 0 {
+			params = append(params, def.param(target))
+		}
+	}
+
+	var custom []Param
+	seen := make(map[*Param]bool)
+	customParams.mu.RLock()
+	for k, p := range customParams.params {
+		if k.target&target != 0 && !seen[p] {
+			seen[p] = true
+			custom = append(custom, *p)
+		}
+	}
+	customParams.mu.RUnlock()
+	slices.SortFunc(custom, func(a, b Param) int {
+		return strings.Compare(a.Key, b.Key)
+	})
+	return append(params, custom...)
+}
+
+func lookupCustomParam(key string, target ParamTarget) (*Param, bool) {
+	customParams.mu.RLock()
+	defer customParams.mu.RUnlock()
+	p, ok := customParams.params[paramKey{target, key}]
+	return p, ok
+}
+
+// setExtra validates the value of the custom parameter and stores it into extra.
+// It returns false if key is not a custom parameter.
+func setExtra(extra *map[string]string, warnings *[]string, target ParamTarget, key, value string) (bool, error) {
+	p, ok := lookupCustomParam(key, target)
+	if !ok {
+		return false, nil
+	}
+	if p.Validate != nil {
+		if err := p.Validate(value); err != nil {
+			return true, fmt.Errorf("imageflux: invalid %s %q: %w", p.Key, value, err)
+		}
+	}
+	if key != p.Key && warnings != nil {
+		*warnings = append(*warnings, deprecatedKeyWarning(key, p.Key))
+	}
+	if *extra == nil {
+		*extra = make(map[string]string)
+	}
+	(*extra)[p.Key] = value
+	return true, nil
+}
+
+// appendExtra appends the custom parameters sorted by key.
+func appendExtra(buf []byte, extra map[string]string) []byte {
+	if len(extra) == 0 {
+		return buf
+	}
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		buf = append(buf, key...)
+		buf = append(buf, '=')
+		buf = append(buf, extra[key]...)
+		buf = appendComma(buf)
+	}
+	return buf
+}
+
+func deprecatedKeyWarning(key, canonical string) string {
+	return fmt.Sprintf("deprecated key %q is used, use %q instead", key, canonical)
+}
+
+func deprecatedFormatWarning(format, canonical Format) string {
+	return fmt.Sprintf("deprecated format %q is used, use %q instead", format, canonical)
+}
@@ -0,0 +1,1880 @@
+package imageflux
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// paramDef is the definition of a built-in parameter.
+// It has the functions to serialize and parse the parameter for each target.
+// The append functions append "key=value" followed by a comma,
+// or nothing if the value is the default.
+// The parse functions may be nil if the parameter is handled by the parser itself.
+// The explain functions describe the value of the parameter for Explain,
+// or return nil if the value is the default.
+type paramDef struct {
+	Param
+
+	// stage is the processing stage of the parameter used by Explain.
+	stage           string
+	explainGeometry func(g *geometry) []Step
+	explainPosition func(p *position) []Step
+	explainConfig   func(c *Config) []Step
+	explainText     func(t *Text) []Step
+
+	appendConfig func(buf []byte, c *Config) []byte
+	parseConfig  func(s *parseState, value string) error
+
+	appendOverlay func(buf []byte, o *Overlay) []byte
+	parseOverlay  func(s *overlayParseState, value string) error
+
+	appendText func(buf []byte, t *Text) []byte
+	parseText  func(s *textParseState, value string) error
+}
+
+// param returns the definition of the parameter for target.
+func (def *paramDef) param(target ParamTarget) Param {
+	p := def.Param
+	switch target {
+	case TargetConfig:
+		if parse := def.parseConfig; parse != nil {
+			p.Validate = func(value string) error {
+				s := parseState{config: &Config{}, allowExpired: true}
+				return parse(&s, value)
+			}
+		}
+	case TargetOverlay:
+		if parse := def.parseOverlay; parse != nil {
+			p.Validate = func(value string) error {
+				s := overlayParseState{overlay: &Overlay{}}
+				return parse(&s, value)
+			}
+		}
+	case TargetText:
+		if parse := def.parseText; parse != nil {
+			p.Validate = func(value string) error {
+				s := textParseState{text: &Text{}}
+				return parse(&s, value)
+			}
+		}
+	}
+	return p
+}
+
+var paramTargets = []ParamTarget{TargetConfig, TargetOverlay, TargetText}
+
+// builtinParams is the table of the built-in parameters.
+// Config, Overlay and Text are serialized in the order of this table.
+var builtinParams = []*paramDef{
+	// the parameters of Config and Overlay.
+	{
+		Param: Param{
+			Key:         "w",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "width",
+			Description: "the width in pixel of the scaled image.",
+		},
+		stage: "resize",
+		explainGeometry: func(g *geometry) []Step {
+			return describePixels(g.width)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "w", c.Width)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.Width, err = parseSize("width", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "w", o.Width)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.Width, err = parseSize("width", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "h",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "height",
+			Description: "the height in pixel of the scaled image.",
+		},
+		stage: "resize",
+		explainGeometry: func(g *geometry) []Step {
+			return describePixels(g.height)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "h", c.Height)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.Height, err = parseSize("height", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "h", o.Height)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.Height, err = parseSize("height", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "expires",
+			Targets:     TargetConfig,
+			Name:        "expires",
+			Description: "the time when the URL expires, in RFC 3339 format.",
+		},
+		stage: "expires",
+		explainConfig: func(c *Config) []Step {
+			if c.Expires.IsZero() {
+				return nil
+			}
+			return describe(c.Expires.In(time.UTC).Format(time.RFC3339))
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			if c.Expires.IsZero() {
+				return buf
+			}
+			buf = append(buf, "expires="...)
+			buf = c.Expires.In(time.UTC).Truncate(time.Second).AppendFormat(buf, time.RFC3339)
+			return appendComma(buf)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			expires, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid expires %q", value)
+			}
+			expires = expires.Truncate(time.Second)
+			if !s.allowExpired && !expires.After(nowFunc()) {
+				return ErrExpired
+			}
+			s.config.Expires = expires
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "u",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "enlarge",
+			Description: "0 disables enlarging the image.",
+		},
+		stage: "resize",
+		explainGeometry: func(g *geometry) []Step {
+			if !g.disableEnlarge {
+				return nil
+			}
+			return describe("disabled")
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendFlagParam(buf, "u=0", c.DisableEnlarge)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			v, err := parseBoolean(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid disable enlarge %q: %w", value, err)
+			}
+			s.config.DisableEnlarge = !v
+			return nil
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendFlagParam(buf, "u=0", o.DisableEnlarge)
+		},
+		parseOverlay: func(s *overlayParseState, value string) error {
+			v, err := parseBoolean(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid disable enlarge %q: %w", value, err)
+			}
+			s.overlay.DisableEnlarge = !v
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "a",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "aspect mode",
+			Description: "how to keep the aspect ratio: 0 scale, 1 force scale, 2 crop, 3 pad.",
+		},
+		stage: "resize",
+		explainGeometry: func(g *geometry) []Step {
+			if g.aspectMode == AspectModeDefault {
+				return nil
+			}
+			return describe(g.aspectMode.String())
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendAspectModeParam(buf, c.AspectMode)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.AspectMode, err = parseAspectMode(value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendAspectModeParam(buf, o.AspectMode)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.AspectMode, err = parseAspectMode(value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "dpr",
+			Targets:     TargetConfig,
+			Name:        "device pixel ratio",
+			Description: "the scale factor applied to the width and the height.",
+		},
+		stage: "resize",
+		explainConfig: func(c *Config) []Step {
+			if c.DevicePixelRatio == 0 {
+				return nil
+			}
+			return describe(formatFloat(c.DevicePixelRatio))
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendFloatParam(buf, "dpr", c.DevicePixelRatio)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			dpr, err := strconv.ParseFloat(value, 64)
+			if err != nil || dpr <= 0 || math.IsNaN(dpr) || math.IsInf(dpr, 0) {
+				return fmt.Errorf("imageflux: invalid device pixel ratio %q", value)
+			}
+			s.config.DevicePixelRatio = dpr
+			return nil
+		},
+	},
+
+	// clipping parameters
+	{
+		Param: Param{
+			Key:         "ic",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "input clip",
+			Description: "the clipping area in pixel of the input image.",
+		},
+		stage: "input clip",
+		explainGeometry: func(g *geometry) []Step {
+			return describeClip(g.inputClip)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendRectParam(buf, "ic", c.InputClip)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.InputClip, err = parseRect("input clip", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendRectParam(buf, "ic", o.InputClip)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.InputClip, err = parseRect("input clip", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "icr",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "input clip ratio",
+			Description: "the clipping area in ratio of the input image.",
+		},
+		stage: "input clip",
+		explainGeometry: func(g *geometry) []Step {
+			return describeClipRatio(g.inputClipRatio, g.clipMax)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendRectRatioParam(buf, "icr", c.InputClipRatio, c.ClipMax)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			icr, err := parseRectRatio("input clip ratio", value)
+			if err != nil {
+				return err
+			}
+			s.config.InputClipRatio = icr
+			s.config.ClipMax = image.Pt(rectangleScale, rectangleScale)
+			return nil
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendRectRatioParam(buf, "icr", o.InputClipRatio, o.ClipMax)
+		},
+		parseOverlay: func(s *overlayParseState, value string) error {
+			icr, err := parseRectRatio("input clip ratio", value)
+			if err != nil {
+				return err
+			}
+			s.overlay.InputClipRatio = icr
+			s.overlay.ClipMax = image.Pt(rectangleScale, rectangleScale)
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "ig",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "input origin",
+			Description: "the origin of the clipping area of the input image.",
+		},
+		stage: "input clip",
+		explainGeometry: func(g *geometry) []Step {
+			return describeOrigin(g.inputOrigin)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "ig", int(c.InputOrigin))
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.InputOrigin, err = parseOrigin("input origin", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "ig", int(o.InputOrigin))
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.InputOrigin, err = parseOrigin("input origin", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "oc",
+			Aliases:     []string{"c"},
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "output clip",
+			Description: "the clipping area in pixel of the output image.",
+		},
+		stage: "output clip",
+		explainGeometry: func(g *geometry) []Step {
+			return describeClip(g.outputClip)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendRectParam(buf, "oc", clipOrAlias(c.OutputClip, c.Clip))
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.OutputClip, err = parseRect("output clip", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendRectParam(buf, "oc", clipOrAlias(o.OutputClip, o.Clip))
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.OutputClip, err = parseRect("output clip", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "ocr",
+			Aliases:     []string{"cr"},
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "output clip ratio",
+			Description: "the clipping area in ratio of the output image.",
+		},
+		stage: "output clip",
+		explainGeometry: func(g *geometry) []Step {
+			return describeClipRatio(g.outputClipRatio, g.clipMax)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendRectRatioParam(buf, "ocr", clipOrAlias(c.OutputClipRatio, c.ClipRatio), c.ClipMax)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			ocr, err := parseRectRatio("output clip ratio", value)
+			if err != nil {
+				return err
+			}
+			s.config.OutputClipRatio = ocr
+			s.config.ClipMax = image.Pt(rectangleScale, rectangleScale)
+			return nil
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendRectRatioParam(buf, "ocr", clipOrAlias(o.OutputClipRatio, o.ClipRatio), o.ClipMax)
+		},
+		parseOverlay: func(s *overlayParseState, value string) error {
+			ocr, err := parseRectRatio("output clip ratio", value)
+			if err != nil {
+				return err
+			}
+			s.overlay.OutputClipRatio = ocr
+			s.overlay.ClipMax = image.Pt(rectangleScale, rectangleScale)
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "og",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "output origin",
+			Description: "the origin of the clipping area of the output image.",
+		},
+		stage: "output clip",
+		explainGeometry: func(g *geometry) []Step {
+			return describeOrigin(g.outputOrigin)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "og", int(c.OutputOrigin))
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.OutputOrigin, err = parseOrigin("output origin", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "og", int(o.OutputOrigin))
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.OutputOrigin, err = parseOrigin("output origin", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "g",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "origin",
+			Description: "the origin of cropping and padding.",
+		},
+		stage: "resize",
+		explainGeometry: func(g *geometry) []Step {
+			return describeOrigin(g.origin)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "g", int(c.Origin))
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.Origin, err = parseOrigin("origin", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "g", int(o.Origin))
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.Origin, err = parseOrigin("origin", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "b",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "background",
+			Description: "the background color of padding, in RRGGBB or RRGGBBAA.",
+		},
+		stage: "resize",
+		explainGeometry: func(g *geometry) []Step {
+			return describeColor(g.background)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendColorParam(buf, "b", c.Background)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			c, err := parseColor(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid background %q: %w", value, err)
+			}
+			s.config.Background = c
+			return nil
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendColorParam(buf, "b", o.Background)
+		},
+		parseOverlay: func(s *overlayParseState, value string) error {
+			c, err := parseColor(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid background %q: %w", value, err)
+			}
+			s.overlay.Background = c
+			return nil
+		},
+	},
+
+	// rotation
+	{
+		Param: Param{
+			Key:         "ir",
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "input rotate",
+			Description: "the rotation applied before processing, 1-8 or auto.",
+		},
+		stage: "input rotate",
+		explainGeometry: func(g *geometry) []Step {
+			return describeRotate(g.inputRotate)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendRotateParam(buf, "ir", c.InputRotate)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.InputRotate, err = parseRotate("input rotate", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendRotateParam(buf, "ir", o.InputRotate)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.InputRotate, err = parseRotate("input rotate", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "or",
+			Aliases:     []string{"r"},
+			Targets:     TargetConfig | TargetOverlay,
+			Name:        "output rotate",
+			Description: "the rotation applied after processing, 1-8 or auto.",
+		},
+		stage: "output rotate",
+		explainGeometry: func(g *geometry) []Step {
+			return describeRotate(g.outputRotate)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendRotateParam(buf, "or", rotateOrAlias(c.OutputRotate, c.Rotate))
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.OutputRotate, err = parseRotate("output rotate", value)
+			return
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendRotateParam(buf, "or", rotateOrAlias(o.OutputRotate, o.Rotate))
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.OutputRotate, err = parseRotate("output rotate", value)
+			return
+		},
+	},
+
+	{
+		Param: Param{
+			Key:         "through",
+			Targets:     TargetConfig,
+			Name:        "through",
+			Description: "the formats passed through without conversion, e.g. jpg:png:gif.",
+		},
+		stage: "through",
+		explainConfig: func(c *Config) []Step {
+			if c.Through == 0 {
+				return nil
+			}
+			return describe(strings.ReplaceAll(c.Through.String(), ":", ", "))
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			if c.Through == 0 {
+				return buf
+			}
+			buf = append(buf, "through="...)
+			buf = c.Through.append(buf)
+			return appendComma(buf)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			t, err := parseThrough(value)
+			if err != nil {
+				return err
+			}
+			s.config.Through = t
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "l",
+			Targets:     TargetConfig,
+			Name:        "overlay",
+			Description: "an overlay image, l=(parameters/path).",
+		},
+		stage: "overlay",
+		explainConfig: func(c *Config) []Step {
+			var steps []Step
+			for _, o := range c.Overlays {
+				if o == nil {
+					continue
+				}
+				path := o.Path
+				if path == "" {
+					path = o.URL
+				}
+				steps = append(steps, Step{Description: strconv.Quote(path), Steps: o.Explain()})
+			}
+			return steps
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			for _, overlay := range c.Overlays {
+				buf = append(buf, "l=("...)
+				buf = overlay.append(buf)
+				buf = append(buf, ')')
+				buf = appendComma(buf)
+			}
+			return buf
+		},
+		parseConfig: func(s *parseState, value string) error {
+			if len(value) < 2 || value[0] != '(' || value[len(value)-1] != ')' {
+				return fmt.Errorf("imageflux: invalid overlays %q", value)
+			}
+			state := overlayParseState{
+				Tokenizer: newNestedTokenizer(value[1:len(value)-1], modeOverlay),
+				overlay:   &Overlay{},
+			}
+			overlay, err := state.parseOverlay()
+			if err != nil {
+				return err
+			}
+			s.config.Overlays = append(s.config.Overlays, overlay)
+			s.warnings = append(s.warnings, state.warnings...)
+			return nil
+		},
+	},
+
+	// output formats
+	{
+		Param: Param{
+			Key:         "f",
+			Targets:     TargetConfig,
+			Name:        "format",
+			Description: "the format of the output image.",
+		},
+		stage: "output",
+		explainConfig: func(c *Config) []Step {
+			format := c.Format
+			if format == "" {
+				format = FormatAuto
+			}
+			return describe(format.String())
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			if c.Format == "" {
+				return buf
+			}
+			buf = append(buf, "f="...)
+			buf = append(buf, c.Format...)
+			return appendComma(buf)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			f, err := newFormat(value)
+			if err != nil {
+				return err
+			}
+			if f == FormatWebPFromJPEG {
+				s.warnings = append(s.warnings, deprecatedFormatWarning(f, FormatWebPJPEG))
+			}
+			s.config.Format = f
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "q",
+			Targets:     TargetConfig,
+			Name:        "quality",
+			Description: "the quality of JPEG and WebP, 0-100.",
+		},
+		stage: "output",
+		explainConfig: func(c *Config) []Step {
+			if c.Quality == 0 {
+				return nil
+			}
+			return describe(strconv.Itoa(c.Quality))
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "q", c.Quality)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.Quality, err = parsePercent("quality", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "o",
+			Targets:     TargetConfig,
+			Name:        "optimization",
+			Description: "0 disables optimizing the Huffman coding table of JPEG.",
+		},
+		stage: "output",
+		explainConfig: func(c *Config) []Step {
+			if !c.DisableOptimization {
+				return nil
+			}
+			return describe("disabled")
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendFlagParam(buf, "o=0", c.DisableOptimization)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			v, err := parseBoolean(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid optimization %q: %w", value, err)
+			}
+			s.config.DisableOptimization = !v
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "lossless",
+			Targets:     TargetConfig,
+			Name:        "lossless",
+			Description: "1 enables lossless compression of WebP.",
+		},
+		stage: "output",
+		explainConfig: func(c *Config) []Step {
+			return describeFlag(c.Lossless)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendFlagParam(buf, "lossless=1", c.Lossless)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.Lossless, err = parseBooleanParam("lossless", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "s",
+			Targets:     TargetConfig,
+			Name:        "exif option",
+			Description: "the Exif information kept in the output image.",
+		},
+		stage: "output",
+		explainConfig: func(c *Config) []Step {
+			switch c.ExifOption {
+			case ExifOptionDefault:
+				return nil
+			case ExifOptionStrip:
+				return describe("strip")
+			case ExifOptionKeepOrientation:
+				return describe("strip except orientation")
+			}
+			return describe(fmt.Sprintf("invalid(%d)", int(c.ExifOption)))
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "s", int(c.ExifOption))
+		},
+		parseConfig: func(s *parseState, value string) error {
+			v, err := strconv.Atoi(value)
+			if err != nil || ExifOption(v) < exifOptionMin || ExifOption(v) >= exifOptionMax {
+				return fmt.Errorf("imageflux: invalid exif option %q", value)
+			}
+			s.config.ExifOption = ExifOption(v)
+			return nil
+		},
+	},
+
+	// image filters
+	{
+		Param: Param{
+			Key:         "unsharp",
+			Targets:     TargetConfig,
+			Name:        "unsharp",
+			Description: "the unsharp mask, RxS[+G+T].",
+		},
+		stage: "filter",
+		explainConfig: func(c *Config) []Step {
+			if c.Unsharp.Radius == 0 {
+				return nil
+			}
+			desc := fmt.Sprintf("radius %d px, sigma %s", c.Unsharp.Radius, formatFloat(c.Unsharp.Sigma))
+			if c.Unsharp.Threshold != 0 {
+				desc += fmt.Sprintf(", gain %s, threshold %s", formatFloat(c.Unsharp.Gain), formatFloat(c.Unsharp.Threshold))
+			}
+			return describe(desc)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			if c.Unsharp.Radius == 0 {
+				return buf
+			}
+			buf = append(buf, "unsharp="...)
+			buf = c.Unsharp.append(buf)
+			return appendComma(buf)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			unsharp, err := parseUnsharp(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid unsharp %q", value)
+			}
+			s.config.Unsharp = unsharp
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "blur",
+			Targets:     TargetConfig,
+			Name:        "blur",
+			Description: "the gaussian blur, RxS.",
+		},
+		stage: "filter",
+		explainConfig: func(c *Config) []Step {
+			if c.Blur.Radius == 0 {
+				return nil
+			}
+			return describe(fmt.Sprintf("radius %d px, sigma %s", c.Blur.Radius, formatFloat(c.Blur.Sigma)))
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			if c.Blur.Radius == 0 {
+				return buf
+			}
+			buf = append(buf, "blur="...)
+			buf = c.Blur.append(buf)
+			return appendComma(buf)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			blur, err := parseBlur(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid blur %q", value)
+			}
+			s.config.Blur = blur
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "grayscale",
+			Targets:     TargetConfig,
+			Name:        "grayscale",
+			Description: "the strength of grayscale conversion, 0-100.",
+		},
+		stage: "filter",
+		explainConfig: func(c *Config) []Step {
+			if c.GrayScale == 0 {
+				return nil
+			}
+			return describe(strconv.Itoa(c.GrayScale) + "%")
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "grayscale", c.GrayScale)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.GrayScale, err = parsePercent("grayscale", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "sepia",
+			Targets:     TargetConfig,
+			Name:        "sepia",
+			Description: "the strength of sepia conversion, 0-100.",
+		},
+		stage: "filter",
+		explainConfig: func(c *Config) []Step {
+			if c.Sepia == 0 {
+				return nil
+			}
+			return describe(strconv.Itoa(c.Sepia) + "%")
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendIntParam(buf, "sepia", c.Sepia)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.Sepia, err = parsePercent("sepia", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "brightness",
+			Targets:     TargetConfig,
+			Name:        "brightness",
+			Description: "the brightness in percent, 100 keeps the original.",
+		},
+		stage: "filter",
+		explainConfig: func(c *Config) []Step {
+			if c.Brightness == 0 {
+				return nil
+			}
+			return describe(strconv.Itoa(c.Brightness+100) + "%")
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			if c.Brightness == 0 {
+				return buf
+			}
+			return appendInt(buf, "brightness", c.Brightness+100)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			brightness, err := strconv.Atoi(value)
+			if err != nil || brightness < 0 {
+				return fmt.Errorf("imageflux: invalid brightness %q", value)
+			}
+			s.config.Brightness = brightness - 100
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "contrast",
+			Targets:     TargetConfig,
+			Name:        "contrast",
+			Description: "the contrast in percent, 100 keeps the original.",
+		},
+		stage: "filter",
+		explainConfig: func(c *Config) []Step {
+			if c.Contrast == 0 {
+				return nil
+			}
+			return describe(strconv.Itoa(c.Contrast+100) + "%")
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			if c.Contrast == 0 {
+				return buf
+			}
+			return appendInt(buf, "contrast", c.Contrast+100)
+		},
+		parseConfig: func(s *parseState, value string) error {
+			contrast, err := strconv.Atoi(value)
+			if err != nil || contrast < 0 {
+				return fmt.Errorf("imageflux: invalid contrast %q", value)
+			}
+			s.config.Contrast = contrast - 100
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "invert",
+			Targets:     TargetConfig,
+			Name:        "invert",
+			Description: "1 inverts the colors of the image.",
+		},
+		stage: "filter",
+		explainConfig: func(c *Config) []Step {
+			return describeFlag(c.Invert)
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			return appendFlagParam(buf, "invert=1", c.Invert)
+		},
+		parseConfig: func(s *parseState, value string) (err error) {
+			s.config.Invert, err = parseBooleanParam("invert", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "t",
+			Targets:     TargetConfig,
+			Name:        "text",
+			Description: "a text overlay, t=(parameters,text=...).",
+		},
+		stage: "text",
+		explainConfig: func(c *Config) []Step {
+			var steps []Step
+			for _, t := range c.Texts {
+				if t == nil {
+					continue
+				}
+				steps = append(steps, Step{Description: strconv.Quote(t.Text), Steps: t.Explain()})
+			}
+			return steps
+		},
+		appendConfig: func(buf []byte, c *Config) []byte {
+			for _, text := range c.Texts {
+				buf = append(buf, "t=("...)
+				buf = text.append(buf)
+				buf = append(buf, ')')
+				buf = appendComma(buf)
+			}
+			return buf
+		},
+		parseConfig: func(s *parseState, value string) error {
+			if len(value) < 2 || value[0] != '(' || value[len(value)-1] != ')' {
+				return fmt.Errorf("imageflux: invalid texts %q", value)
+			}
+			text, err := ParseText(value[1 : len(value)-1])
+			if err != nil {
+				return err
+			}
+			s.config.Texts = append(s.config.Texts, text)
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "sig",
+			Targets:     TargetConfig,
+			Name:        "signature",
+			Description: "the signature of the URL.",
+		},
+		stage: "output",
+		// the signature is appended by Image, not by Config.
+		parseConfig: func(s *parseState, value string) error {
+			// if signature is already set, ignore this
+			if s.signature == "" {
+				s.signature = value
+			}
+			return nil
+		},
+	},
+
+	// the parameters of Text.
+	{
+		Param: Param{
+			Key:         "font",
+			Targets:     TargetText,
+			Name:        "font",
+			Description: "the font of the text.",
+		},
+		stage: "font",
+		explainText: func(t *Text) []Step {
+			if t.Font == nil || t.Font.Name == "" {
+				return nil
+			}
+			desc := strconv.Quote(t.Font.Name)
+			if len(t.Font.Variables) > 0 {
+				tags := make([]string, 0, len(t.Font.Variables))
+				for tag := range t.Font.Variables {
+					tags = append(tags, tag)
+				}
+				slices.Sort(tags)
+				for _, tag := range tags {
+					desc += " " + tag + "=" + formatFloat(t.Font.Variables[tag])
+				}
+			} else if t.Font.Instance != "" {
+				desc += " " + strconv.Quote(t.Font.Instance)
+			}
+			return describe(desc)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			buf = append(buf, "font="...)
+			buf = t.Font.append(buf)
+			return appendComma(buf)
+		},
+		parseText: func(s *textParseState, value string) error {
+			font, err := ParseFont(value)
+			if err != nil {
+				// the errors of ParseFont describe the font specification by themselves.
+				return err
+			}
+			s.text.Font = font
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "size",
+			Targets:     TargetText,
+			Name:        "size",
+			Description: "the font size of the text.",
+		},
+		stage: "font",
+		explainText: func(t *Text) []Step {
+			if t.Size == 0 {
+				return nil
+			}
+			return describe(formatFloat(t.Size))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			buf = append(buf, "size="...)
+			buf = strconv.AppendFloat(buf, t.Size, 'f', -1, 64)
+			return appendComma(buf)
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Size, err = parseTextFloat("size", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "f",
+			Targets:     TargetText,
+			Name:        "foreground",
+			Description: "the color of the text, in RRGGBB or RRGGBBAA.",
+		},
+		stage: "font",
+		explainText: func(t *Text) []Step {
+			return describeColor(t.Foreground)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendColorParam(buf, "f", t.Foreground)
+		},
+		parseText: func(s *textParseState, value string) error {
+			c, err := parseColor(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid foreground %q: %w", value, err)
+			}
+			s.text.Foreground = c
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "b",
+			Targets:     TargetText,
+			Name:        "background",
+			Description: "the background color of the text, in RRGGBB or RRGGBBAA.",
+		},
+		stage: "box",
+		explainText: func(t *Text) []Step {
+			return describeColor(t.Background)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendColorParam(buf, "b", t.Background)
+		},
+		parseText: func(s *textParseState, value string) error {
+			c, err := parseColor(value)
+			if err != nil {
+				return fmt.Errorf("imageflux: invalid background %q: %w", value, err)
+			}
+			s.text.Background = c
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "w",
+			Targets:     TargetText,
+			Name:        "width",
+			Description: "the width in pixel of the text box.",
+		},
+		stage: "box",
+		explainText: func(t *Text) []Step {
+			return describePixels(t.Width)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			buf = append(buf, "w="...)
+			buf = strconv.AppendInt(buf, int64(t.Width), 10)
+			return appendComma(buf)
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Width, err = parseTextInt("width", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "h",
+			Targets:     TargetText,
+			Name:        "height",
+			Description: "the height in pixel of the text box.",
+		},
+		stage: "box",
+		explainText: func(t *Text) []Step {
+			return describePixels(t.Height)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			buf = append(buf, "h="...)
+			buf = strconv.AppendInt(buf, int64(t.Height), 10)
+			return appendComma(buf)
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Height, err = parseTextInt("height", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "linespacing",
+			Targets:     TargetText,
+			Name:        "line spacing",
+			Description: "the line spacing of the text.",
+		},
+		stage: "layout",
+		explainText: func(t *Text) []Step {
+			if t.LineSpacing == 0 {
+				return nil
+			}
+			return describe(formatFloat(t.LineSpacing))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendFloatParam(buf, "linespacing", t.LineSpacing)
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.LineSpacing, err = parseTextFloat("line spacing", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "align",
+			Targets:     TargetText,
+			Name:        "align",
+			Description: "the alignment of the text: 0 left, 1 center, 2 right.",
+		},
+		stage: "layout",
+		explainText: func(t *Text) []Step {
+			switch t.Align {
+			case TextAlignLeft:
+				return nil
+			case TextAlignCenter:
+				return describe("center")
+			case TextAlignRight:
+				return describe("right")
+			}
+			return describe(fmt.Sprintf("invalid(%d)", int(t.Align)))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendIntParam(buf, "align", int(t.Align))
+		},
+		parseText: func(s *textParseState, value string) error {
+			align, err := parseTextInt("align", value)
+			s.text.Align = TextAlign(align)
+			return err
+		},
+	},
+	{
+		Param: Param{
+			Key:         "dir",
+			Targets:     TargetText,
+			Name:        "direction",
+			Description: "the direction of the text: 0 auto, 1 left to right, 2 right to left.",
+		},
+		stage: "layout",
+		explainText: func(t *Text) []Step {
+			switch t.Direction {
+			case TextDirectionAuto:
+				return nil
+			case TextDirectionLTR:
+				return describe("left to right")
+			case TextDirectionRTL:
+				return describe("right to left")
+			}
+			return describe(fmt.Sprintf("invalid(%d)", int(t.Direction)))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendIntParam(buf, "dir", int(t.Direction))
+		},
+		parseText: func(s *textParseState, value string) error {
+			dir, err := parseTextInt("direction", value)
+			s.text.Direction = TextDirection(dir)
+			return err
+		},
+	},
+	{
+		Param: Param{
+			Key:         "wrap",
+			Targets:     TargetText,
+			Name:        "wrap",
+			Description: "the wrap mode of the text: 0 line, 1 char, 2 line and char.",
+		},
+		stage: "layout",
+		explainText: func(t *Text) []Step {
+			switch t.Wrap {
+			case TextWrapLine:
+				return nil
+			case TextWrapChar:
+				return describe("at any character")
+			case TextWrapLineChar:
+				return describe("at line breaks, or any character if needed")
+			}
+			return describe(fmt.Sprintf("invalid(%d)", int(t.Wrap)))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendIntParam(buf, "wrap", int(t.Wrap))
+		},
+		parseText: func(s *textParseState, value string) error {
+			wrap, err := parseTextInt("wrap", value)
+			s.text.Wrap = TextWrap(wrap)
+			return err
+		},
+	},
+	{
+		Param: Param{
+			Key:         "ellipsize",
+			Targets:     TargetText,
+			Name:        "ellipsize",
+			Description: "1 ellipsizes the overflowed text.",
+		},
+		stage: "layout",
+		explainText: func(t *Text) []Step {
+			return describeFlag(t.Ellipsize)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendFlagParam(buf, "ellipsize=1", t.Ellipsize)
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Ellipsize, err = parseBooleanParam("ellipsize value", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "justify",
+			Targets:     TargetText,
+			Name:        "justify",
+			Description: "1 justifies the text.",
+		},
+		stage: "layout",
+		explainText: func(t *Text) []Step {
+			return describeFlag(t.Justify)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendFlagParam(buf, "justify=1", t.Justify)
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Justify, err = parseBooleanParam("justify value", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "strike",
+			Targets:     TargetText,
+			Name:        "strike",
+			Description: "1 strikes through the text.",
+		},
+		stage: "layout",
+		explainText: func(t *Text) []Step {
+			return describeFlag(t.Strike)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendFlagParam(buf, "strike=1", t.Strike)
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Strike, err = parseBooleanParam("strike value", value)
+			return
+		},
+	},
+
+	// the parameters of Overlay and Text.
+	{
+		Param: Param{
+			Key:         "x",
+			Targets:     TargetOverlay | TargetText,
+			Name:        "offset x",
+			Description: "the horizontal offset in pixel of the overlay.",
+		},
+		stage: "position",
+		explainPosition: func(p *position) []Step {
+			return describePixels(p.offset.X)
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "x", o.Offset.X)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendIntParam(buf, "x", t.Offset.X)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.Offset.X, err = parseOffset("offset x", value)
+			return
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Offset.X, err = parseOffset("offset x", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "y",
+			Targets:     TargetOverlay | TargetText,
+			Name:        "offset y",
+			Description: "the vertical offset in pixel of the overlay.",
+		},
+		stage: "position",
+		explainPosition: func(p *position) []Step {
+			return describePixels(p.offset.Y)
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "y", o.Offset.Y)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendIntParam(buf, "y", t.Offset.Y)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.Offset.Y, err = parseOffset("offset y", value)
+			return
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.Offset.Y, err = parseOffset("offset y", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "xr",
+			Targets:     TargetOverlay | TargetText,
+			Name:        "offset x ratio",
+			Description: "the horizontal offset in ratio of the overlay.",
+		},
+		stage: "position",
+		explainPosition: func(p *position) []Step {
+			if p.offsetMax.X == 0 {
+				return nil
+			}
+			return describe(formatPercent(p.offsetRatio.X, p.offsetMax.X) + " of the image")
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			if o.OffsetMax.X == 0 {
+				return buf
+			}
+			return appendFloat(buf, "xr", float64(o.OffsetRatio.X)/float64(o.OffsetMax.X))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			if t.OffsetMax.X == 0 {
+				return buf
+			}
+			return appendFloat(buf, "xr", float64(t.OffsetRatio.X)/float64(t.OffsetMax.X))
+		},
+		parseOverlay: func(s *overlayParseState, value string) error {
+			v, err := parseOffsetRatio("offset x ratio", value)
+			if err != nil {
+				return err
+			}
+			s.overlay.OffsetRatio.X = v
+			s.overlay.OffsetMax.X = rectangleScale
+			return nil
+		},
+		parseText: func(s *textParseState, value string) error {
+			v, err := parseOffsetRatio("offset x ratio", value)
+			if err != nil {
+				return err
+			}
+			s.text.OffsetRatio.X = v
+			s.text.OffsetMax.X = rectangleScale
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "yr",
+			Targets:     TargetOverlay | TargetText,
+			Name:        "offset y ratio",
+			Description: "the vertical offset in ratio of the overlay.",
+		},
+		stage: "position",
+		explainPosition: func(p *position) []Step {
+			if p.offsetMax.Y == 0 {
+				return nil
+			}
+			return describe(formatPercent(p.offsetRatio.Y, p.offsetMax.Y) + " of the image")
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			if o.OffsetMax.Y == 0 {
+				return buf
+			}
+			return appendFloat(buf, "yr", float64(o.OffsetRatio.Y)/float64(o.OffsetMax.Y))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			if t.OffsetMax.Y == 0 {
+				return buf
+			}
+			return appendFloat(buf, "yr", float64(t.OffsetRatio.Y)/float64(t.OffsetMax.Y))
+		},
+		parseOverlay: func(s *overlayParseState, value string) error {
+			v, err := parseOffsetRatio("offset y ratio", value)
+			if err != nil {
+				return err
+			}
+			s.overlay.OffsetRatio.Y = v
+			s.overlay.OffsetMax.Y = rectangleScale
+			return nil
+		},
+		parseText: func(s *textParseState, value string) error {
+			v, err := parseOffsetRatio("offset y ratio", value)
+			if err != nil {
+				return err
+			}
+			s.text.OffsetRatio.Y = v
+			s.text.OffsetMax.Y = rectangleScale
+			return nil
+		},
+	},
+	{
+		Param: Param{
+			Key:         "lg",
+			Targets:     TargetOverlay | TargetText,
+			Name:        "overlay origin",
+			Description: "the origin of the offset of the overlay.",
+		},
+		stage: "position",
+		explainPosition: func(p *position) []Step {
+			return describeOrigin(p.origin)
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendIntParam(buf, "lg", int(o.OverlayOrigin))
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendIntParam(buf, "lg", int(t.OverlayOrigin))
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.OverlayOrigin, err = parseOrigin("overlay origin", value)
+			return
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.OverlayOrigin, err = parseOrigin("overlay origin", value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "mask",
+			Targets:     TargetOverlay | TargetText,
+			Name:        "mask",
+			Description: "the mask type and the padding mode of the overlay, type[:padding].",
+		},
+		stage: "mask",
+		explainPosition: func(p *position) []Step {
+			if p.maskType == "" {
+				return nil
+			}
+			desc := string(p.maskType)
+			if p.paddingMode == PaddingModeLeave {
+				desc += ", leaving the overflow area"
+			}
+			return describe(desc)
+		},
+		appendOverlay: func(buf []byte, o *Overlay) []byte {
+			return appendMaskParam(buf, o.MaskType, o.PaddingMode)
+		},
+		appendText: func(buf []byte, t *Text) []byte {
+			return appendMaskParam(buf, t.MaskType, t.PaddingMode)
+		},
+		parseOverlay: func(s *overlayParseState, value string) (err error) {
+			s.overlay.MaskType, s.overlay.PaddingMode, err = parseMask(value)
+			return
+		},
+		parseText: func(s *textParseState, value string) (err error) {
+			s.text.MaskType, s.text.PaddingMode, err = parseMask(value)
+			return
+		},
+	},
+	{
+		Param: Param{
+			Key:         "text",
+			Targets:     TargetText,
+			Name:        "text",
+			Description: "the text string. It must be the last parameter.",
+		},
+		stage: "text",
+		// text MUST be the last parameter because it can contain any character.
+		// It is read by the tokenizer in modeText, and parsed by textParseState.parseText.
+		appendText: func(buf []byte, t *Text) []byte {
+			buf = append(buf, "text="...)
+			return append(buf, url.PathEscape(t.Text)...)
+		},
+	},
+}
+
+var (
+	// builtinParamsByKey maps the keys and the aliases to the built-in parameters.
+	builtinParamsByKey = map[paramKey]*paramDef{}
+
+	// configParams, overlayParams and textParams are the built-in parameters of each target.
+	configParams  []*paramDef
+	overlayParams []*paramDef
+	textParams    []*paramDef
+)
+
+func init() {
+	for _, def := range builtinParams {
+		for _, target := range paramTargets {
+			if def.Targets&target == 0 {
+				continue
+			}
+			for _, key := range append([]string{def.Key}, def.Aliases...) {
+				k := paramKey{target, key}
+				if _, ok := builtinParamsByKey[k]; ok {
+					panic("imageflux: duplicated parameter " + key)
+				}
+				builtinParamsByKey[k] = def
+			}
+		}
+		if def.Targets&TargetConfig != 0 {
+			configParams = append(configParams, def)
+		}
+		if def.Targets&TargetOverlay != 0 {
+			overlayParams = append(overlayParams, def)
+		}
+		if def.Targets&TargetText != 0 {
+			textParams = append(textParams, def)
+		}
+	}
+}
+
+// appendIntParam appends the integer parameter if v is not zero.
+func appendIntParam(buf []byte, key string, v int) []byte {
+	if v == 0 {
+		return buf
+	}
+	return appendInt(buf, key, v)
+}
+
+func appendInt(buf []byte, key string, v int) []byte {
+	buf = append(buf, key...)
+	buf = append(buf, '=')
+	buf = strconv.AppendInt(buf, int64(v), 10)
+	return appendComma(buf)
+}
+
+// appendFloatParam appends the float parameter if v is not zero.
+func appendFloatParam(buf []byte, key string, v float64) []byte {
+	if v == 0 {
+		return buf
+	}
+	return appendFloat(buf, key, v)
+}
+
+func appendFloat(buf []byte, key string, v float64) []byte {
+	buf = append(buf, key...)
+	buf = append(buf, '=')
+	buf = strconv.AppendFloat(buf, v, 'f', -1, 64)
+	return appendComma(buf)
+}
+
+// appendFlagParam appends param if the flag is set.
+func appendFlagParam(buf []byte, param string, flag bool) []byte {
+	if !flag {
+		return buf
+	}
+	buf = append(buf, param...)
+	return appendComma(buf)
+}
+
+func appendAspectModeParam(buf []byte, a AspectMode) []byte {
+	if a == AspectModeDefault {
+		return buf
+	}
+	buf = append(buf, "a="...)
+	buf = strconv.AppendInt(buf, int64(a-1), 10)
+	return appendComma(buf)
+}
+
+func appendRectParam(buf []byte, key string, r image.Rectangle) []byte {
+	if r == (image.Rectangle{}) {
+		return buf
+	}
+	buf = append(buf, key...)
+	buf = append(buf, '=')
+	buf = strconv.AppendInt(buf, int64(r.Min.X), 10)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(r.Min.Y), 10)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(r.Max.X), 10)
+	buf = append(buf, ':')
+	buf = strconv.AppendInt(buf, int64(r.Max.Y), 10)
+	return appendComma(buf)
+}
+
+func appendRectRatioParam(buf []byte, key string, r image.Rectangle, max image.Point) []byte {
+	if r == (image.Rectangle{}) || max == (image.Point{}) {
+		return buf
+	}
+	buf = append(buf, key...)
+	buf = append(buf, '=')
+	buf = strconv.AppendFloat(buf, float64(r.Min.X)/float64(max.X), 'f', -1, 64)
+	buf = append(buf, ':')
+	buf = strconv.AppendFloat(buf, float64(r.Min.Y)/float64(max.Y), 'f', -1, 64)
+	buf = append(buf, ':')
+	buf = strconv.AppendFloat(buf, float64(r.Max.X)/float64(max.X), 'f', -1, 64)
+	buf = append(buf, ':')
+	buf = strconv.AppendFloat(buf, float64(r.Max.Y)/float64(max.Y), 'f', -1, 64)
+	return appendComma(buf)
+}
+
+func appendColorParam(buf []byte, key string, c color.Color) []byte {
+	if c == nil {
+		return buf
+	}
+	nrgba := color.NRGBAModel.Convert(c).(color.NRGBA)
+	buf = append(buf, key...)
+	buf = append(buf, '=')
+	buf = appendByte(buf, nrgba.R)
+	buf = appendByte(buf, nrgba.G)
+	buf = appendByte(buf, nrgba.B)
+	if nrgba.A != 0xff {
+		buf = appendByte(buf, nrgba.A)
+	}
+	return appendComma(buf)
+}
+
+func appendRotateParam(buf []byte, key string, r Rotate) []byte {
+	if r == RotateDefault {
+		return buf
+	}
+	buf = append(buf, key...)
+	if r == RotateAuto {
+		buf = append(buf, "=auto"...)
+	} else {
+		buf = append(buf, '=')
+		buf = strconv.AppendInt(buf, int64(r), 10)
+	}
+	return appendComma(buf)
+}
+
+func appendMaskParam(buf []byte, mask MaskType, padding PaddingMode) []byte {
+	if mask == "" {
+		return buf
+	}
+	buf = append(buf, "mask="...)
+	buf = append(buf, mask...)
+	if padding != 0 {
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(padding), 10)
+	}
+	return appendComma(buf)
+}
+
+// clipOrAlias returns the clipping area, falling back to the deprecated alias.
+func clipOrAlias(r, alias image.Rectangle) image.Rectangle {
+	if r == (image.Rectangle{}) {
+		return alias
+	}
+	return r
+}
+
+// rotateOrAlias returns the rotation, falling back to the deprecated alias.
+func rotateOrAlias(r, alias Rotate) Rotate {
+	if r == RotateDefault {
+		return alias
+	}
+	return r
+}
+
+// parseSize parses a positive size in pixel.
+func parseSize(name, value string) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("imageflux: invalid %s %q: %w", name, value, err)
+	}
+	if v <= 0 {
+		return 0, fmt.Errorf("imageflux: invalid %s %q: validation error", name, value)
+	}
+	return v, nil
+}
+
+// parsePercent parses an integer between 0 and 100.
+func parsePercent(name, value string) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil || v < 0 || v > 100 {
+		return 0, fmt.Errorf("imageflux: invalid %s %q", name, value)
+	}
+	return v, nil
+}
+
+func parseBooleanParam(name, value string) (bool, error) {
+	v, err := parseBoolean(value)
+	if err != nil {
+		return false, fmt.Errorf("imageflux: invalid %s %q: %w", name, value, err)
+	}
+	return v, nil
+}
+
+func parseTextInt(name, value string) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("imageflux: invalid %s value %q: %w", name, value, err)
+	}
+	return v, nil
+}
+
+func parseTextFloat(name, value string) (float64, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("imageflux: invalid %s value %q: %w", name, value, err)
+	}
+	return v, nil
+}
+
+func parseAspectMode(value string) (AspectMode, error) {
+	a, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("imageflux: invalid aspect mode %q: %w", value, err)
+	}
+	if a < 0 || AspectMode(a+1) >= aspectModeMax {
+		return 0, fmt.Errorf("imageflux: invalid aspect mode %q: validation error", value)
+	}
+	return AspectMode(a + 1), nil
+}
+
+func parseOrigin(name, value string) (Origin, error) {
+	g, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("imageflux: invalid %s %q: %w", name, value, err)
+	}
+	if g < 0 || Origin(g) >= originMax {
+		return 0, fmt.Errorf("imageflux: invalid %s %q: validation error", name, value)
+	}
+	return Origin(g), nil
+}
+
+// parseOffset parses an offset in pixel. It may be negative.
+func parseOffset(name, value string) (int, error) {
+	v, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("imageflux: invalid %s %q: %w", name, value, err)
+	}
+	return v, nil
+}
+
+// parseOffsetRatio parses an offset in ratio, and returns it scaled by rectangleScale.
+func parseOffsetRatio(name, value string) (int, error) {
+	v, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0, fmt.Errorf("imageflux: invalid %s %q: %w", name, value, err)
+	}
+	if !(v >= 0 && v <= 1) {
+		return 0, fmt.Errorf("imageflux: invalid %s %q: validation error", name, value)
+	}
+	return int(math.Round(v * rectangleScale)), nil
+}
+
+// parseMask parses the mask parameter in the form of type[:padding].
+func parseMask(value string) (MaskType, PaddingMode, error) {
+	typ, padding, hasPadding := strings.Cut(value, ":")
+	mask := MaskType(typ)
+	switch mask {
+	case MaskTypeWhite, MaskTypeBlack, MaskTypeAlpha:
+	default:
+		return "", 0, fmt.Errorf("imageflux: invalid mask %q", value)
+	}
+	if !hasPadding {
+		return mask, PaddingModeDefault, nil
+	}
+	v, err := strconv.Atoi(padding)
+	if err != nil || (PaddingMode(v) != PaddingModeDefault && PaddingMode(v) != PaddingModeLeave) {
+		return "", 0, fmt.Errorf("imageflux: invalid mask %q", value)
+	}
+	return mask, PaddingMode(v), nil
+}
+
+func parseRotate(name, value string) (Rotate, error) {
+	if value == "auto" {
+		return RotateAuto, nil
+	}
+	r, err := strconv.Atoi(value)
+	if err != nil || Rotate(r) < rotateMin || Rotate(r) >= rotateMax {
+		return 0, fmt.Errorf("imageflux: invalid %s %q", name, value)
+	}
+	return Rotate(r), nil
+}
+
+// parseRect parses a rectangle in pixel, "minX:minY:maxX:maxY".
+func parseRect(name, value string) (image.Rectangle, error) {
+	v0, v1, v2, v3, ok := split4(value)
+	if !ok {
+		return image.Rectangle{}, fmt.Errorf("imageflux: invalid %s %q", name, value)
+	}
+	minX, err0 := strconv.Atoi(v0)
+	minY, err1 := strconv.Atoi(v1)
+	maxX, err2 := strconv.Atoi(v2)
+	maxY, err3 := strconv.Atoi(v3)
+	r := image.Rect(minX, minY, maxX, maxY)
+	if err0 != nil || err1 != nil || err2 != nil || err3 != nil || r == (image.Rectangle{}) {
+		return image.Rectangle{}, fmt.Errorf("imageflux: invalid %s %q", name, value)
+	}
+	return r, nil
+}
+
+// parseRectRatio parses a rectangle in ratio, "minX:minY:maxX:maxY".
+// The coordinates are scaled by rectangleScale.
+func parseRectRatio(name, value string) (image.Rectangle, error) {
+	v0, v1, v2, v3, ok := split4(value)
+	minX, err0 := strconv.ParseFloat(v0, 64)
+	minY, err1 := strconv.ParseFloat(v1, 64)
+	maxX, err2 := strconv.ParseFloat(v2, 64)
+	maxY, err3 := strconv.ParseFloat(v3, 64)
+	r := image.Rect(
+		int(math.Round(minX*rectangleScale)),
+		int(math.Round(minY*rectangleScale)),
+		int(math.Round(maxX*rectangleScale)),
+		int(math.Round(maxY*rectangleScale)),
+	)
+	ok = ok && err0 == nil && err1 == nil && err2 == nil && err3 == nil && r != (image.Rectangle{})
+	ok = ok && minX >= 0 && minX <= 1 && minY >= 0 && minY <= 1 && maxX >= 0 && maxX <= 1 && maxY >= 0 && maxY <= 1
+	if !ok {
+		return image.Rectangle{}, fmt.Errorf("imageflux: invalid %s %q", name, value)
+	}
+	return r, nil
+}
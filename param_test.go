@@ -0,0 +1,182 @@
+package imageflux
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestLookupParam(t *testing.T) {
+	tests := []struct {
+		key    string
+		target ParamTarget
+		want   string
+		ok     bool
+	}{
+		{"w", TargetConfig, "w", true},
+		{"c", TargetConfig, "oc", true},
+		{"cr", TargetOverlay, "ocr", true},
+		{"r", TargetOverlay, "or", true},
+		{"expires", TargetConfig, "expires", true},
+		{"expires", TargetOverlay, "", false},
+		{"font", TargetText, "font", true},
+		{"font", TargetConfig, "", false},
+		{"unknown", TargetConfig, "", false},
+	}
+	for _, tt := range tests {
+		p, ok := LookupParam(tt.key, tt.target)
+		if ok != tt.ok || p.Key != tt.want {
+			t.Errorf("LookupParam(%q, %d): want %q, %t, got %q, %t", tt.key, tt.target, tt.want, tt.ok, p.Key, ok)
+		}
+	}
+}
+
+func TestLookupParam_Validate(t *testing.T) {
+	tests := []struct {
+		key    string
+		target ParamTarget
+		value  string
+		valid  bool
+	}{
+		{"w", TargetConfig, "200", true},
+		{"w", TargetConfig, "0", false},
+		{"w", TargetText, "0", true},
+		{"q", TargetConfig, "101", false},
+		{"f", TargetConfig, "webp:auto", true},
+		{"f", TargetText, "webp:auto", false},
+		{"f", TargetText, "ff0000", true},
+		{"l", TargetConfig, "(w=100/logo.png)", true},
+		{"l", TargetConfig, "w=100/logo.png", false},
+	}
+	for _, tt := range tests {
+		p, ok := LookupParam(tt.key, tt.target)
+		if !ok {
+			t.Errorf("%q: not found", tt.key)
+			continue
+		}
+		err := p.Validate(tt.value)
+		if (err == nil) != tt.valid {
+			t.Errorf("%q=%q: want valid %t, got %v", tt.key, tt.value, tt.valid, err)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	var keys []string
+	for _, p := range Params(TargetOverlay) {
+		keys = append(keys, p.Key)
+	}
+	want := []string{"w", "h", "u", "a", "ic", "icr", "ig", "oc", "ocr", "og", "g", "b", "ir", "or", "x", "y", "xr", "yr", "lg", "mask"}
+	if diff := cmp.Diff(want, keys[:len(want)]); diff != "" {
+		t.Errorf("keys mismatch (-want +got):\n%s", diff)
+	}
+
+	for _, target := range paramTargets {
+		for _, p := range Params(target) {
+			if p.Name == "" || p.Description == "" {
+				t.Errorf("%q: missing the name or the description", p.Key)
+			}
+		}
+	}
+}
+
+func TestRegisterParam(t *testing.T) {
+	errInvalid := errors.New("must be on or off")
+	err := RegisterParam(Param{
+		Key:     "test-beta",
+		Aliases: []string{"test-beta-old"},
+		Targets: TargetConfig | TargetOverlay | TargetText,
+		Name:    "beta feature",
+		Validate: func(value string) error {
+			if value != "on" && value != "off" {
+				return errInvalid
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// conflicts
+	if err := RegisterParam(Param{Key: "test-beta", Targets: TargetConfig}); err == nil {
+		t.Error("want error for the duplicated key")
+	}
+	if err := RegisterParam(Param{Key: "w", Targets: TargetConfig}); err == nil {
+		t.Error("want error for the built-in key")
+	}
+	if err := RegisterParam(Param{Key: "test,invalid", Targets: TargetConfig}); err == nil {
+		t.Error("want error for the invalid key")
+	}
+	if err := RegisterParam(Param{Key: "test-no-target"}); err == nil {
+		t.Error("want error for no targets")
+	}
+
+	if p, ok := LookupParam("test-beta-old", TargetText); !ok || p.Key != "test-beta" {
+		t.Errorf("want test-beta, got %q", p.Key)
+	}
+	if !slices.ContainsFunc(Params(TargetConfig), func(p Param) bool { return p.Key == "test-beta" }) {
+		t.Error("want test-beta in Params")
+	}
+
+	// parse
+	proxy := &Proxy{Host: "demo.imageflux.jp"}
+	img, err := proxy.Parse("/c/w=200,test-beta=on,l=(test-beta-old=off/logo.png),t=(font=Ryumin%20R-KL,size=30,w=400,h=80,test-beta=on,text=hello)/images/1.jpg", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(map[string]string{"test-beta": "on"}, img.Config.Extra); diff != "" {
+		t.Errorf("config extra mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"test-beta": "off"}, img.Config.Overlays[0].Extra); diff != "" {
+		t.Errorf("overlay extra mismatch (-want +got):\n%s", diff)
+	}
+	if diff := cmp.Diff(map[string]string{"test-beta": "on"}, img.Config.Texts[0].Extra); diff != "" {
+		t.Errorf("text extra mismatch (-want +got):\n%s", diff)
+	}
+
+	// append
+	want := "w=200%2Cl=(test-beta=off%2Flogo.png)%2Ct=(font=Ryumin%20R-KL%2Csize=30%2Cw=400%2Ch=80%2Ctest-beta=on%2Ctext=hello)%2Ctest-beta=on"
+	if got := img.Config.String(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// validation
+	if _, err := proxy.Parse("/c/w=200,test-beta=maybe/images/1.jpg", ""); !errors.Is(err, errInvalid) {
+		t.Errorf("want errInvalid, got %v", err)
+	}
+
+	// deprecated alias
+	res, err := proxy.Verify("https://demo.imageflux.jp/c/w=200,test-beta-old=on/images/1.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`deprecated key "test-beta-old" is used, use "test-beta" instead`}; !slices.Equal(res.Warnings, want) {
+		t.Errorf("want %v, got %v", want, res.Warnings)
+	}
+}
+
+func TestParseConfig_errorMessage(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"u=2", `imageflux: invalid disable enlarge "2": must be 0 or 1`},
+		{"o=2", `imageflux: invalid optimization "2": must be 0 or 1`},
+		{"b=zz", `imageflux: invalid background "zz": must be RRGGBB or RRGGBBAA in hexadecimal`},
+		{"l=(u=2/a.png)", `imageflux: invalid disable enlarge "2": must be 0 or 1`},
+		{"t=(font=A,size=1,w=1,h=1,f=zz,text=a)", `imageflux: invalid foreground "zz": must be RRGGBB or RRGGBBAA in hexadecimal`},
+	}
+	for _, tt := range tests {
+		_, _, err := ParseConfig(tt.input)
+		if err == nil {
+			t.Errorf("%q: want error, got nil", tt.input)
+			continue
+		}
+		if got := err.Error(); got != tt.want {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.want, got)
+		}
+	}
+}
@@ -1,10 +1,37 @@
 package imageflux
 
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ErrInvalidHost is returned when the host of the URL does not match the proxy.
+var ErrInvalidHost = errors.New("imageflux: invalid host")
+
+// ErrPathPrefixMismatch is returned when the path of the URL doesn't have the signed path prefix of the proxy.
+var ErrPathPrefixMismatch = errors.New("imageflux: path prefix mismatch")
+
 // Proxy is a proxy of ImageFlux.
 type Proxy struct {
 	// Host is the host of the proxy server.
 	Host string
 
+	// Hosts are the hosts of the proxy servers for host sharding.
+	// If Hosts is not empty, the host of each image is chosen from Hosts
+	// by a stable hash of the image path,
+	// so the same image is always served by the same host.
+	// Signatures don't depend on the host.
+	Hosts []string
+
 	// SecretBytes is signing secret.
 	SecretBytes []byte
 
@@ -12,6 +39,134 @@ type Proxy struct {
 	//
 	// Deprecated: Use SecretBytes instead.
 	Secret string
+
+	// Scheme is the scheme of the generated URLs.
+	// If Scheme is empty, "https" is used.
+	Scheme string
+
+	// Port is the port number of the generated URLs.
+	// If Port is 0, the default port of the scheme is used.
+	Port int
+
+	// PathPrefix is the path where ImageFlux is mounted, e.g. "/img".
+	// It is prepended to the path of the generated URLs,
+	// and it is stripped from the path by Parse.
+	PathPrefix string
+
+	// SignPathPrefix makes PathPrefix a part of the signed payload.
+	// By default, PathPrefix is not signed.
+	SignPathPrefix bool
+
+	// PreviousSecrets are signing secrets that are no longer used for signing,
+	// but are still accepted when verifying signatures.
+	// It is useful for rotating the signing secret.
+	PreviousSecrets [][]byte
+}
+
+// signatureLen is the length of signatures:
+// 2 bytes for "1.", and 44 bytes for base64 encoding of 32 bytes.
+const signatureLen = 46
+
+// signaturePlaceholder reserves the space for a signature.
+const signaturePlaceholder = "1.--------------------------------------------"
+
+// hmacStates is the pool of the states to compute HMAC-SHA256 without allocations.
+// It is not keyed by the signing secrets, and the states keep no secret material after use,
+// so Proxy can be copied and its secret can be changed or dropped at any time.
+var hmacStates = sync.Pool{
+	New: func() any {
+		return &hmacState{
+			hash: sha256.New(),
+		}
+	},
+}
+
+type hmacState struct {
+	hash       hash.Hash
+	ipad, opad [sha256.BlockSize]byte
+	sum        [sha256.Size]byte
+}
+
+// hmacSum returns HMAC-SHA256 of prefix + payload with secret, computed with state.
+// The secret may be a string to avoid converting Proxy.Secret into bytes.
+// The result is valid until the state is put back to hmacStates.
+func hmacSum[S string | []byte](state *hmacState, secret S, prefix, payload []byte) []byte {
+	var key []byte
+	if len(secret) > sha256.BlockSize {
+		state.hash.Reset()
+		for i := 0; i < len(secret); i += sha256.BlockSize {
+			n := copy(state.ipad[:], secret[i:])
+			state.hash.Write(state.ipad[:n])
+		}
+		key = state.hash.Sum(state.ipad[:0])
+	} else {
+		n := copy(state.ipad[:], secret)
+		key = state.ipad[:n]
+	}
+	for i := range state.ipad {
+		var k byte
+		if i < len(key) {
+			k = key[i]
+		}
+		state.opad[i] = k ^ 0x5c
+		state.ipad[i] = k ^ 0x36
+	}
+
+	state.hash.Reset()
+	state.hash.Write(state.ipad[:])
+	state.hash.Write(prefix)
+	state.hash.Write(payload)
+	inner := state.hash.Sum(state.sum[:0])
+
+	state.hash.Reset()
+	state.hash.Write(state.opad[:])
+	state.hash.Write(inner)
+	sum := state.hash.Sum(state.sum[:0])
+
+	// don't keep the secret in the pool.
+	clear(state.ipad[:])
+	clear(state.opad[:])
+	state.hash.Reset()
+	return sum
+}
+
+// macPool is a pool of the HMAC-SHA256 states for a signing secret.
+// It is owned by a compiled template, and is released with it.
+type macPool struct {
+	secret []byte
+	pool   sync.Pool
+}
+
+type macState struct {
+	hash hash.Hash
+	sum  [sha256.Size]byte
+}
+
+func newMACPool(secret []byte) *macPool {
+	m := &macPool{
+		secret: secret,
+	}
+	m.pool.New = func() any {
+		return &macState{
+			hash: hmac.New(sha256.New, m.secret),
+		}
+	}
+	return m
+}
+
+// encodeSignature writes the signature of prefix + payload to dst.
+// The length of dst must be signatureLen.
+func (m *macPool) encodeSignature(dst, prefix, payload []byte) {
+	state := m.pool.Get().(*macState)
+	state.hash.Reset()
+	state.hash.Write(prefix)
+	state.hash.Write(payload)
+	sum := state.hash.Sum(state.sum[:0])
+
+	dst[0] = '1'
+	dst[1] = '.'
+	base64.URLEncoding.Encode(dst[2:], sum)
+	m.pool.Put(state)
 }
 
 // Image returns an image served via the proxy.
@@ -25,36 +180,281 @@ func (p *Proxy) Image(path string, config *Config) *Image {
 
 // Parse parses the path and returns the image.
 func (p *Proxy) Parse(path string, signature string) (*Image, error) {
+	img := &Image{}
+	if err := p.ParseInto(img, path, signature); err != nil {
+		return nil, err
+	}
+	return img, nil
+}
+
+// ParseInto is same as Parse, but it stores the result into dst instead of allocating a new Image.
+// If dst.Config is not nil, it is reset and reused,
+// and so are the backing arrays of dst.Config.Overlays and dst.Config.Texts.
+// It is useful for reducing allocations in request handlers.
+//
+// If ParseInto returns an error, the content of dst is undefined.
+func (p *Proxy) ParseInto(dst *Image, path string, signature string) error {
+	config := dst.Config
+	if config == nil {
+		config = &Config{}
+	} else {
+		config.reset()
+	}
+	// the state is pooled because it escapes to the parameter parsers.
+	state := parseStatePool.Get().(*parseState)
+	defer func() {
+		*state = parseState{}
+		parseStatePool.Put(state)
+	}()
+	var err error
+	*state, err = p.newParseState(path, signature, config)
+	if err != nil {
+		return err
+	}
+
+	var rest string
+	if p.hasSecret() {
+		_, rest, err = state.parseConfigAndVerifySignature(p)
+	} else {
+		_, rest, err = state.parseConfig()
+	}
+	if err != nil {
+		return err
+	}
+
+	*dst = Image{
+		Proxy:  p,
+		Path:   rest,
+		Config: config,
+	}
+	return nil
+}
+
+// newParseState returns the state for parsing path.
+// If the path prefix is signed, path must have it;
+// otherwise it returns ErrPathPrefixMismatch instead of failing to verify the signature.
+func (p *Proxy) newParseState(path, signature string, config *Config) (parseState, error) {
+	rest := p.trimPathPrefix(path)
 	state := parseState{
-		s:         path,
-		config:    &Config{},
+		Tokenizer: Tokenizer{s: rest},
+		config:    config,
 		signature: signature,
 	}
+	if p.SignPathPrefix {
+		prefix := p.pathPrefix()
+		if p.hasSecret() && prefix != "" && len(rest) == len(path) {
+			return parseState{}, ErrPathPrefixMismatch
+		}
+		state.payloadPrefix = prefix
+	}
+	return state, nil
+}
+
+// ParseURL parses the URL and returns the image.
+// If u has a host, it must match p.Host or one of p.Hosts.
+// The signature is taken from the sig parameter in the path or the sig query parameter.
+//
+// The path is taken from u.EscapedPath(),
+// so u.RawPath must be set if u.Path contains percent-encoded characters such as "%2C".
+// It is set by url.Parse.
+func (p *Proxy) ParseURL(u *url.URL) (*Image, error) {
+	if u.Host != "" && !p.matchHost(u.Host) {
+		return nil, ErrInvalidHost
+	}
+	return p.Parse(u.EscapedPath(), u.Query().Get("sig"))
+}
+
+// ParseRequest parses the URL of the request and returns the image.
+// The host of the request must match p.Host or one of p.Hosts.
+// The signature is taken from the sig parameter in the path or the sig query parameter.
+func (p *Proxy) ParseRequest(req *http.Request) (*Image, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	if host != "" && !p.matchHost(host) {
+		return nil, ErrInvalidHost
+	}
+	return p.Parse(req.URL.EscapedPath(), req.URL.Query().Get("sig"))
+}
+
+// matchHost reports whether host is served by the proxy.
+// The port number is ignored if the host of the proxy doesn't have it.
+// If both p.Host and p.Hosts are empty, any host matches.
+func (p *Proxy) matchHost(host string) bool {
+	if p.Host == "" && len(p.Hosts) == 0 {
+		return true
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if p.Host != "" && (strings.EqualFold(host, p.Host) || strings.EqualFold(hostname, p.Host)) {
+		return true
+	}
+	for _, h := range p.Hosts {
+		if strings.EqualFold(host, h) || strings.EqualFold(hostname, h) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostFor returns the host that serves the image at path.
+func (p *Proxy) hostFor(path string) string {
+	if len(p.Hosts) == 0 {
+		return p.Host
+	}
+
+	// "/images/1.jpg" and "images/1.jpg" are the same image.
+	path = strings.TrimPrefix(path, "/")
+
+	// 32-bit FNV-1a hash
+	h := uint32(2166136261)
+	for i := 0; i < len(path); i++ {
+		h ^= uint32(path[i])
+		h *= 16777619
+	}
+	return p.Hosts[h%uint32(len(p.Hosts))]
+}
+
+// appendOrigin appends the scheme, the host and the port of the proxy.
+func (p *Proxy) appendOrigin(buf []byte, host string) []byte {
+	scheme := p.Scheme
+	if scheme == "" {
+		scheme = "https"
+	}
+	buf = append(buf, scheme...)
+	buf = append(buf, "://"...)
+	buf = append(buf, host...)
+	if p.Port != 0 {
+		buf = append(buf, ':')
+		buf = strconv.AppendInt(buf, int64(p.Port), 10)
+	}
+	return buf
+}
+
+// appendPathPrefix appends PathPrefix in the same form as pathPrefix.
+func (p *Proxy) appendPathPrefix(buf []byte) []byte {
+	prefix := strings.TrimSuffix(p.PathPrefix, "/")
+	if prefix != "" && prefix[0] != '/' {
+		buf = append(buf, '/')
+	}
+	return append(buf, prefix...)
+}
+
+// pathPrefix returns PathPrefix that starts with a slash and doesn't end with a slash.
+func (p *Proxy) pathPrefix() string {
+	prefix := strings.TrimSuffix(p.PathPrefix, "/")
+	if prefix != "" && prefix[0] != '/' {
+		prefix = "/" + prefix
+	}
+	return prefix
+}
+
+// trimPathPrefix removes PathPrefix from path if path has it.
+func (p *Proxy) trimPathPrefix(path string) string {
+	prefix := p.pathPrefix()
+	if prefix == "" {
+		return path
+	}
+	if rest, ok := strings.CutPrefix(path, prefix); ok && (rest == "" || rest[0] == '/') {
+		return rest
+	}
+	return path
+}
+
+// hasSecret reports whether the proxy has the signing secret.
+func (p *Proxy) hasSecret() bool {
+	return len(p.SecretBytes) != 0 || p.Secret != ""
+}
 
+// encodeSignature writes the signature of prefix + payload to dst.
+// The length of dst must be signatureLen.
+func (p *Proxy) encodeSignature(dst, prefix, payload []byte) {
+	state := hmacStates.Get().(*hmacState)
+	sum := p.hmacSum(state, prefix, payload)
+	dst[0] = '1'
+	dst[1] = '.'
+	base64.URLEncoding.Encode(dst[2:], sum)
+	hmacStates.Put(state)
+}
+
+// hmacSum returns HMAC-SHA256 of prefix + payload with the signing secret.
+func (p *Proxy) hmacSum(state *hmacState, prefix, payload []byte) []byte {
+	if len(p.SecretBytes) != 0 {
+		return hmacSum(state, p.SecretBytes, prefix, payload)
+	}
+	return hmacSum(state, p.Secret, prefix, payload)
+}
+
+// secret returns the signing secret.
+func (p *Proxy) secret() []byte {
 	secret := p.SecretBytes
 	if len(secret) == 0 && p.Secret != "" {
 		secret = []byte(p.Secret)
 	}
+	return secret
+}
 
-	if len(secret) == 0 {
-		c, rest, err := state.parseConfig()
-		if err != nil {
-			return nil, err
-		}
-		return &Image{
-			Proxy:  p,
-			Path:   rest,
-			Config: c,
-		}, nil
+// verifySignature verifies the signature of data.
+// It returns the index of the matched secret;
+// 0 is the current secret, and i+1 is PreviousSecrets[i].
+func (p *Proxy) verifySignature(signature string, data []byte) (int, error) {
+	if !strings.HasPrefix(signature, "1.") {
+		return -1, ErrInvalidSignature
 	}
 
-	c, rest, err := state.parseConfigAndVerifySignature(secret)
+	// signature version 1
+	// decode the signature on the stack to avoid allocations.
+	var src [signatureLen]byte
+	var sig [sha256.Size + 2]byte
+	encoded := signature[len("1."):]
+	if len(encoded) > len(src) {
+		return -1, ErrInvalidSignature
+	}
+	copy(src[:], encoded)
+	n, err := base64.URLEncoding.Decode(sig[:], src[:len(encoded)])
 	if err != nil {
-		return nil, err
+		return -1, ErrInvalidSignature
 	}
-	return &Image{
-		Proxy:  p,
-		Path:   rest,
-		Config: c,
-	}, nil
+
+	state := hmacStates.Get().(*hmacState)
+	ok := hmac.Equal(sig[:n], p.hmacSum(state, data, nil))
+	hmacStates.Put(state)
+	if ok {
+		return 0, nil
+	}
+	for i, secret := range p.PreviousSecrets {
+		if len(secret) != 0 && verifyHMAC(secret, sig[:n], data) {
+			return i + 1, nil
+		}
+	}
+	return -1, ErrInvalidSignature
+}
+
+func verifyHMAC(secret, sig, data []byte) bool {
+	state := hmacStates.Get().(*hmacState)
+	ok := hmac.Equal(sig, hmacSum(state, secret, data, nil))
+	hmacStates.Put(state)
+	return ok
+}
+
+// rewriteURL returns the URL of img that keeps the scheme, the host and the query of u.
+// It is signed if the proxy has a signing secret.
+func (p *Proxy) rewriteURL(u *url.URL, img *Image) string {
+	var buf []byte
+	if u.Host != "" {
+		buf = append(buf, u.Scheme...)
+		buf = append(buf, "://"...)
+		buf = append(buf, u.Host...)
+	}
+	buf = img.appendSignedPath(buf)
+	query := u.Query()
+	query.Del("sig")
+	if len(query) > 0 {
+		buf = append(buf, '?')
+		buf = append(buf, query.Encode()...)
+	}
+	return string(buf)
 }
@@ -1,9 +1,18 @@
 package imageflux
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"image"
+	"net/http/httptest"
+	"net/url"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func TestProxy_Parse(t *testing.T) {
@@ -102,6 +111,52 @@ func TestProxy_Parse(t *testing.T) {
 			path: "/images/1.jpg",
 		},
 
+		// key rotation
+		{
+			input: "/c/sig=1.V5PHZWHTmE_TGmwBgGpKzbGm2Lo2R4uTxcB2hE3vLLs=,w=200/images/1.jpg",
+			proxy: &Proxy{
+				SecretBytes:     []byte("testsigningsecret"),
+				PreviousSecrets: [][]byte{[]byte("oldsecret")},
+			},
+			want: &Config{
+				Width: 200,
+			},
+			path: "/images/1.jpg",
+		},
+
+		// path prefix
+		{
+			input: "/img/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg",
+			proxy: &Proxy{
+				PathPrefix:  "/img",
+				SecretBytes: []byte("testsigningsecret"),
+			},
+			want: &Config{
+				Width: 200,
+			},
+			path: "/images/1.jpg",
+		},
+		{
+			input: "/img/c/sig=1.Z6f5eEb9nSBnNu7ztRSRmRo2Ki79WwoipV8cu3KH2Ks=,w=200/images/1.jpg",
+			proxy: &Proxy{
+				PathPrefix:     "/img/",
+				SignPathPrefix: true,
+				SecretBytes:    []byte("testsigningsecret"),
+			},
+			want: &Config{
+				Width: 200,
+			},
+			path: "/images/1.jpg",
+		},
+		{
+			input: "/img/images/1.jpg",
+			proxy: &Proxy{
+				PathPrefix: "/img",
+			},
+			want: &Config{},
+			path: "/images/1.jpg",
+		},
+
 		// backward compatibility with Secret field
 		{
 			input: "/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg",
@@ -178,6 +233,15 @@ func TestProxy_Parse_sig_error(t *testing.T) {
 				SecretBytes: []byte("testsigningsecret"),
 			},
 		},
+		{
+			// the path prefix is not signed, but the proxy expects it.
+			input: "/img/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg",
+			proxy: &Proxy{
+				PathPrefix:     "/img",
+				SignPathPrefix: true,
+				SecretBytes:    []byte("testsigningsecret"),
+			},
+		},
 	}
 
 	for _, c := range cases {
@@ -188,10 +252,253 @@ func TestProxy_Parse_sig_error(t *testing.T) {
 	}
 }
 
+func TestProxy_Parse_pathPrefixMismatch(t *testing.T) {
+	proxy := &Proxy{
+		PathPrefix:     "/img",
+		SignPathPrefix: true,
+		SecretBytes:    []byte("testsigningsecret"),
+	}
+
+	// the signature covers "/img", but the path doesn't have it.
+	input := "/c/sig=1.Z6f5eEb9nSBnNu7ztRSRmRo2Ki79WwoipV8cu3KH2Ks=,w=200/images/1.jpg"
+	if _, err := proxy.Parse(input, ""); !errors.Is(err, ErrPathPrefixMismatch) {
+		t.Errorf("Parse: want ErrPathPrefixMismatch, got %v", err)
+	}
+	if _, err := proxy.Verify(input); !errors.Is(err, ErrPathPrefixMismatch) {
+		t.Errorf("Verify: want ErrPathPrefixMismatch, got %v", err)
+	}
+
+	// the prefix must match at a path segment boundary.
+	input = "/imgs/c/sig=1.Z6f5eEb9nSBnNu7ztRSRmRo2Ki79WwoipV8cu3KH2Ks=,w=200/images/1.jpg"
+	if _, err := proxy.Parse(input, ""); !errors.Is(err, ErrPathPrefixMismatch) {
+		t.Errorf("Parse: want ErrPathPrefixMismatch, got %v", err)
+	}
+}
+
+func TestProxy_ParseURL(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+
+	cases := []struct {
+		input string
+		want  *Config
+		path  string
+	}{
+		{
+			input: "https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg",
+			want: &Config{
+				Width: 200,
+			},
+			path: "/images/1.jpg",
+		},
+		{
+			input: "https://demo.imageflux.jp/c/w=200/images/1.jpg?sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=",
+			want: &Config{
+				Width: 200,
+			},
+			path: "/images/1.jpg",
+		},
+		{
+			input: "https://DEMO.imageflux.jp:443/c/w=200/images/1.jpg?sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=",
+			want: &Config{
+				Width: 200,
+			},
+			path: "/images/1.jpg",
+		},
+		{
+			input: "/c/w=200/images/1.jpg?sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=",
+			want: &Config{
+				Width: 200,
+			},
+			path: "/images/1.jpg",
+		},
+	}
+
+	for _, c := range cases {
+		u, err := url.Parse(c.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := proxy.ParseURL(u)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got.Config, c.want) {
+			t.Errorf("%q: unexpected config: want %#v, got %#v", c.input, c.want, got.Config)
+		}
+		if got.Path != c.path {
+			t.Errorf("%q: want %s, got %s", c.input, c.path, got.Path)
+		}
+	}
+}
+
+func TestProxy_ParseURL_error(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+
+	cases := []struct {
+		input string
+		err   error
+	}{
+		{
+			input: "https://example.com/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg",
+			err:   ErrInvalidHost,
+		},
+		{
+			input: "https://demo.imageflux.jp/c/w=200/images/1.jpg?sig=1.-Yd8m-5pXPihiZdlDATcwkkgjzPIC9gFHmmZ3JMxwS0=",
+			err:   ErrInvalidSignature,
+		},
+		{
+			input: "https://demo.imageflux.jp/c/w=200/images/1.jpg",
+			err:   ErrInvalidSignature,
+		},
+	}
+
+	for _, c := range cases {
+		u, err := url.Parse(c.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = proxy.ParseURL(u)
+		if !errors.Is(err, c.err) {
+			t.Errorf("%q: want %v, got %v", c.input, c.err, err)
+		}
+	}
+}
+
+func TestProxy_ParseRequest(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+
+	req := httptest.NewRequest("GET", "/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg", nil)
+	req.Host = "demo.imageflux.jp"
+	got, err := proxy.ParseRequest(req)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.Config.Width != 200 {
+		t.Errorf("want width 200, got %d", got.Config.Width)
+	}
+	if got.Path != "/images/1.jpg" {
+		t.Errorf("want /images/1.jpg, got %s", got.Path)
+	}
+
+	req.Host = "example.com"
+	if _, err := proxy.ParseRequest(req); !errors.Is(err, ErrInvalidHost) {
+		t.Errorf("want ErrInvalidHost, got %v", err)
+	}
+}
+
+func TestProxy_ParseURL_hosts(t *testing.T) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		Hosts:       []string{"img1.example.com", "img2.example.com", "img3.example.com"},
+		SecretBytes: []byte("testsigningsecret"),
+	}
+
+	for _, host := range []string{"demo.imageflux.jp", "img1.example.com", "img2.example.com", "img3.example.com:443"} {
+		u := &url.URL{
+			Scheme:   "https",
+			Host:     host,
+			Path:     "/c/w=200/images/1.jpg",
+			RawQuery: "sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=",
+		}
+		if _, err := proxy.ParseURL(u); err != nil {
+			t.Errorf("%q: unexpected error: %v", host, err)
+		}
+	}
+
+	u := &url.URL{
+		Scheme:   "https",
+		Host:     "img4.example.com",
+		Path:     "/c/w=200/images/1.jpg",
+		RawQuery: "sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=",
+	}
+	if _, err := proxy.ParseURL(u); !errors.Is(err, ErrInvalidHost) {
+		t.Errorf("want ErrInvalidHost, got %v", err)
+	}
+}
+
+func TestProxy_ParseInto(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	proxy := &Proxy{
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	img := &Image{
+		Config: &Config{
+			Height:   100,
+			Overlays: []*Overlay{{Path: "/images/2.png"}},
+			Texts:    []*Text{{Text: "Hello"}},
+		},
+		Expires: time.Date(2023, 6, 24, 9, 24, 0, 0, time.UTC),
+	}
+	config := img.Config
+	err := proxy.ParseInto(img, "/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want := &Image{
+		Proxy: proxy,
+		Path:  "/images/1.jpg",
+		Config: &Config{
+			Width:    200,
+			Overlays: []*Overlay{},
+			Texts:    []*Text{},
+		},
+	}
+	if !reflect.DeepEqual(img, want) {
+		t.Errorf("want %#v, got %#v", want, img)
+	}
+	if img.Config != config {
+		t.Error("want the config to be reused")
+	}
+
+	err = proxy.ParseInto(img, "/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=300/images/1.jpg", "")
+	if err != ErrInvalidSignature {
+		t.Errorf("want ErrInvalidSignature, got %v", err)
+	}
+}
+
+func TestProxy_ParseInto_allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("skipping allocation tests in the race mode")
+	}
+
+	proxy := &Proxy{
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	img := &Image{}
+	allocs := testing.AllocsPerRun(100, func() {
+		err := proxy.ParseInto(img, "/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocation, got %f", allocs)
+	}
+}
+
 func BenchmarkProxy_Parse(b *testing.B) {
 	proxy := &Proxy{
 		SecretBytes: []byte("testsigningsecret"),
 	}
+	b.ReportAllocs()
 	for i := 0; i < b.N; i++ {
 		_, err := proxy.Parse("/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg", "")
 		if err != nil {
@@ -199,3 +506,110 @@ func BenchmarkProxy_Parse(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkProxy_ParseInto(b *testing.B) {
+	proxy := &Proxy{
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	img := &Image{}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		err := proxy.ParseInto(img, "/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=,w=200/images/1.jpg", "")
+		if err != nil {
+			b.Fatalf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestProxy_Parse_roundTrip(t *testing.T) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	want := &Config{
+		Width: 400,
+		Overlays: []*Overlay{
+			{
+				Path:          "/images/logo.png",
+				Width:         100,
+				Offset:        image.Pt(10, 20),
+				OverlayOrigin: OriginBottomRight,
+				MaskType:      MaskTypeAlpha,
+				PaddingMode:   PaddingModeLeave,
+			},
+		},
+		Texts: []*Text{
+			{
+				Font:          &Font{Name: "Ryumin R-KL"},
+				Size:          30,
+				Width:         400,
+				Height:        80,
+				OffsetRatio:   image.Pt(32768, 0),
+				OffsetMax:     image.Pt(65536, 65536),
+				OverlayOrigin: OriginBottomCenter,
+				Text:          "caption",
+			},
+		},
+	}
+	u, err := url.Parse(proxy.Image("/images/1.jpg", want).SignedURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := proxy.Parse(u.EscapedPath(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, img.Config); diff != "" {
+		t.Errorf("%q: mismatch (-want +got):\n%s", u, diff)
+	}
+}
+
+func TestProxy_copy(t *testing.T) {
+	p1 := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	cfg := &Config{Width: 200}
+	want := p1.Image("/images/1.jpg", cfg).SignedURL()
+
+	// the copy shares the secret, and signs in the same way.
+	p2 := *p1
+	if got := p2.Image("/images/1.jpg", cfg).SignedURL(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+
+	// changing the secret of the copy doesn't affect the original.
+	p2.SecretBytes = []byte("anothersecret")
+	if got := p2.Image("/images/1.jpg", cfg).SignedURL(); got == want {
+		t.Errorf("the copy with another secret must sign differently: %s", got)
+	}
+	if got := p1.Image("/images/1.jpg", cfg).SignedURL(); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestHMACSum(t *testing.T) {
+	for _, secret := range [][]byte{
+		[]byte("testsigningsecret"),
+		bytes.Repeat([]byte("k"), sha256.BlockSize),
+		bytes.Repeat([]byte("long"), sha256.BlockSize),
+	} {
+		w := hmac.New(sha256.New, secret)
+		w.Write([]byte("/c/w=200/images/1.jpg"))
+		want := w.Sum(nil)
+
+		state := hmacStates.Get().(*hmacState)
+		got := hmacSum(state, secret, []byte("/c/w=200"), []byte("/images/1.jpg"))
+		if !bytes.Equal(got, want) {
+			t.Errorf("secret length %d: want %x, got %x", len(secret), want, got)
+		}
+		got = hmacSum(state, string(secret), []byte("/c/w=200"), []byte("/images/1.jpg"))
+		if !bytes.Equal(got, want) {
+			t.Errorf("secret length %d: want %x, got %x", len(secret), want, got)
+		}
+		if state.ipad != ([sha256.BlockSize]byte{}) || state.opad != ([sha256.BlockSize]byte{}) {
+			t.Errorf("secret length %d: the state keeps the secret", len(secret))
+		}
+		hmacStates.Put(state)
+	}
+}
@@ -0,0 +1,7 @@
+//go:build race
+
+package imageflux
+
+func init() {
+	raceEnabled = true
+}
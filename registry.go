@@ -0,0 +1,147 @@
+package imageflux
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Registry is a set of proxies keyed by host.
+// It is useful for serving multiple ImageFlux hosts that have their own signing secrets.
+//
+// A Registry is safe for concurrent use by multiple goroutines,
+// and proxies can be added or removed while it is in use.
+// The zero value is an empty registry ready to use.
+type Registry struct {
+	mu      sync.RWMutex
+	proxies map[string]*Proxy
+}
+
+// NewRegistry returns a new registry that contains proxies.
+func NewRegistry(proxies ...*Proxy) *Registry {
+	r := &Registry{}
+	r.Replace(proxies...)
+	return r
+}
+
+// Add adds the proxy to the registry.
+// The proxy is registered for p.Host and all hosts in p.Hosts.
+// If another proxy is already registered for the same host, it is replaced.
+func (r *Registry) Add(p *Proxy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.proxies == nil {
+		r.proxies = make(map[string]*Proxy)
+	}
+	addProxy(r.proxies, p)
+}
+
+// Remove removes the proxy registered for host.
+// The other hosts of the proxy are also removed.
+func (r *Registry) Remove(host string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.proxies[registryKey(host)]
+	if !ok {
+		return
+	}
+	for key, q := range r.proxies {
+		if q == p {
+			delete(r.proxies, key)
+		}
+	}
+}
+
+// Replace replaces all proxies in the registry at once.
+// It is useful for reloading the configuration at runtime.
+func (r *Registry) Replace(proxies ...*Proxy) {
+	m := make(map[string]*Proxy, len(proxies))
+	for _, p := range proxies {
+		addProxy(m, p)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.proxies = m
+}
+
+// Lookup returns the proxy registered for host.
+// The port number of host is ignored.
+func (r *Registry) Lookup(host string) (*Proxy, bool) {
+	key := registryKey(host)
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	p, ok := r.proxies[key]
+	return p, ok
+}
+
+// Hosts returns the hosts in the registry in sorted order.
+func (r *Registry) Hosts() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	hosts := make([]string, 0, len(r.proxies))
+	for host := range r.proxies {
+		hosts = append(hosts, host)
+	}
+	slices.Sort(hosts)
+	return hosts
+}
+
+// ParseURL looks up the proxy for the host of u, and parses u with it.
+// If no proxy is registered for the host, it returns ErrInvalidHost.
+func (r *Registry) ParseURL(u *url.URL) (*Image, error) {
+	p, ok := r.Lookup(u.Host)
+	if !ok {
+		return nil, ErrInvalidHost
+	}
+	return p.ParseURL(u)
+}
+
+// ParseRequest looks up the proxy for the host of req, and parses req with it.
+// If no proxy is registered for the host, it returns ErrInvalidHost.
+func (r *Registry) ParseRequest(req *http.Request) (*Image, error) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+	p, ok := r.Lookup(host)
+	if !ok {
+		return nil, ErrInvalidHost
+	}
+	return p.ParseRequest(req)
+}
+
+// Verify looks up the proxy for the host of rawURL, and verifies rawURL with it.
+// If no proxy is registered for the host, it returns ErrInvalidHost.
+func (r *Registry) Verify(rawURL string) (*VerifyResult, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("imageflux: invalid url %q: %w", rawURL, err)
+	}
+	p, ok := r.Lookup(u.Host)
+	if !ok {
+		return nil, ErrInvalidHost
+	}
+	return p.Verify(rawURL)
+}
+
+func addProxy(m map[string]*Proxy, p *Proxy) {
+	if p.Host != "" {
+		m[registryKey(p.Host)] = p
+	}
+	for _, host := range p.Hosts {
+		m[registryKey(host)] = p
+	}
+}
+
+// registryKey normalizes host for the key of the registry.
+func registryKey(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
@@ -0,0 +1,116 @@
+package imageflux
+
+import (
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRegistry(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC))
+
+	tenant1 := &Proxy{
+		Host:        "tenant1.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	tenant2 := &Proxy{
+		Hosts:       []string{"img1.tenant2.example.com", "img2.tenant2.example.com"},
+		SecretBytes: []byte("oldsecret"),
+	}
+	r := NewRegistry(tenant1, tenant2)
+
+	hosts := r.Hosts()
+	if want := []string{"img1.tenant2.example.com", "img2.tenant2.example.com", "tenant1.imageflux.jp"}; !slices.Equal(hosts, want) {
+		t.Errorf("want %v, got %v", want, hosts)
+	}
+
+	if p, ok := r.Lookup("TENANT1.imageflux.jp:443"); !ok || p != tenant1 {
+		t.Errorf("want tenant1, got %v", p)
+	}
+
+	// the secret of tenant1
+	u, _ := url.Parse("https://tenant1.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg")
+	if _, err := r.ParseURL(u); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// the secret of tenant2
+	u, _ = url.Parse("https://img1.tenant2.example.com/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg")
+	if _, err := r.ParseURL(u); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("want ErrInvalidSignature, got %v", err)
+	}
+	req := httptest.NewRequest("GET", "/c/sig=1.V5PHZWHTmE_TGmwBgGpKzbGm2Lo2R4uTxcB2hE3vLLs=%2Cw=200/images/1.jpg", nil)
+	req.Host = "img2.tenant2.example.com"
+	if _, err := r.ParseRequest(req); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	res, err := r.Verify("https://img2.tenant2.example.com/c/sig=1.V5PHZWHTmE_TGmwBgGpKzbGm2Lo2R4uTxcB2hE3vLLs=%2Cw=200/images/1.jpg")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !res.Valid {
+		t.Error("want valid signature")
+	}
+
+	// unknown host
+	u, _ = url.Parse("https://unknown.example.com/c/w=200/images/1.jpg")
+	if _, err := r.ParseURL(u); !errors.Is(err, ErrInvalidHost) {
+		t.Errorf("want ErrInvalidHost, got %v", err)
+	}
+
+	// remove tenant2
+	r.Remove("img1.tenant2.example.com")
+	if _, ok := r.Lookup("img2.tenant2.example.com"); ok {
+		t.Error("want tenant2 to be removed")
+	}
+	if _, ok := r.Lookup("tenant1.imageflux.jp"); !ok {
+		t.Error("want tenant1 to remain")
+	}
+}
+
+func TestRegistry_zero(t *testing.T) {
+	var r Registry
+	if _, ok := r.Lookup("demo.imageflux.jp"); ok {
+		t.Error("want no proxy")
+	}
+	r.Remove("demo.imageflux.jp")
+
+	p := &Proxy{Host: "demo.imageflux.jp"}
+	r.Add(p)
+	if got, ok := r.Lookup("demo.imageflux.jp"); !ok || got != p {
+		t.Errorf("want %v, got %v", p, got)
+	}
+}
+
+func TestRegistry_concurrent(t *testing.T) {
+	r := NewRegistry(&Proxy{Host: "demo.imageflux.jp"})
+	u, _ := url.Parse("https://demo.imageflux.jp/c/w=200/images/1.jpg")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if _, err := r.ParseURL(u); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				r.Add(&Proxy{Host: "other.imageflux.jp"})
+				r.Remove("other.imageflux.jp")
+				r.Replace(&Proxy{Host: "demo.imageflux.jp"})
+			}
+		}()
+	}
+	wg.Wait()
+}
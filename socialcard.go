@@ -0,0 +1,301 @@
+package imageflux
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// SocialCardWidth is the default width of social cards.
+	SocialCardWidth = 1200
+
+	// SocialCardHeight is the default height of social cards.
+	SocialCardHeight = 630
+)
+
+// lineHeight is the ratio of the height of a text line to the font size.
+const lineHeight = 1.25
+
+// SocialCard is the layout of a social card, e.g. an Open Graph image.
+//
+// The background photo is cropped to fill the card.
+// The logo is placed at the top-left corner, and the badge is placed at the top-right corner.
+// The title and the subtitle are placed at the bottom of the card, the subtitle below the title.
+// Empty slots except Background and Title are omitted.
+type SocialCard struct {
+	// Width and Height are the size of the card in pixel.
+	// If they are zero, SocialCardWidth and SocialCardHeight are used.
+	Width, Height int
+
+	// Background is the path of the background photo.
+	Background string
+
+	// Logo is the path of the logo image.
+	Logo string
+
+	// Title is the title of the card, e.g. the title of the article.
+	Title string
+
+	// Subtitle is the subtitle of the card, e.g. the author of the article.
+	Subtitle string
+
+	// Badge is a short label at the top-right corner, e.g. the category of the article.
+	Badge string
+
+	// Theme is the theme of the card.
+	Theme CardTheme
+}
+
+// CardTheme is the theme of social cards.
+// Zero values are replaced by the defaults.
+type CardTheme struct {
+	// TitleFont is the font of the title. It is required.
+	TitleFont *Font
+
+	// SubtitleFont is the font of the subtitle.
+	// If it is nil, TitleFont is used.
+	SubtitleFont *Font
+
+	// BadgeFont is the font of the badge.
+	// If it is nil, SubtitleFont is used.
+	BadgeFont *Font
+
+	// TitleSize, SubtitleSize and BadgeSize are the font sizes.
+	// The defaults are 64, 32 and 24.
+	TitleSize, SubtitleSize, BadgeSize float64
+
+	// TitleLines is the maximum number of the lines of the title.
+	// The title is ellipsized if it is longer. The default is 2.
+	TitleLines int
+
+	// TitleColor, SubtitleColor and BadgeColor are the colors of the texts.
+	// The default is white.
+	TitleColor, SubtitleColor, BadgeColor color.Color
+
+	// BadgeBackground is the background color of the badge.
+	// The default is black.
+	BadgeBackground color.Color
+
+	// BadgeWidth is the width of the badge in pixel. The default is 240.
+	BadgeWidth int
+
+	// LogoWidth and LogoHeight are the size of the box that the logo is scaled to fit.
+	// The defaults are 240 and 80.
+	LogoWidth, LogoHeight int
+
+	// Margin is the margin between the edges of the card and the contents in pixel.
+	// The default is 60.
+	Margin int
+
+	// Gap is the gap between the title and the subtitle in pixel.
+	// The default is 16.
+	Gap int
+}
+
+// withDefaults returns a copy of t with the zero values replaced by the defaults.
+func (t CardTheme) withDefaults() CardTheme {
+	if t.SubtitleFont == nil {
+		t.SubtitleFont = t.TitleFont
+	}
+	if t.BadgeFont == nil {
+		t.BadgeFont = t.SubtitleFont
+	}
+	if t.TitleSize == 0 {
+		t.TitleSize = 64
+	}
+	if t.SubtitleSize == 0 {
+		t.SubtitleSize = 32
+	}
+	if t.BadgeSize == 0 {
+		t.BadgeSize = 24
+	}
+	if t.TitleLines == 0 {
+		t.TitleLines = 2
+	}
+	if t.TitleColor == nil {
+		t.TitleColor = color.White
+	}
+	if t.SubtitleColor == nil {
+		t.SubtitleColor = color.White
+	}
+	if t.BadgeColor == nil {
+		t.BadgeColor = color.White
+	}
+	if t.BadgeBackground == nil {
+		t.BadgeBackground = color.Black
+	}
+	if t.BadgeWidth == 0 {
+		t.BadgeWidth = 240
+	}
+	if t.LogoWidth == 0 {
+		t.LogoWidth = 240
+	}
+	if t.LogoHeight == 0 {
+		t.LogoHeight = 80
+	}
+	if t.Margin == 0 {
+		t.Margin = 60
+	}
+	if t.Gap == 0 {
+		t.Gap = 16
+	}
+	return t
+}
+
+// validate reports an error if t has negative values.
+// It must be called after withDefaults.
+func (t CardTheme) validate() error {
+	if t.TitleSize < 0 || t.SubtitleSize < 0 || t.BadgeSize < 0 {
+		return errors.New("imageflux: the font sizes of the social card must be positive")
+	}
+	if t.TitleLines < 0 {
+		return fmt.Errorf("imageflux: invalid number of the title lines %d", t.TitleLines)
+	}
+	if t.BadgeWidth < 0 || t.LogoWidth < 0 || t.LogoHeight < 0 {
+		return errors.New("imageflux: the sizes of the logo and the badge must be positive")
+	}
+	if t.Margin < 0 || t.Gap < 0 {
+		return errors.New("imageflux: the margin and the gap of the social card must not be negative")
+	}
+	return nil
+}
+
+// textHeight returns the height in pixel of the box for lines of text.
+func textHeight(size float64, lines int) int {
+	return int(math.Ceil(size * lineHeight * float64(lines)))
+}
+
+// Config returns the config that composes the card.
+// The background photo is not included; it is the path of the image.
+// It returns an error if the theme has negative values or the contents don't fit in the card.
+func (c *SocialCard) Config() (*Config, error) {
+	if c.Background == "" {
+		return nil, errors.New("imageflux: the background of the social card is required")
+	}
+	if c.Title == "" {
+		return nil, errors.New("imageflux: the title of the social card is required")
+	}
+	theme := c.Theme.withDefaults()
+	if theme.TitleFont == nil {
+		return nil, errors.New("imageflux: the font of the title is required")
+	}
+
+	width, height := c.Width, c.Height
+	if width == 0 {
+		width = SocialCardWidth
+	}
+	if height == 0 {
+		height = SocialCardHeight
+	}
+	if width < 0 || height < 0 {
+		return nil, fmt.Errorf("imageflux: invalid size of the social card %dx%d", width, height)
+	}
+	if err := theme.validate(); err != nil {
+		return nil, err
+	}
+	margin := theme.Margin
+	contentWidth := width - 2*margin
+	if contentWidth <= 0 {
+		return nil, errors.New("imageflux: the margin of the social card is too large")
+	}
+	if c.Logo != "" && theme.LogoWidth > contentWidth {
+		return nil, errors.New("imageflux: the logo of the social card doesn't fit in the card")
+	}
+	if c.Badge != "" && theme.BadgeWidth > contentWidth {
+		return nil, errors.New("imageflux: the badge of the social card doesn't fit in the card")
+	}
+	if c.Logo != "" && c.Badge != "" && theme.LogoWidth+theme.BadgeWidth > contentWidth {
+		return nil, errors.New("imageflux: the logo and the badge of the social card overlap")
+	}
+
+	cfg := &Config{
+		Width:      width,
+		Height:     height,
+		AspectMode: AspectModeCrop,
+	}
+
+	// the top area: the logo and the badge.
+	top := margin
+	if c.Logo != "" {
+		cfg.Overlays = append(cfg.Overlays, &Overlay{
+			Path:          c.Logo,
+			Width:         theme.LogoWidth,
+			Height:        theme.LogoHeight,
+			AspectMode:    AspectModeScale,
+			Offset:        image.Pt(margin, margin),
+			OverlayOrigin: OriginTopLeft,
+		})
+		top = margin + theme.LogoHeight
+	}
+	if c.Badge != "" {
+		badgeHeight := textHeight(theme.BadgeSize, 1)
+		cfg.Texts = append(cfg.Texts, &Text{
+			Font:          theme.BadgeFont,
+			Size:          theme.BadgeSize,
+			Foreground:    theme.BadgeColor,
+			Background:    theme.BadgeBackground,
+			Width:         theme.BadgeWidth,
+			Height:        badgeHeight,
+			Align:         TextAlignCenter,
+			Ellipsize:     true,
+			Offset:        image.Pt(width-margin-theme.BadgeWidth, margin),
+			OverlayOrigin: OriginTopLeft,
+			Text:          c.Badge,
+		})
+		top = max(top, margin+badgeHeight)
+	}
+
+	// the bottom area: the title and the subtitle, from the bottom.
+	bottom := height - margin
+	var subtitle *Text
+	if c.Subtitle != "" {
+		subtitleHeight := textHeight(theme.SubtitleSize, 1)
+		bottom -= subtitleHeight
+		subtitle = &Text{
+			Font:          theme.SubtitleFont,
+			Size:          theme.SubtitleSize,
+			Foreground:    theme.SubtitleColor,
+			Width:         contentWidth,
+			Height:        subtitleHeight,
+			Ellipsize:     true,
+			Offset:        image.Pt(margin, bottom),
+			OverlayOrigin: OriginTopLeft,
+			Text:          c.Subtitle,
+		}
+		bottom -= theme.Gap
+	}
+	titleHeight := textHeight(theme.TitleSize, theme.TitleLines)
+	bottom -= titleHeight
+	if bottom < top {
+		return nil, errors.New("imageflux: the title of the social card doesn't fit in the card")
+	}
+	cfg.Texts = append(cfg.Texts, &Text{
+		Font:          theme.TitleFont,
+		Size:          theme.TitleSize,
+		Foreground:    theme.TitleColor,
+		Width:         contentWidth,
+		Height:        titleHeight,
+		Wrap:          TextWrapLineChar,
+		Ellipsize:     true,
+		Offset:        image.Pt(margin, bottom),
+		OverlayOrigin: OriginTopLeft,
+		Text:          c.Title,
+	})
+	if subtitle != nil {
+		cfg.Texts = append(cfg.Texts, subtitle)
+	}
+	return cfg, nil
+}
+
+// Image returns the image of the card served by p.
+// The URL of the image is signed if p has a signing secret.
+func (c *SocialCard) Image(p *Proxy) (*Image, error) {
+	cfg, err := c.Config()
+	if err != nil {
+		return nil, err
+	}
+	return p.Image(c.Background, cfg), nil
+}
@@ -0,0 +1,177 @@
+package imageflux
+
+import (
+	"image"
+	"image/color"
+	"net/url"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSocialCard_Config(t *testing.T) {
+	font := &Font{Name: "Ryumin R-KL"}
+	card := &SocialCard{
+		Background: "/images/photo.jpg",
+		Logo:       "/images/logo.png",
+		Title:      "Hello, world!",
+		Subtitle:   "by gopher",
+		Badge:      "Go",
+		Theme: CardTheme{
+			TitleFont: font,
+		},
+	}
+	got, err := card.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Config{
+		Width:      1200,
+		Height:     630,
+		AspectMode: AspectModeCrop,
+		Overlays: []*Overlay{
+			{
+				Path:          "/images/logo.png",
+				Width:         240,
+				Height:        80,
+				AspectMode:    AspectModeScale,
+				Offset:        image.Pt(60, 60),
+				OverlayOrigin: OriginTopLeft,
+			},
+		},
+		Texts: []*Text{
+			{
+				Font:          font,
+				Size:          24,
+				Foreground:    color.White,
+				Background:    color.Black,
+				Width:         240,
+				Height:        30,
+				Align:         TextAlignCenter,
+				Ellipsize:     true,
+				Offset:        image.Pt(900, 60),
+				OverlayOrigin: OriginTopLeft,
+				Text:          "Go",
+			},
+			{
+				Font:          font,
+				Size:          64,
+				Foreground:    color.White,
+				Width:         1080,
+				Height:        160,
+				Wrap:          TextWrapLineChar,
+				Ellipsize:     true,
+				Offset:        image.Pt(60, 354),
+				OverlayOrigin: OriginTopLeft,
+				Text:          "Hello, world!",
+			},
+			{
+				Font:          font,
+				Size:          32,
+				Foreground:    color.White,
+				Width:         1080,
+				Height:        40,
+				Ellipsize:     true,
+				Offset:        image.Pt(60, 530),
+				OverlayOrigin: OriginTopLeft,
+				Text:          "by gopher",
+			},
+		},
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestSocialCard_Image(t *testing.T) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	card := &SocialCard{
+		Background: "/images/photo.jpg",
+		Title:      "Hello, world!",
+		Theme: CardTheme{
+			TitleFont: &Font{Name: "Ryumin R-KL"},
+		},
+	}
+	img, err := card.Image(proxy)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the signed URL can be parsed back.
+	u, err := url.Parse(img.SignedURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := proxy.Parse(u.EscapedPath(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Path != "/images/photo.jpg" {
+		t.Errorf("unexpected path: %q", parsed.Path)
+	}
+	if !parsed.Config.SemanticEqual(img.Config) {
+		t.Errorf("want %s, got %s", img.Config, parsed.Config)
+	}
+}
+
+func TestSocialCard_Config_error(t *testing.T) {
+	font := &Font{Name: "Ryumin R-KL"}
+	cases := []struct {
+		name string
+		card *SocialCard
+	}{
+		{
+			name: "missing background",
+			card: &SocialCard{Title: "title", Theme: CardTheme{TitleFont: font}},
+		},
+		{
+			name: "missing title",
+			card: &SocialCard{Background: "/images/photo.jpg", Theme: CardTheme{TitleFont: font}},
+		},
+		{
+			name: "missing font",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title"},
+		},
+		{
+			name: "too large margin",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title", Theme: CardTheme{TitleFont: font, Margin: 600}},
+		},
+		{
+			name: "too many lines",
+			card: &SocialCard{Background: "/images/photo.jpg", Logo: "/images/logo.png", Title: "title", Theme: CardTheme{TitleFont: font, TitleLines: 6}},
+		},
+		{
+			name: "too wide badge",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title", Badge: "news", Theme: CardTheme{TitleFont: font, BadgeWidth: 1100}},
+		},
+		{
+			name: "too wide logo",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title", Logo: "/images/logo.png", Width: 300, Theme: CardTheme{TitleFont: font}},
+		},
+		{
+			name: "overlapping logo and badge",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title", Logo: "/images/logo.png", Badge: "news", Theme: CardTheme{TitleFont: font, LogoWidth: 600, BadgeWidth: 600}},
+		},
+		{
+			name: "negative size",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title", Theme: CardTheme{TitleFont: font, TitleSize: -1}},
+		},
+		{
+			name: "negative margin",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title", Theme: CardTheme{TitleFont: font, Margin: -10}},
+		},
+		{
+			name: "negative width",
+			card: &SocialCard{Background: "/images/photo.jpg", Title: "title", Width: -1, Theme: CardTheme{TitleFont: font}},
+		},
+	}
+	for _, tt := range cases {
+		if _, err := tt.card.Config(); err == nil {
+			t.Errorf("%s: want error, got nil", tt.name)
+		}
+	}
+}
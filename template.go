@@ -0,0 +1,214 @@
+package imageflux
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"hash"
+	"sync"
+)
+
+// URLTemplate is a compiled URL template for signing many paths with the same Config.
+// It is created by Proxy.Compile.
+//
+// The parameter segment of the URL is rendered only once,
+// and the HMAC state after hashing the shared prefix of the payload is cached,
+// so each call only hashes the path.
+//
+// A URLTemplate is safe for concurrent use by multiple goroutines.
+type URLTemplate struct {
+	proxy  *Proxy
+	config *Config
+
+	// params is the rendered parameter segment, e.g. "w=200%2Cf=webp".
+	params []byte
+
+	// pathPrefix is PathPrefix of the proxy at compile time, e.g. "/images".
+	pathPrefix []byte
+
+	// signed is true if the proxy has the signing secret.
+	signed bool
+
+	prefixSigner
+}
+
+// prefixSigner signs payloads that share the same prefix.
+// The HMAC state after hashing the prefix is cached,
+// so each call only hashes the rest of the payload.
+type prefixSigner struct {
+	// the marshaled SHA-256 states of the inner and the outer hash of HMAC.
+	// The inner state has already hashed the shared prefix of the payload.
+	// They are nil if the hash doesn't support marshaling.
+	inner []byte
+	outer []byte
+
+	// payload is the shared prefix of the payload.
+	// mac is the pool of HMAC states for the secret.
+	// They are used when the hash doesn't support marshaling.
+	payload []byte
+	mac     *macPool
+
+	pool sync.Pool
+}
+
+type templateState struct {
+	inner hash.Hash
+	outer hash.Hash
+	sum   [sha256.Size]byte
+}
+
+// Compile compiles the config into a URL template.
+// The template captures a copy of cfg, the signing secret, PathPrefix and SignPathPrefix of the proxy,
+// so changing them after Compile doesn't affect the template.
+// The other fields of the proxy, such as Host, are read on each call.
+func (p *Proxy) Compile(cfg *Config) *URLTemplate {
+	cfg = cfg.clone()
+	t := &URLTemplate{
+		proxy:      p,
+		config:     cfg,
+		params:     cfg.append(nil),
+		pathPrefix: p.appendPathPrefix(nil),
+		signed:     p.hasSecret(),
+	}
+	if !t.signed {
+		return t
+	}
+
+	var payload []byte
+	if p.SignPathPrefix {
+		payload = append(payload, t.pathPrefix...)
+	}
+	payload = append(payload, "/c/"...)
+	payload = append(payload, t.params...)
+	t.init(p.secret(), payload)
+	return t
+}
+
+// init initializes the signer with the secret and the shared prefix of the payload.
+func (s *prefixSigner) init(secret, payload []byte) {
+	s.payload = payload
+	s.pool.New = func() any {
+		return &templateState{
+			inner: sha256.New(),
+			outer: sha256.New(),
+		}
+	}
+
+	// HMAC(K, m) = H((K ^ opad) || H((K ^ ipad) || m))
+	const blockSize = 64 // the block size of SHA-256
+	secret = bytes.Clone(secret)
+	var key [blockSize]byte
+	if len(secret) > blockSize {
+		sum := sha256.Sum256(secret)
+		copy(key[:], sum[:])
+	} else {
+		copy(key[:], secret)
+	}
+	var ipad, opad [blockSize]byte
+	for i := range key {
+		ipad[i] = key[i] ^ 0x36
+		opad[i] = key[i] ^ 0x5c
+	}
+
+	inner := sha256.New()
+	outer := sha256.New()
+	mi, ok1 := inner.(encoding.BinaryMarshaler)
+	mo, ok2 := outer.(encoding.BinaryMarshaler)
+	_, ok3 := inner.(encoding.BinaryUnmarshaler)
+	if !ok1 || !ok2 || !ok3 {
+		// the hash doesn't support marshaling.
+		// fall back to hashing the whole payload.
+		s.mac = newMACPool(secret)
+		return
+	}
+	inner.Write(ipad[:])
+	inner.Write(payload)
+	outer.Write(opad[:])
+	innerState, err1 := mi.MarshalBinary()
+	outerState, err2 := mo.MarshalBinary()
+	if err1 != nil || err2 != nil {
+		s.mac = newMACPool(secret)
+		return
+	}
+	s.inner = innerState
+	s.outer = outerState
+}
+
+// Image returns the image at path.
+// The config of the image is a copy of the compiled config,
+// so changing it doesn't affect the template.
+func (t *URLTemplate) Image(path string) *Image {
+	return t.proxy.Image(path, t.config.clone())
+}
+
+// SignedURL returns the signed URL of the image at path.
+// It returns the same URL as t.Image(path).SignedURL().
+func (t *URLTemplate) SignedURL(path string) string {
+	pbuf := bufPool.Get().(*[]byte)
+	buf := t.AppendSignedURL((*pbuf)[:0], path)
+	str := string(buf)
+	*pbuf = buf
+	bufPool.Put(pbuf)
+	return str
+}
+
+// AppendSignedURL appends the signed URL of the image at path to dst and returns the extended buffer.
+func (t *URLTemplate) AppendSignedURL(dst []byte, path string) []byte {
+	p := t.proxy
+	dst = p.appendOrigin(dst, p.hostFor(path))
+	dst = append(dst, t.pathPrefix...)
+	dst = append(dst, "/c/"...)
+	if !t.signed {
+		dst = append(dst, t.params...)
+		return appendImagePath(dst, path)
+	}
+
+	dst = append(dst, "sig="...)
+	sigStart := len(dst)
+	dst = append(dst, signaturePlaceholder...)
+	dst = appendComma(dst)
+	dst = append(dst, t.params...)
+	pathStart := len(dst)
+	dst = appendImagePath(dst, path)
+	t.encodeSignature(dst[sigStart:sigStart+signatureLen], dst[pathStart:])
+	return dst
+}
+
+// Sign returns the signature of the image at path.
+func (t *URLTemplate) Sign(path string) string {
+	if !t.signed {
+		return ""
+	}
+
+	pbuf := bufPool.Get().(*[]byte)
+	buf := appendImagePath((*pbuf)[:0], path)
+	var sig [signatureLen]byte
+	t.encodeSignature(sig[:], buf)
+	*pbuf = buf
+	bufPool.Put(pbuf)
+	return string(sig[:])
+}
+
+// encodeSignature writes the signature of the shared payload + suffix to dst.
+func (s *prefixSigner) encodeSignature(dst, suffix []byte) {
+	if s.inner == nil {
+		s.mac.encodeSignature(dst, s.payload, suffix)
+		return
+	}
+
+	state := s.pool.Get().(*templateState)
+	inner := state.inner
+	outer := state.outer
+	inner.(encoding.BinaryUnmarshaler).UnmarshalBinary(s.inner)
+	inner.Write(suffix)
+	sum := inner.Sum(state.sum[:0])
+	outer.(encoding.BinaryUnmarshaler).UnmarshalBinary(s.outer)
+	outer.Write(sum)
+	sum = outer.Sum(state.sum[:0])
+
+	dst[0] = '1'
+	dst[1] = '.'
+	base64.URLEncoding.Encode(dst[2:], sum)
+	s.pool.Put(state)
+}
@@ -0,0 +1,232 @@
+package imageflux
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+var urlTemplateCases = []struct {
+	proxy  *Proxy
+	config *Config
+}{
+	{
+		proxy: &Proxy{
+			Host: "demo.imageflux.jp",
+		},
+		config: &Config{
+			Width: 200,
+		},
+	},
+	{
+		proxy: &Proxy{
+			Host:        "demo.imageflux.jp",
+			SecretBytes: []byte("testsigningsecret"),
+		},
+		config: nil,
+	},
+	{
+		proxy: &Proxy{
+			Host:        "demo.imageflux.jp",
+			SecretBytes: []byte("testsigningsecret"),
+		},
+		config: &Config{
+			Width:   200,
+			Format:  FormatWebPAuto,
+			Expires: time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC),
+		},
+	},
+	{
+		proxy: &Proxy{
+			Hosts:          []string{"img1.example.com", "img2.example.com"},
+			Scheme:         "http",
+			Port:           8080,
+			PathPrefix:     "/img",
+			SignPathPrefix: true,
+			Secret:         "testsigningsecret",
+		},
+		config: &Config{
+			Width: 200,
+		},
+	},
+	{
+		// the secret is longer than the block size of SHA-256.
+		proxy: &Proxy{
+			Host:        "demo.imageflux.jp",
+			SecretBytes: []byte(strings.Repeat("testsigningsecret", 10)),
+		},
+		config: &Config{
+			Width: 200,
+		},
+	},
+}
+
+func TestURLTemplate(t *testing.T) {
+	paths := []string{"/images/1.jpg", "images/2.jpg", "/images/3.jpg"}
+	for i, c := range urlTemplateCases {
+		tmpl := c.proxy.Compile(c.config)
+		for _, path := range paths {
+			img := c.proxy.Image(path, c.config)
+			if got, want := tmpl.SignedURL(path), img.SignedURL(); got != want {
+				t.Errorf("%d, %q: want %s, got %s", i, path, want, got)
+			}
+			if got, want := tmpl.Sign(path), img.Sign(); got != want {
+				t.Errorf("%d, %q: want %s, got %s", i, path, want, got)
+			}
+			if got, want := tmpl.Image(path).SignedURL(), img.SignedURL(); got != want {
+				t.Errorf("%d, %q: want %s, got %s", i, path, want, got)
+			}
+		}
+	}
+}
+
+func TestURLTemplate_fallback(t *testing.T) {
+	// emulate the hash that doesn't support marshaling.
+	for i, c := range urlTemplateCases {
+		tmpl := c.proxy.Compile(c.config)
+		tmpl.inner = nil
+		tmpl.outer = nil
+		tmpl.mac = newMACPool(c.proxy.secret())
+
+		img := c.proxy.Image("/images/1.jpg", c.config)
+		if got, want := tmpl.SignedURL("/images/1.jpg"), img.SignedURL(); got != want {
+			t.Errorf("%d: want %s, got %s", i, want, got)
+		}
+	}
+}
+
+func TestURLTemplate_secretChanged(t *testing.T) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	tmpl := proxy.Compile(&Config{Width: 200})
+	proxy.SecretBytes = []byte("oldsecret")
+
+	want := "https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg"
+	if got := tmpl.SignedURL("/images/1.jpg"); got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+}
+
+func TestURLTemplate_pathPrefixChanged(t *testing.T) {
+	proxy := &Proxy{
+		Host:           "demo.imageflux.jp",
+		SecretBytes:    []byte("testsigningsecret"),
+		PathPrefix:     "/img",
+		SignPathPrefix: true,
+	}
+	tmpl := proxy.Compile(&Config{Width: 200})
+	want := proxy.Image("/images/1.jpg", &Config{Width: 200}).SignedURL()
+
+	// changing the path prefix after Compile doesn't affect the template.
+	verifier := *proxy
+	proxy.PathPrefix = "/other"
+	proxy.SignPathPrefix = false
+	got := tmpl.SignedURL("/images/1.jpg")
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	res, err := verifier.Verify(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid {
+		t.Errorf("the signature of %s is invalid", got)
+	}
+}
+
+func TestURLTemplate_configChanged(t *testing.T) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	cfg := &Config{
+		Width:    200,
+		Overlays: []*Overlay{{Path: "/images/logo.png"}},
+		Texts:    []*Text{{Font: &Font{Name: "Noto Sans JP"}, Text: "hello"}},
+	}
+	tmpl := proxy.Compile(cfg)
+	want := tmpl.SignedURL("/images/1.jpg")
+
+	cfg.Width = 300
+	cfg.Overlays[0].Path = "/images/other.png"
+	cfg.Texts[0].Font.Name = "Noto Serif JP"
+	cfg.Texts[0].Text = "world"
+
+	if got := tmpl.SignedURL("/images/1.jpg"); got != want {
+		t.Errorf("SignedURL: want %s, got %s", want, got)
+	}
+	if got := tmpl.Image("/images/1.jpg").SignedURL(); got != want {
+		t.Errorf("Image.SignedURL: want %s, got %s", want, got)
+	}
+
+	// changing the config of the image doesn't affect the template.
+	img := tmpl.Image("/images/1.jpg")
+	img.Config.Width = 400
+	if got := tmpl.Image("/images/1.jpg").SignedURL(); got != want {
+		t.Errorf("Image.SignedURL: want %s, got %s", want, got)
+	}
+}
+
+func TestURLTemplate_concurrent(t *testing.T) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	tmpl := proxy.Compile(&Config{Width: 200})
+	want := "https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg"
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if got := tmpl.SignedURL("/images/1.jpg"); got != want {
+					t.Errorf("want %s, got %s", want, got)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestURLTemplate_AppendSignedURL_allocs(t *testing.T) {
+	if raceEnabled {
+		t.Skip("skipping allocation tests in the race mode")
+	}
+
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	tmpl := proxy.Compile(&Config{Width: 200})
+	buf := make([]byte, 0, 256)
+	allocs := testing.AllocsPerRun(100, func() {
+		buf = tmpl.AppendSignedURL(buf[:0], "/images/1.jpg")
+	})
+	if allocs != 0 {
+		t.Errorf("want no allocation, got %f", allocs)
+	}
+}
+
+func BenchmarkURLTemplate_AppendSignedURL(b *testing.B) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	tmpl := proxy.Compile(&Config{
+		Width:  200,
+		Height: 200,
+		Format: FormatWebPAuto,
+	})
+	buf := make([]byte, 0, 256)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf = tmpl.AppendSignedURL(buf[:0], "/images/1.jpg")
+	}
+}
@@ -61,6 +61,7 @@ type Text struct {
 	OffsetRatio image.Point
 
 	// OffsetMax is the denominators of OffsetRatio.
+	// If OffsetMax.X or OffsetMax.Y is zero, the ratio of the axis is not used.
 	OffsetMax image.Point
 
 	// OverlayOrigin is the position of the overlay image origin.
@@ -74,6 +75,9 @@ type Text struct {
 
 	// Text is the text string.
 	Text string
+
+	// Extra is the values of the custom parameters registered by RegisterParam.
+	Extra map[string]string
 }
 
 func (t *Text) String() string {
@@ -81,144 +85,17 @@ func (t *Text) String() string {
 }
 
 func (t *Text) append(buf []byte) []byte {
-	var zp image.Point
-
 	if t == nil {
 		return buf
 	}
 
-	buf = append(buf, "font="...)
-	buf = t.Font.append(buf)
-	buf = appendComma(buf)
-
-	buf = append(buf, "size="...)
-	buf = strconv.AppendFloat(buf, t.Size, 'f', -1, 64)
-	buf = appendComma(buf)
-
-	if t.Foreground != nil {
-		f := color.NRGBAModel.Convert(t.Foreground).(color.NRGBA)
-		buf = append(buf, "f="...)
-		if f.A == 0xff {
-			// opaque foreground color
-			buf = appendByte(buf, f.R)
-			buf = appendByte(buf, f.G)
-			buf = appendByte(buf, f.B)
-		} else {
-			// transparent foreground color
-			buf = appendByte(buf, f.R)
-			buf = appendByte(buf, f.G)
-			buf = appendByte(buf, f.B)
-			buf = appendByte(buf, f.A)
+	for _, p := range textParams {
+		if p.Key == "text" {
+			// text MUST be the last parameter because it can contain any character.
+			buf = appendExtra(buf, t.Extra)
 		}
-		buf = appendComma(buf)
+		buf = p.appendText(buf, t)
 	}
-
-	if t.Background != nil {
-		b := color.NRGBAModel.Convert(t.Background).(color.NRGBA)
-		buf = append(buf, "b="...)
-		if b.A == 0xff {
-			// opaque background color
-			buf = appendByte(buf, b.R)
-			buf = appendByte(buf, b.G)
-			buf = appendByte(buf, b.B)
-		} else {
-			// transparent background color
-			buf = appendByte(buf, b.R)
-			buf = appendByte(buf, b.G)
-			buf = appendByte(buf, b.B)
-			buf = appendByte(buf, b.A)
-		}
-		buf = appendComma(buf)
-	}
-
-	// width
-	buf = append(buf, "w="...)
-	buf = strconv.AppendInt(buf, int64(t.Width), 10)
-	buf = appendComma(buf)
-
-	// height
-	buf = append(buf, "h="...)
-	buf = strconv.AppendInt(buf, int64(t.Height), 10)
-	buf = appendComma(buf)
-
-	if t.LineSpacing != 0 {
-		buf = append(buf, "linespacing="...)
-		buf = strconv.AppendFloat(buf, t.LineSpacing, 'f', -1, 64)
-		buf = appendComma(buf)
-	}
-
-	if t.Align != 0 {
-		buf = append(buf, "align="...)
-		buf = strconv.AppendInt(buf, int64(t.Align), 10)
-		buf = appendComma(buf)
-	}
-
-	if t.Direction != 0 {
-		buf = append(buf, "dir="...)
-		buf = strconv.AppendInt(buf, int64(t.Direction), 10)
-		buf = appendComma(buf)
-	}
-
-	if t.Wrap != 0 {
-		buf = append(buf, "wrap="...)
-		buf = strconv.AppendInt(buf, int64(t.Wrap), 10)
-		buf = appendComma(buf)
-	}
-
-	if t.Ellipsize {
-		buf = append(buf, "ellipsize=1"...)
-		buf = appendComma(buf)
-	}
-
-	if t.Justify {
-		buf = append(buf, "justify=1"...)
-		buf = appendComma(buf)
-	}
-
-	if t.Strike {
-		buf = append(buf, "strike=1"...)
-		buf = appendComma(buf)
-	}
-
-	if t.Offset != zp {
-		buf = append(buf, "x="...)
-		buf = strconv.AppendInt(buf, int64(t.Offset.X), 10)
-		buf = appendComma(buf)
-		buf = append(buf, "y="...)
-		buf = strconv.AppendInt(buf, int64(t.Offset.Y), 10)
-		buf = appendComma(buf)
-	}
-	if t.OffsetRatio != zp && t.OffsetMax.X != 0 && t.OffsetMax.Y != 0 {
-		x := float64(t.OffsetRatio.X) / float64(t.OffsetMax.X)
-		y := float64(t.OffsetRatio.Y) / float64(t.OffsetMax.Y)
-		buf = append(buf, "xr="...)
-		buf = strconv.AppendFloat(buf, x, 'f', -1, 64)
-		buf = appendComma(buf)
-		buf = append(buf, "yr="...)
-		buf = strconv.AppendFloat(buf, y, 'f', -1, 64)
-		buf = appendComma(buf)
-	}
-
-	if t.OverlayOrigin != OriginDefault {
-		buf = append(buf, "lg="...)
-		buf = strconv.AppendInt(buf, int64(t.OverlayOrigin), 10)
-		buf = appendComma(buf)
-	}
-
-	// mask
-	if t.MaskType != "" {
-		buf = append(buf, "mask="...)
-		buf = append(buf, t.MaskType...)
-		if t.PaddingMode != 0 {
-			buf = append(buf, ':')
-			buf = strconv.AppendInt(buf, int64(t.PaddingMode), 10)
-		}
-		buf = appendComma(buf)
-	}
-
-	// text MUST be the last parameter because it can contain any character.
-	buf = append(buf, "text="...)
-	buf = append(buf, url.PathEscape(t.Text)...)
 	return buf
 }
 
@@ -246,7 +123,7 @@ func (f *Font) String() string {
 }
 
 func (f *Font) append(buf []byte) []byte {
-	if f == nil || f.Name == "" {
+	if f == nil || (f.Name == "" && f.Instance == "" && len(f.Variables) == 0) {
 		return buf
 	}
 	if f.Instance == "" && len(f.Variables) == 0 {
@@ -289,62 +166,54 @@ func (f *Font) append(buf []byte) []byte {
 	return buf
 }
 
-type parseFontState struct {
-	s    string
-	idx  int
-	font *Font
-}
-
 func ParseFont(s string) (*Font, error) {
-	state := &parseFontState{
-		s:    s,
-		idx:  0,
-		font: &Font{},
-	}
-	return state.parseFont()
-}
-
-func (s *parseFontState) parseFont() (*Font, error) {
-	if s.idx >= len(s.s) || s.s[s.idx] != '(' {
-		name, err := url.PathUnescape(s.s)
+	font := &Font{}
+	if !strings.HasPrefix(s, "(") {
+		name, err := url.PathUnescape(s)
 		if err != nil {
-			return nil, fmt.Errorf("imageflux: invalid font name %q: %w", s.s, err)
+			return nil, fmt.Errorf("imageflux: invalid font name %q: %w", s, err)
+		}
+		font.Name = name
+		return font, nil
+	}
+	inner, ok := strings.CutSuffix(s[1:], ")")
+	if !ok {
+		if strings.Contains(s, ")") {
+			return nil, fmt.Errorf("imageflux: extra characters after closing parenthesis in font specification: %q", s)
 		}
-		s.font.Name = name
-		return s.font, nil
+		return nil, errors.New("imageflux: unexpected end of font specification")
 	}
-	s.idx++
+	t := newNestedTokenizer(inner, modeFont)
 
 	// parse font name
-	name, err := url.PathUnescape(s.getValue())
+	rawName, err := t.getValue()
 	if err != nil {
-		return nil, fmt.Errorf("imageflux: invalid font name %q: %w", s.s, err)
+		return nil, fmt.Errorf("imageflux: invalid font specification %q: %w", s, err)
+	}
+	name, err := url.PathUnescape(rawName)
+	if err != nil {
+		return nil, fmt.Errorf("imageflux: invalid font name %q: %w", s, err)
+	}
+	font.Name = name
+	if !t.skipComma() && t.Rest() != "" {
+		return nil, fmt.Errorf("imageflux: unexpected character %q in font specification", t.Rest()[0])
 	}
-	s.font.Name = name
 
 	// parse parameters
-	for s.idx < len(s.s) && s.s[s.idx] != ')' {
-		if !s.skipComma() {
-			return nil, fmt.Errorf("imageflux: unexpected character %q in font specification", s.s[s.idx])
-		}
-
-		key, foundEqual := s.getKey()
-		if !foundEqual {
-			return nil, fmt.Errorf("imageflux: missing '=' after key %q in font specification", key)
-		}
-		value := s.getValue()
-		switch key {
+	for t.Next() {
+		tok := t.Token()
+		switch tok.Key {
 		case "instance":
-			instance, err := url.PathUnescape(value)
+			instance, err := url.PathUnescape(tok.RawValue)
 			if err != nil {
-				return nil, fmt.Errorf("imageflux: invalid instance value %q: %w", value, err)
+				return nil, fmt.Errorf("imageflux: invalid instance value %q: %w", tok.RawValue, err)
 			}
-			s.font.Instance = instance
+			font.Instance = instance
 
 		case "var":
-			value, err := url.PathUnescape(value)
+			value, err := url.PathUnescape(tok.RawValue)
 			if err != nil {
-				return nil, fmt.Errorf("imageflux: invalid variable font specification %q: %w", value, err)
+				return nil, fmt.Errorf("imageflux: invalid variable font specification %q: %w", tok.RawValue, err)
 			}
 			before, after, ok := strings.Cut(value, ":")
 			if !ok {
@@ -358,72 +227,22 @@ func (s *parseFontState) parseFont() (*Font, error) {
 			if math.IsNaN(v) || math.IsInf(v, 0) {
 				return nil, fmt.Errorf("imageflux: invalid variable font value %q", after)
 			}
-			if s.font.Variables == nil {
-				s.font.Variables = make(map[string]float64)
+			if font.Variables == nil {
+				font.Variables = make(map[string]float64)
 			}
-			s.font.Variables[tag] = v
+			font.Variables[tag] = v
 
 		default:
-			return nil, fmt.Errorf("imageflux: unknown key %q in font specification", key)
-		}
-	}
-	if s.idx >= len(s.s) || s.s[s.idx] != ')' {
-		return nil, errors.New("imageflux: unexpected end of font specification")
-	}
-	s.idx++
-	if s.idx < len(s.s) {
-		return nil, fmt.Errorf("imageflux: extra characters after closing parenthesis in font specification: %q", s.s[s.idx:])
-	}
-
-	return s.font, nil
-}
-
-func (s *parseFontState) getKey() (key string, foundEqual bool) {
-	i := s.idx
-	for ; i < len(s.s); i++ {
-		switch s.s[i] {
-		case '=':
-			key = s.s[s.idx:i]
-			s.idx = i + 1
-			return key, true
-		case ')':
-			key = s.s[s.idx:i]
-			s.idx = i + 1
-			return key, false
+			return nil, fmt.Errorf("imageflux: unknown key %q in font specification", tok.Key)
 		}
 	}
-	return s.s[s.idx:i], false
-}
-
-func (s *parseFontState) getValue() string {
-	i := s.idx
-LOOP:
-	for ; i < len(s.s); i++ {
-		switch s.s[i] {
-		case ',', ')':
-			break LOOP
-		case '%':
-			if i+3 < len(s.s) && (s.s[i:i+3] == "%2c" || s.s[i:i+3] == "%2C") {
-				break LOOP
-			}
-		}
-	}
-	value := s.s[s.idx:i]
-	s.idx = i
-	return value
-}
-
-func (s *parseFontState) skipComma() (skipped bool) {
-	if s.idx < len(s.s) && s.s[s.idx] == ',' {
-		s.idx++
-		return true
+	if err := t.Err(); err != nil {
+		return nil, fmt.Errorf("imageflux: invalid font specification %q: %w", s, err)
 	}
-	if s.idx+3 < len(s.s) && (s.s[s.idx:s.idx+3] == "%2c" || s.s[s.idx:s.idx+3] == "%2C") {
-		// "%2C" is encoded comma ','.
-		s.idx += 3
-		return true
+	if rest := t.Rest(); rest != "" {
+		return nil, fmt.Errorf("imageflux: unexpected %q in font specification", rest)
 	}
-	return false
+	return font, nil
 }
 
 // TextAlign specifies the alignment of the text.
@@ -489,93 +308,44 @@ const (
 )
 
 type textParseState struct {
-	s    string
-	idx  int
+	Tokenizer
 	text *Text
 }
 
 func ParseText(s string) (*Text, error) {
 	state := &textParseState{
-		s:    s,
-		idx:  0,
-		text: &Text{},
+		Tokenizer: newNestedTokenizer(s, modeText),
+		text:      &Text{},
 	}
 	return state.parseText()
 }
 
-func (s *textParseState) getKey() (key string, foundEqual bool) {
-	i := s.idx
-	for ; i < len(s.s); i++ {
-		switch s.s[i] {
-		case '=':
-			key = s.s[s.idx:i]
-			s.idx = i + 1
-			return key, true
-		}
-	}
-	return s.s[s.idx:i], false
-}
-
-func (s *textParseState) getValue() string {
-	i := s.idx
-LOOP:
-	for ; i < len(s.s); i++ {
-		switch s.s[i] {
-		case ',':
-			break LOOP
-		case '%':
-			if i+3 <= len(s.s) && (s.s[i:i+3] == "%2c" || s.s[i:i+3] == "%2C") {
-				break LOOP
-			}
-		}
-	}
-	value := s.s[s.idx:i]
-	s.idx = i
-	return value
-}
-
-func (s *textParseState) skipComma() (skipped bool) {
-	if s.idx < len(s.s) && s.s[s.idx] == ',' {
-		s.idx++
-		return true
-	}
-	if s.idx+3 <= len(s.s) && (s.s[s.idx:s.idx+3] == "%2c" || s.s[s.idx:s.idx+3] == "%2C") {
-		// "%2C" is encoded comma ','.
-		s.idx += 3
-		return true
-	}
-	return false
-}
-
 func (s *textParseState) parseText() (*Text, error) {
+	var rawText string
 	foundText := false
-	for s.idx < len(s.s) {
-		key, foundEqual := s.getKey()
-		if !foundEqual {
-			if key != "" {
-				return nil, fmt.Errorf("imageflux: missing '=' after key %q", key)
-			}
-			return nil, errors.New("imageflux: unexpected ','")
-		}
-		if key == "text" {
+	for s.Next() {
+		tok := s.Token()
+		if tok.Key == "text" {
+			rawText = tok.RawValue
 			foundText = true
 			break
 		}
-		value := s.getValue()
-		if err := s.setValue(key, value); err != nil {
+		if err := s.setValue(tok.Key, tok.RawValue); err != nil {
 			return nil, err
 		}
-		if !s.skipComma() {
-			return nil, fmt.Errorf("imageflux: unexpected character after key %q", key)
-		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
 	}
 	if !foundText {
+		if rest := s.Rest(); rest != "" {
+			return nil, fmt.Errorf("imageflux: unexpected %q in text specification", rest)
+		}
 		return nil, errors.New("imageflux: missing text parameter")
 	}
-	text := s.s[s.idx:]
-	text, err := url.PathUnescape(text)
+	text, err := url.PathUnescape(rawText)
 	if err != nil {
-		return nil, fmt.Errorf("imageflux: invalid text value %q: %w", text, err)
+		return nil, fmt.Errorf("imageflux: invalid text value %q: %w", rawText, err)
 	}
 	s.text.Text = text
 
@@ -616,100 +386,13 @@ func (s *textParseState) parseText() (*Text, error) {
 }
 
 func (s *textParseState) setValue(key, value string) error {
-	switch key {
-	case "font":
-		font, err := ParseFont(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid font specification %q: %w", value, err)
-		}
-		s.text.Font = font
-
-	case "size":
-		size, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid size value %q: %w", value, err)
+	p, ok := builtinParamsByKey[paramKey{TargetText, key}]
+	if !ok || p.parseText == nil {
+		found, err := setExtra(&s.text.Extra, nil, TargetText, key, value)
+		if !found {
+			return fmt.Errorf("imageflux: unknown key %q in text specification", key)
 		}
-		s.text.Size = size
-
-	case "f":
-		c, err := parseColor(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid foreground %q: %w", value, err)
-		}
-		s.text.Foreground = c
-
-	case "b":
-		c, err := parseColor(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid background %q: %w", value, err)
-		}
-		s.text.Background = c
-
-	case "w":
-		w, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid width value %q: %w", value, err)
-		}
-		s.text.Width = w
-
-	case "h":
-		h, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid height value %q: %w", value, err)
-		}
-		s.text.Height = h
-
-	case "linespacing":
-		lineSpacing, err := strconv.ParseFloat(value, 64)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid line spacing value %q: %w", value, err)
-		}
-		s.text.LineSpacing = lineSpacing
-
-	case "align":
-		align, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid align value %q: %w", value, err)
-		}
-		s.text.Align = TextAlign(align)
-
-	case "dir":
-		dir, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid direction value %q: %w", value, err)
-		}
-		s.text.Direction = TextDirection(dir)
-
-	case "wrap":
-		wrap, err := strconv.Atoi(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid wrap value %q: %w", value, err)
-		}
-		s.text.Wrap = TextWrap(wrap)
-
-	case "ellipsize":
-		v, err := parseBoolean(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid ellipsize value %q: %w", value, err)
-		}
-		s.text.Ellipsize = v
-
-	case "justify":
-		v, err := parseBoolean(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid justify value %q: %w", value, err)
-		}
-		s.text.Justify = v
-
-	case "strike":
-		v, err := parseBoolean(value)
-		if err != nil {
-			return fmt.Errorf("imageflux: invalid strike value %q: %w", value, err)
-		}
-		s.text.Strike = v
-
-	default:
-		return fmt.Errorf("imageflux: unknown key %q in text specification", key)
+		return err
 	}
-	return nil
+	return p.parseText(s, value)
 }
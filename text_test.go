@@ -3,6 +3,7 @@ package imageflux
 import (
 	"image"
 	"image/color"
+	"strings"
 	"testing"
 
 	"github.com/google/go-cmp/cmp"
@@ -420,6 +421,59 @@ var parseTextCases = []struct {
 		},
 	},
 
+	// named instance of the variable font, separated by raw commas in the parentheses.
+	{
+		input: "font=(DriveFlux,instance=B%20Italic),size=12,w=400,h=100,text=Hello%2C%20world%21",
+		expected: &Text{
+			Font: &Font{
+				Name:     "DriveFlux",
+				Instance: "B Italic",
+			},
+			Height: 100,
+			Width:  400,
+			Size:   12,
+			Text:   "Hello, world!",
+		},
+	},
+
+	// variable font
+	{
+		input: "font=(DriveFlux%2Cvar=slnt:-16%2Cvar=wght:700)%2Csize=12%2Cw=400%2Ch=100%2Ctext=Hello%2C%20world%21",
+		expected: &Text{
+			Font: &Font{
+				Name: "DriveFlux",
+				Variables: map[string]float64{
+					"slnt": -16,
+					"wght": 700,
+				},
+			},
+			Height: 100,
+			Width:  400,
+			Size:   12,
+			Text:   "Hello, world!",
+		},
+	},
+
+	// positioning
+	{
+		input: "font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,x=10,y=-20,xr=0.5,yr=0.25,lg=5,mask=alpha:1,text=Hello%2C%20world%21",
+		expected: &Text{
+			Font: &Font{
+				Name: "新ゴ R",
+			},
+			Height:        100,
+			Width:         400,
+			Size:          12,
+			Offset:        image.Pt(10, -20),
+			OffsetRatio:   image.Pt(32768, 16384),
+			OffsetMax:     image.Pt(65536, 65536),
+			OverlayOrigin: OriginMiddleCenter,
+			MaskType:      MaskTypeAlpha,
+			PaddingMode:   PaddingModeLeave,
+			Text:          "Hello, world!",
+		},
+	},
+
 	// use %2C instead of comma
 	{
 		input: "font=%E6%96%B0%E3%82%B4%20R%2Csize=12%2Cw=400%2Ch=100%2Ctext=Hello%2C%20world%21",
@@ -644,6 +698,23 @@ var parseTextErrorCases = []string{
 
 	// unknown key
 	"font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,unknown=value,text=Hello%2C%20world%21",
+
+	// offset: syntax error
+	"font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,x=invalid,text=Hello%2C%20world%21",
+	"font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,y=invalid,text=Hello%2C%20world%21",
+	"font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,xr=2,text=Hello%2C%20world%21",
+	"font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,yr=-1,text=Hello%2C%20world%21",
+
+	// overlay origin: out of range
+	"font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,lg=10,text=Hello%2C%20world%21",
+
+	// mask: syntax error
+	"font=%E6%96%B0%E3%82%B4%20R,size=12,w=400,h=100,mask=invalid,text=Hello%2C%20world%21",
+
+	// font: unbalanced parentheses
+	"font=(DriveFlux,instance=Bold,size=12,w=400,h=100,text=Hello%2C%20world%21",
+	"font=DriveFlux),size=12,w=400,h=100,text=Hello%2C%20world%21",
+	"font=(DriveFlux,instance=Bold)),size=12,w=400,h=100,text=Hello%2C%20world%21",
 }
 
 func TestParseText_Error(t *testing.T) {
@@ -654,6 +725,64 @@ func TestParseText_Error(t *testing.T) {
 	}
 }
 
+func TestParseText_roundTrip(t *testing.T) {
+	// all fields that can be represented in the URL.
+	want := &Text{
+		Font: &Font{
+			Name: "DriveFlux",
+			Variables: map[string]float64{
+				"wght": 700,
+			},
+		},
+		Size:          12.5,
+		Foreground:    color.NRGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff},
+		Background:    color.NRGBA{R: 0x44, G: 0x55, B: 0x66, A: 0x7f},
+		Width:         400,
+		Height:        100,
+		LineSpacing:   1.5,
+		Align:         TextAlignRight,
+		Direction:     TextDirectionRTL,
+		Wrap:          TextWrapLineChar,
+		Ellipsize:     true,
+		Justify:       true,
+		Strike:        true,
+		Offset:        image.Pt(-10, 20),
+		OffsetRatio:   image.Pt(32768, 16384),
+		OffsetMax:     image.Pt(65536, 65536),
+		OverlayOrigin: OriginBottomRight,
+		MaskType:      MaskTypeWhite,
+		PaddingMode:   PaddingModeLeave,
+		Text:          "Hello, world!",
+	}
+	got, err := ParseText(want.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("%q: mismatch (-want +got):\n%s", want.String(), diff)
+	}
+}
+
+func TestParseText_roundTrip_singleAxis(t *testing.T) {
+	tests := []string{
+		"font=DriveFlux,size=12,w=400,h=100,x=10,text=hello",
+		"font=DriveFlux,size=12,w=400,h=100,y=-20,text=hello",
+		"font=DriveFlux,size=12,w=400,h=100,xr=0.5,text=hello",
+		"font=DriveFlux,size=12,w=400,h=100,yr=0.25,text=hello",
+		"font=DriveFlux,size=12,w=400,h=100,xr=0,text=hello",
+	}
+	for _, input := range tests {
+		text, err := ParseText(input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", input, err)
+			continue
+		}
+		if got := strings.ReplaceAll(text.String(), "%2C", ","); got != input {
+			t.Errorf("%q: want %q, got %q", input, input, got)
+		}
+	}
+}
+
 func FuzzParseText(f *testing.F) {
 	for _, c := range parseTextCases {
 		f.Add(c.input)
@@ -0,0 +1,235 @@
+package imageflux
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"text/template"
+)
+
+// TextTemplate is a Text whose string is rendered from a text/template.
+// The other fields of the Text are fixed.
+//
+// A TextTemplate is safe for concurrent use by multiple goroutines.
+type TextTemplate struct {
+	text *Text
+	tmpl *template.Template
+}
+
+// NewTextTemplate parses t.Text as a text/template, e.g. "{{.Price}} OFF".
+// The template captures a copy of t, so changing t after NewTextTemplate doesn't affect the template.
+// Referring to a missing key of a map is an error.
+func NewTextTemplate(t *Text) (*TextTemplate, error) {
+	tmpl, err := newTextTemplate(t)
+	if err != nil {
+		return nil, fmt.Errorf("imageflux: %w", err)
+	}
+	return tmpl, nil
+}
+
+// newTextTemplate is NewTextTemplate without the prefix of the errors.
+func newTextTemplate(t *Text) (*TextTemplate, error) {
+	if t == nil {
+		return nil, errors.New("the text of the template is nil")
+	}
+	tmpl, err := template.New("text").Option("missingkey=error").Parse(t.Text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid text template: %w", err)
+	}
+	return &TextTemplate{
+		text: t.clone(),
+		tmpl: tmpl,
+	}, nil
+}
+
+// Execute returns a copy of the Text whose string is rendered with data.
+func (t *TextTemplate) Execute(data any) (*Text, error) {
+	s, err := t.execute(data)
+	if err != nil {
+		return nil, err
+	}
+	text := t.text.clone()
+	text.Text = s
+	return text, nil
+}
+
+func (t *TextTemplate) execute(data any) (string, error) {
+	var sb strings.Builder
+	if err := t.tmpl.Execute(&sb, data); err != nil {
+		return "", fmt.Errorf("imageflux: failed to render the text template: %w", err)
+	}
+	return sb.String(), nil
+}
+
+// ConfigTemplate is a compiled Config whose texts are rendered from text/template.
+// It is created by Proxy.CompileTemplate.
+//
+// The parameter segment of the URL except the strings of the texts is rendered only once,
+// and the HMAC state after hashing the parameters before the first text is cached,
+// so each call only renders the strings and hashes the rest of the URL.
+//
+// A ConfigTemplate is safe for concurrent use by multiple goroutines.
+type ConfigTemplate struct {
+	proxy  *Proxy
+	config *Config
+	texts  []*TextTemplate
+
+	// chunks are the static parts of the parameter segment.
+	// The escaped strings of the texts are placed between them,
+	// so len(chunks) == len(texts)+1.
+	chunks [][]byte
+
+	// pathPrefix is PathPrefix of the proxy at compile time, e.g. "/images".
+	pathPrefix []byte
+
+	// signed is true if the proxy has the signing secret.
+	signed bool
+
+	prefixSigner
+}
+
+// CompileTemplate compiles the config into a template.
+// The Text field of each Text in cfg.Texts is parsed as a text/template,
+// and the other fields are fixed.
+// The template captures a copy of cfg, the signing secret, PathPrefix and SignPathPrefix of the proxy,
+// so changing them after CompileTemplate doesn't affect the template.
+// The other fields of the proxy, such as Host, are read on each call.
+func (p *Proxy) CompileTemplate(cfg *Config) (*ConfigTemplate, error) {
+	if cfg == nil {
+		cfg = &Config{}
+	}
+	cfg = cfg.clone()
+	texts := make([]*TextTemplate, 0, len(cfg.Texts))
+	for i, text := range cfg.Texts {
+		tmpl, err := newTextTemplate(text)
+		if err != nil {
+			return nil, fmt.Errorf("imageflux: text %d: %w", i, err)
+		}
+		texts = append(texts, tmpl)
+	}
+
+	t := &ConfigTemplate{
+		proxy:      p,
+		config:     cfg,
+		texts:      texts,
+		chunks:     splitParams(cfg),
+		pathPrefix: p.appendPathPrefix(nil),
+		signed:     p.hasSecret(),
+	}
+	if !t.signed {
+		return t, nil
+	}
+
+	var payload []byte
+	if p.SignPathPrefix {
+		payload = append(payload, t.pathPrefix...)
+	}
+	payload = append(payload, "/c/"...)
+	payload = append(payload, t.chunks[0]...)
+	t.init(p.secret(), payload)
+	return t, nil
+}
+
+// splitParams renders c and splits it at the strings of c.Texts.
+// It returns the same parameters as c.append, except the strings of the texts.
+func splitParams(c *Config) [][]byte {
+	if len(c.Texts) == 0 {
+		return [][]byte{c.append(nil)}
+	}
+
+	textKey := []byte("text=")
+	chunks := make([][]byte, 0, len(c.Texts)+1)
+	var buf []byte
+	for _, p := range configParams {
+		if p.appendConfig == nil {
+			continue
+		}
+		if p.Key != "t" {
+			buf = p.appendConfig(buf, c)
+			continue
+		}
+
+		// render each text with the empty string,
+		// and split it after the key of the string, which is the last parameter of the text.
+		for _, text := range c.Texts {
+			empty := *text
+			empty.Text = ""
+			start := len(buf)
+			buf = p.appendConfig(buf, &Config{Texts: []*Text{&empty}})
+			i := start + bytes.LastIndex(buf[start:], textKey) + len(textKey)
+			chunks = append(chunks, buf[:i:i])
+			buf = append([]byte(nil), buf[i:]...)
+		}
+	}
+	buf = appendExtra(buf, c.Extra)
+	buf = bytes.TrimSuffix(buf, comma)
+	return append(chunks, buf)
+}
+
+// Execute returns a copy of the config whose texts are rendered with data.
+func (t *ConfigTemplate) Execute(data any) (*Config, error) {
+	cfg := t.config.clone()
+	for i, text := range t.texts {
+		rendered, err := text.Execute(data)
+		if err != nil {
+			return nil, err
+		}
+		cfg.Texts[i] = rendered
+	}
+	return cfg, nil
+}
+
+// Image returns the image at path with the texts rendered with data.
+func (t *ConfigTemplate) Image(path string, data any) (*Image, error) {
+	cfg, err := t.Execute(data)
+	if err != nil {
+		return nil, err
+	}
+	return t.proxy.Image(path, cfg), nil
+}
+
+// SignedURL returns the signed URL of the image at path with the texts rendered with data.
+// It returns the same URL as the SignedURL of the image returned by t.Image(path, data).
+func (t *ConfigTemplate) SignedURL(path string, data any) (string, error) {
+	pbuf := bufPool.Get().(*[]byte)
+	buf, err := t.AppendSignedURL((*pbuf)[:0], path, data)
+	str := string(buf)
+	*pbuf = buf
+	bufPool.Put(pbuf)
+	return str, err
+}
+
+// AppendSignedURL appends the signed URL of the image at path with the texts rendered with data to dst,
+// and returns the extended buffer.
+// If rendering fails, it returns dst unchanged and the error.
+func (t *ConfigTemplate) AppendSignedURL(dst []byte, path string, data any) ([]byte, error) {
+	p := t.proxy
+	orig := dst
+	dst = p.appendOrigin(dst, p.hostFor(path))
+	dst = append(dst, t.pathPrefix...)
+	dst = append(dst, "/c/"...)
+	sigStart := len(dst)
+	if t.signed {
+		dst = append(dst, "sig="...)
+		sigStart = len(dst)
+		dst = append(dst, signaturePlaceholder...)
+		dst = appendComma(dst)
+	}
+	dst = append(dst, t.chunks[0]...)
+	suffixStart := len(dst)
+	for i, text := range t.texts {
+		s, err := text.execute(data)
+		if err != nil {
+			return orig, err
+		}
+		dst = append(dst, url.PathEscape(s)...)
+		dst = append(dst, t.chunks[i+1]...)
+	}
+	dst = appendImagePath(dst, path)
+	if t.signed {
+		t.encodeSignature(dst[sigStart:sigStart+signatureLen], dst[suffixStart:])
+	}
+	return dst, nil
+}
@@ -0,0 +1,305 @@
+package imageflux
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTextTemplate(t *testing.T) {
+	text := &Text{
+		Font:   &Font{Name: "Ryumin R-KL"},
+		Size:   30,
+		Width:  400,
+		Height: 80,
+		Text:   "{{.Price}} OFF",
+	}
+	tmpl, err := NewTextTemplate(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	text.Text = "changed"
+
+	got, err := tmpl.Execute(map[string]any{"Price": "50%, today"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "font=Ryumin%20R-KL%2Csize=30%2Cw=400%2Ch=80%2Ctext=50%25%2C%20today%20OFF"
+	if got.String() != want {
+		t.Errorf("want %q, got %q", want, got.String())
+	}
+
+	if _, err := tmpl.Execute(map[string]any{}); err == nil {
+		t.Error("want error for the missing key, got nil")
+	}
+	if _, err := NewTextTemplate(&Text{Text: "{{.Price"}); err == nil {
+		t.Error("want error for the invalid template, got nil")
+	}
+}
+
+var configTemplateCases = []struct {
+	proxy  *Proxy
+	config *Config
+}{
+	{
+		proxy: &Proxy{
+			Host: "demo.imageflux.jp",
+		},
+		config: nil,
+	},
+	{
+		proxy: &Proxy{
+			Host: "demo.imageflux.jp",
+		},
+		config: &Config{
+			Width: 400,
+			Texts: []*Text{
+				{
+					Font:   &Font{Name: "Ryumin R-KL"},
+					Size:   30,
+					Width:  400,
+					Height: 80,
+					Text:   "{{.Price}} OFF",
+				},
+			},
+		},
+	},
+	{
+		proxy: &Proxy{
+			Host:        "demo.imageflux.jp",
+			SecretBytes: []byte("testsigningsecret"),
+		},
+		config: &Config{
+			Width:   400,
+			Format:  FormatWebPAuto,
+			Expires: time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC),
+			Overlays: []*Overlay{
+				{Path: "/images/badge.png", Offset: image.Pt(10, 10)},
+			},
+			Texts: []*Text{
+				{
+					Font:       &Font{Name: "Ryumin R-KL"},
+					Size:       30,
+					Foreground: color.White,
+					Width:      400,
+					Height:     80,
+					Text:       "{{.Price}} OFF",
+					Extra:      map[string]string{"test-template": "1"},
+				},
+				{
+					Font:          &Font{Name: "Ryumin R-KL"},
+					Size:          20,
+					Width:         400,
+					Height:        40,
+					OverlayOrigin: OriginBottomCenter,
+					Text:          "until {{.Until}}",
+				},
+			},
+			Extra: map[string]string{"test-template": "2"},
+		},
+	},
+	{
+		proxy: &Proxy{
+			Hosts:          []string{"img1.example.com", "img2.example.com"},
+			PathPrefix:     "/img",
+			SignPathPrefix: true,
+			SecretBytes:    []byte("testsigningsecret"),
+		},
+		config: &Config{
+			Texts: []*Text{
+				{
+					Font:   &Font{Name: "Ryumin R-KL"},
+					Size:   30,
+					Width:  400,
+					Height: 80,
+					Text:   "{{.Price}} OFF",
+				},
+			},
+		},
+	},
+	{
+		// the custom parameter of the text contains "text=".
+		proxy: &Proxy{
+			Host:        "demo.imageflux.jp",
+			SecretBytes: []byte("testsigningsecret"),
+		},
+		config: &Config{
+			Width: 200,
+			Texts: []*Text{
+				{
+					Font:   &Font{Name: "Ryumin R-KL"},
+					Size:   30,
+					Width:  400,
+					Height: 80,
+					Text:   "{{.Price}} OFF",
+					Extra:  map[string]string{"note": "text="},
+				},
+			},
+			Extra: map[string]string{"note": "text="},
+		},
+	},
+}
+
+func TestConfigTemplate(t *testing.T) {
+	data := map[string]any{
+		"Price": "50%",
+		"Until": "6/24",
+	}
+	paths := []string{"/images/1.jpg", "images/2.jpg"}
+	for i, c := range configTemplateCases {
+		tmpl, err := c.proxy.CompileTemplate(c.config)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		cfg, err := tmpl.Execute(data)
+		if err != nil {
+			t.Fatalf("%d: %v", i, err)
+		}
+		for _, path := range paths {
+			want := c.proxy.Image(path, cfg).SignedURL()
+			got, err := tmpl.SignedURL(path, data)
+			if err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if got != want {
+				t.Errorf("%d, %q: want %s, got %s", i, path, want, got)
+			}
+
+			img, err := tmpl.Image(path, data)
+			if err != nil {
+				t.Fatalf("%d: %v", i, err)
+			}
+			if got := img.SignedURL(); got != want {
+				t.Errorf("%d, %q: want %s, got %s", i, path, want, got)
+			}
+		}
+	}
+}
+
+func TestConfigTemplate_error(t *testing.T) {
+	proxy := &Proxy{Host: "demo.imageflux.jp"}
+	_, err := proxy.CompileTemplate(&Config{Texts: []*Text{{Text: "{{"}}})
+	if err == nil {
+		t.Error("want error for the invalid template, got nil")
+	} else if msg := err.Error(); !strings.HasPrefix(msg, "imageflux: text 0: invalid text template: ") {
+		t.Errorf("unexpected error message: %s", msg)
+	}
+
+	tmpl, err := proxy.CompileTemplate(configTemplateCases[1].config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf := []byte("prefix")
+	buf, err = tmpl.AppendSignedURL(buf, "/images/1.jpg", map[string]any{})
+	if err == nil {
+		t.Error("want error for the missing key, got nil")
+	}
+	if string(buf) != "prefix" {
+		t.Errorf("want the buffer unchanged, got %q", buf)
+	}
+}
+
+func TestConfigTemplate_pathPrefixChanged(t *testing.T) {
+	proxy := &Proxy{
+		Host:           "demo.imageflux.jp",
+		SecretBytes:    []byte("testsigningsecret"),
+		PathPrefix:     "/img",
+		SignPathPrefix: true,
+	}
+	tmpl, err := proxy.CompileTemplate(configTemplateCases[1].config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{"Price": "50%", "Until": "6/24"}
+	want, err := tmpl.SignedURL("/images/1.jpg", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changing the path prefix after CompileTemplate doesn't affect the template.
+	verifier := *proxy
+	proxy.PathPrefix = "/other"
+	proxy.SignPathPrefix = false
+	got, err := tmpl.SignedURL("/images/1.jpg", data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("want %s, got %s", want, got)
+	}
+	res, err := verifier.Verify(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid {
+		t.Errorf("the signature of %s is invalid", got)
+	}
+}
+
+func TestConfigTemplate_copy(t *testing.T) {
+	proxy := &Proxy{Host: "demo.imageflux.jp"}
+	cfg := &Config{
+		Width: 200,
+		Overlays: []*Overlay{
+			{Path: "/logo.png"},
+		},
+		Texts: []*Text{
+			{
+				Font:   &Font{Name: "Ryumin R-KL"},
+				Size:   30,
+				Width:  400,
+				Height: 80,
+				Text:   "{{.Price}} OFF",
+			},
+		},
+	}
+	tmpl, err := proxy.CompileTemplate(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := map[string]any{"Price": "50%"}
+	want, err := tmpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// changing the config after CompileTemplate doesn't affect the template.
+	cfg.Width = 300
+	cfg.Overlays[0].Path = "/other.png"
+	cfg.Texts[0].Font.Name = "Other"
+
+	// changing the result of Execute doesn't affect the template.
+	want.Overlays[0].Width = 100
+	want.Texts[0].Font.Name = "Other"
+
+	got, err := tmpl.Execute(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Width != 200 || got.Overlays[0].Path != "/logo.png" || got.Overlays[0].Width != 0 || got.Texts[0].Font.Name != "Ryumin R-KL" {
+		t.Errorf("the template depends on the caller's config: %s", got)
+	}
+}
+
+func BenchmarkConfigTemplate_AppendSignedURL(b *testing.B) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+	tmpl, err := proxy.CompileTemplate(configTemplateCases[2].config)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := map[string]any{
+		"Price": "50%",
+		"Until": "6/24",
+	}
+	buf := make([]byte, 0, 512)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		buf, _ = tmpl.AppendSignedURL(buf[:0], "/images/1.jpg", data)
+	}
+}
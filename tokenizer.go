@@ -0,0 +1,315 @@
+package imageflux
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Token is a parameter in the parameter segment of an ImageFlux URL.
+type Token struct {
+	// Key is the key of the parameter, e.g. "w".
+	Key string
+
+	// RawValue is the value of the parameter as it appears in the URL.
+	// Nested parameters such as "(...)" of "l=" and "t=" are not split.
+	RawValue string
+
+	// Start and End are the byte offsets of the parameter in the input string.
+	// The span covers "key=value" and excludes the separator after it.
+	Start, End int
+}
+
+// Value returns the unescaped value of the parameter.
+func (t Token) Value() (string, error) {
+	v, err := url.PathUnescape(t.RawValue)
+	if err != nil {
+		return "", fmt.Errorf("imageflux: invalid value %q: %w", t.RawValue, err)
+	}
+	return v, nil
+}
+
+// Tokenizer splits the parameter segment of an ImageFlux URL path into tokens.
+// The parameters are separated by ',' or "%2C",
+// and the segment may start with "/c/" or "/c!/".
+//
+// Use Next to advance the tokenizer, and Token to get the current token:
+//
+//	t := imageflux.NewTokenizer("/c/w=200,h=100/images/1.jpg")
+//	for t.Next() {
+//		tok := t.Token()
+//		// ...
+//	}
+//	if err := t.Err(); err != nil {
+//		// ...
+//	}
+//	path := t.Rest() // "/images/1.jpg"
+type Tokenizer struct {
+	s    string
+	idx  int
+	mode tokenizerMode
+
+	tok Token
+	err error
+
+	started   bool
+	hasParams bool
+	done      bool
+}
+
+// tokenizerMode is the syntax of the parameters that a tokenizer reads.
+type tokenizerMode int
+
+const (
+	// modeConfig reads the parameter segment of the URL path.
+	// It may start with "/c/", and the image path follows the parameters.
+	modeConfig tokenizerMode = iota
+
+	// modeOverlay reads the parameters of an overlay, e.g. the value of "l=(...)" without the parentheses.
+	// The path of the overlay image follows the parameters,
+	// and it starts with '/' or "%2F".
+	modeOverlay
+
+	// modeText reads the parameters of a text, e.g. the value of "t=(...)" without the parentheses.
+	// '/' is not a separator, and the value of "text" is the rest of the input.
+	modeText
+
+	// modeFont reads the parameters of a font, e.g. the value of "font=(...)" without the parentheses.
+	// '/' is not a separator.
+	modeFont
+)
+
+// NewTokenizer returns a new tokenizer that reads s.
+func NewTokenizer(s string) *Tokenizer {
+	return &Tokenizer{s: s}
+}
+
+// newNestedTokenizer returns a tokenizer that reads the nested parameters s in the mode.
+// s doesn't have the "/c/" prefix.
+func newNestedTokenizer(s string, mode tokenizerMode) Tokenizer {
+	return Tokenizer{
+		s:         s,
+		mode:      mode,
+		started:   true,
+		hasParams: s != "",
+	}
+}
+
+// Next advances the tokenizer to the next parameter.
+// It returns false when there are no more parameters or an error occurs.
+func (t *Tokenizer) Next() bool {
+	if !t.begin() || t.done {
+		return false
+	}
+
+	start := t.idx
+	key, foundEqual := t.getKey()
+	if !foundEqual {
+		if key != "" {
+			t.err = fmt.Errorf("imageflux: missing '=' after key %q", key)
+		}
+		t.done = true
+		return false
+	}
+	if t.mode == modeText && key == "text" {
+		// the text can contain any character.
+		t.idx = len(t.s)
+		t.tok = Token{
+			Key:      key,
+			RawValue: t.s[start+len("text="):],
+			Start:    start,
+			End:      t.idx,
+		}
+		return true
+	}
+	value, err := t.getValue()
+	if err != nil {
+		t.err = err
+		t.done = true
+		return false
+	}
+	t.tok = Token{
+		Key:      key,
+		RawValue: value,
+		Start:    start,
+		End:      t.idx,
+	}
+	t.skipComma()
+	return true
+}
+
+// Token returns the current token.
+func (t *Tokenizer) Token() Token {
+	return t.tok
+}
+
+// Err returns the error that occurred during tokenization.
+func (t *Tokenizer) Err() error {
+	return t.err
+}
+
+// Rest returns the unread part of the input.
+// After Next returns false without an error, it is the image path.
+func (t *Tokenizer) Rest() string {
+	return t.s[t.idx:]
+}
+
+// Offset returns the byte offset of the unread part of the input.
+func (t *Tokenizer) Offset() int {
+	return t.idx
+}
+
+// begin skips the "/c/" prefix on the first call,
+// and reports whether the input has parameters.
+func (t *Tokenizer) begin() bool {
+	if !t.started {
+		t.started = true
+		t.hasParams = t.hasParameter()
+	}
+	return t.hasParams
+}
+
+func (t *Tokenizer) hasParameter() bool {
+	i := t.idx
+	if i >= len(t.s) {
+		return false
+	}
+
+	// skip leading slash
+	if t.s[i] == '/' {
+		i++
+	}
+
+	// parameters may start with 'c/' or 'c!/'.
+	if strings.HasPrefix(t.s[i:], "c/") {
+		t.idx = i + len("c/")
+		return true
+	}
+	if strings.HasPrefix(t.s[i:], "c!/") {
+		t.idx = i + len("c!/")
+		return true
+	}
+
+	// guess whether the string has parameters.
+	// parameters always have '=', so we search for it.
+	for ; i < len(t.s); i++ {
+		if t.s[i] == '/' {
+			// we didn't find any parameter.
+			return false
+		}
+
+		if t.s[i] == '=' {
+			// we might find a parameter.
+			if t.s[t.idx] == '/' {
+				t.idx++
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// getKey returns the key at the current index and advances the index.
+func (t *Tokenizer) getKey() (key string, foundEqual bool) {
+	i := t.idx
+	for ; i < len(t.s); i++ {
+		switch t.s[i] {
+		case '=':
+			key = t.s[t.idx:i]
+			t.idx = i + 1
+			foundEqual = true
+			return
+		case ',':
+			key = t.s[t.idx:i]
+			t.idx = i
+			foundEqual = false
+			return
+		case '/':
+			if t.slashIsSeparator() {
+				key = t.s[t.idx:i]
+				t.idx = i
+				foundEqual = false
+				return
+			}
+		case '%':
+			// "%2F" is encoded slash '/' that starts the path of the overlay image.
+			if t.mode == modeOverlay && hasEncoded(t.s[i:], "%2F") {
+				key = t.s[t.idx:i]
+				t.idx = i
+				foundEqual = false
+				return
+			}
+		}
+	}
+	return t.s[t.idx:i], false
+}
+
+// getValue returns the value at the current index and advances the index.
+// The commas in parentheses don't separate the value.
+// The parentheses nest in all modes, because the value of "font" in a text
+// is also parenthesized, e.g. "t=(font=(name,instance=Bold),text=...)".
+// It is the form that Font.String returns for the named instances and the variables.
+func (t *Tokenizer) getValue() (string, error) {
+	var nest int
+	i := t.idx
+LOOP:
+	for ; i < len(t.s); i++ {
+		switch t.s[i] {
+		case '(':
+			nest++
+		case ')':
+			nest--
+		case ',':
+			if nest == 0 {
+				break LOOP
+			}
+		case '/':
+			if nest == 0 && t.slashIsSeparator() {
+				break LOOP
+			}
+		case '%':
+			if nest != 0 {
+				break
+			}
+			// "%2C" is encoded comma ','.
+			if hasEncoded(t.s[i:], "%2C") {
+				break LOOP
+			}
+			// "%2F" is encoded slash '/' that starts the path of the overlay image.
+			if t.mode == modeOverlay && hasEncoded(t.s[i:], "%2F") {
+				break LOOP
+			}
+		}
+	}
+	if nest != 0 {
+		return "", errors.New("imageflux: invalid value: parenthesis is not closed")
+	}
+	value := t.s[t.idx:i]
+	t.idx = i
+	return value, nil
+}
+
+// slashIsSeparator reports whether '/' ends the parameters in the mode.
+func (t *Tokenizer) slashIsSeparator() bool {
+	return t.mode == modeConfig || t.mode == modeOverlay
+}
+
+// hasEncoded reports whether s starts with the percent-encoded character enc, ignoring case.
+func hasEncoded(s, enc string) bool {
+	return len(s) >= len(enc) && strings.EqualFold(s[:len(enc)], enc)
+}
+
+// skipComma skips the ',' at the current index and returns true if it was found.
+func (t *Tokenizer) skipComma() (skipped bool) {
+	if t.idx < len(t.s) && t.s[t.idx] == ',' {
+		t.idx++
+		return true
+	}
+	if hasEncoded(t.s[t.idx:], "%2C") {
+		// "%2C" is encoded comma ','.
+		t.idx += 3
+		return true
+	}
+	return false
+}
@@ -0,0 +1,279 @@
+package imageflux
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTokenizer(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []Token
+		rest   string
+	}{
+		{
+			input:  "",
+			tokens: nil,
+			rest:   "",
+		},
+		{
+			input:  "/images/1.jpg",
+			tokens: nil,
+			rest:   "/images/1.jpg",
+		},
+		{
+			input: "/c/w=200,h=100/images/1.jpg",
+			tokens: []Token{
+				{Key: "w", RawValue: "200", Start: 3, End: 8},
+				{Key: "h", RawValue: "100", Start: 9, End: 14},
+			},
+			rest: "/images/1.jpg",
+		},
+		{
+			input: "/c!/w=200%2Ch=100/images/1.jpg",
+			tokens: []Token{
+				{Key: "w", RawValue: "200", Start: 4, End: 9},
+				{Key: "h", RawValue: "100", Start: 12, End: 17},
+			},
+			rest: "/images/1.jpg",
+		},
+		{
+			// without the "/c/" prefix.
+			input: "/w=200%2ch=100/images/1.jpg",
+			tokens: []Token{
+				{Key: "w", RawValue: "200", Start: 1, End: 6},
+				{Key: "h", RawValue: "100", Start: 9, End: 14},
+			},
+			rest: "/images/1.jpg",
+		},
+		{
+			// nested parameters are not split.
+			input: "/c/l=(g=tl%2Cl=/logo.png),w=200/images/1.jpg",
+			tokens: []Token{
+				{Key: "l", RawValue: "(g=tl%2Cl=/logo.png)", Start: 3, End: 25},
+				{Key: "w", RawValue: "200", Start: 26, End: 31},
+			},
+			rest: "/images/1.jpg",
+		},
+		{
+			// parentheses nested twice.
+			input: "/c/t=(font=(Noto,instance=Bold),text=a),w=200/images/1.jpg",
+			tokens: []Token{
+				{Key: "t", RawValue: "(font=(Noto,instance=Bold),text=a)", Start: 3, End: 39},
+				{Key: "w", RawValue: "200", Start: 40, End: 45},
+			},
+			rest: "/images/1.jpg",
+		},
+		{
+			// trailing comma
+			input: "/c/w=200,/images/1.jpg",
+			tokens: []Token{
+				{Key: "w", RawValue: "200", Start: 3, End: 8},
+			},
+			rest: "/images/1.jpg",
+		},
+	}
+
+	for _, tt := range tests {
+		tokenizer := NewTokenizer(tt.input)
+		var tokens []Token
+		for tokenizer.Next() {
+			tokens = append(tokens, tokenizer.Token())
+		}
+		if err := tokenizer.Err(); err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.tokens, tokens); diff != "" {
+			t.Errorf("%q: tokens mismatch (-want +got):\n%s", tt.input, diff)
+		}
+		if got := tokenizer.Rest(); got != tt.rest {
+			t.Errorf("%q: want rest %q, got %q", tt.input, tt.rest, got)
+		}
+		for _, tok := range tokens {
+			if got, want := tt.input[tok.Start:tok.End], tok.Key+"="+tok.RawValue; got != want {
+				t.Errorf("%q: want span %q, got %q", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestTokenizer_error(t *testing.T) {
+	tests := []struct {
+		input string
+		err   string
+	}{
+		{
+			input: "/c/w=200,h/images/1.jpg",
+			err:   `imageflux: missing '=' after key "h"`,
+		},
+		{
+			input: "/c/l=(g=tl/images/1.jpg",
+			err:   "imageflux: invalid value: parenthesis is not closed",
+		},
+	}
+
+	for _, tt := range tests {
+		tokenizer := NewTokenizer(tt.input)
+		for tokenizer.Next() {
+		}
+		err := tokenizer.Err()
+		if err == nil {
+			t.Errorf("%q: want error, got nil", tt.input)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.err, err.Error())
+		}
+		if tokenizer.Next() {
+			t.Errorf("%q: want Next to return false after error", tt.input)
+		}
+	}
+}
+
+func TestTokenizer_nested(t *testing.T) {
+	tests := []struct {
+		mode   tokenizerMode
+		input  string
+		tokens []Token
+		rest   string
+	}{
+		{
+			// the overlay image path starts with '/'.
+			mode:  modeOverlay,
+			input: "w=100,g=se/images/logo.png",
+			tokens: []Token{
+				{Key: "w", RawValue: "100", Start: 0, End: 5},
+				{Key: "g", RawValue: "se", Start: 6, End: 10},
+			},
+			rest: "/images/logo.png",
+		},
+		{
+			// the overlay image path starts with "%2F".
+			mode:  modeOverlay,
+			input: "w=100%2Cg=se%2Fimages%2Flogo.png",
+			tokens: []Token{
+				{Key: "w", RawValue: "100", Start: 0, End: 5},
+				{Key: "g", RawValue: "se", Start: 8, End: 12},
+			},
+			rest: "%2Fimages%2Flogo.png",
+		},
+		{
+			// without parameters.
+			mode:   modeOverlay,
+			input:  "%2fimages%2flogo.png",
+			tokens: nil,
+			rest:   "%2fimages%2flogo.png",
+		},
+		{
+			// '/' in the values and the nested font specification.
+			mode:  modeText,
+			input: "font=(Noto%2Cinstance=Bold),b=00000080,text=a,b/c%2Cd",
+			tokens: []Token{
+				{Key: "font", RawValue: "(Noto%2Cinstance=Bold)", Start: 0, End: 27},
+				{Key: "b", RawValue: "00000080", Start: 28, End: 38},
+				{Key: "text", RawValue: "a,b/c%2Cd", Start: 39, End: 53},
+			},
+			rest: "",
+		},
+		{
+			// the commas in the nested font specification don't separate the parameters.
+			mode:  modeText,
+			input: "font=(Noto,var=wght:700,var=slnt:-16),size=30,text=(a,b)",
+			tokens: []Token{
+				{Key: "font", RawValue: "(Noto,var=wght:700,var=slnt:-16)", Start: 0, End: 37},
+				{Key: "size", RawValue: "30", Start: 38, End: 45},
+				{Key: "text", RawValue: "(a,b)", Start: 46, End: 56},
+			},
+			rest: "",
+		},
+		{
+			mode:  modeFont,
+			input: "instance=Bold%2Cvar=wght:700,var=slnt:-16",
+			tokens: []Token{
+				{Key: "instance", RawValue: "Bold", Start: 0, End: 13},
+				{Key: "var", RawValue: "wght:700", Start: 16, End: 28},
+				{Key: "var", RawValue: "slnt:-16", Start: 29, End: 41},
+			},
+			rest: "",
+		},
+	}
+
+	for _, tt := range tests {
+		tokenizer := newNestedTokenizer(tt.input, tt.mode)
+		var tokens []Token
+		for tokenizer.Next() {
+			tokens = append(tokens, tokenizer.Token())
+		}
+		if err := tokenizer.Err(); err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.input, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.tokens, tokens); diff != "" {
+			t.Errorf("%q: tokens mismatch (-want +got):\n%s", tt.input, diff)
+		}
+		if got := tokenizer.Rest(); got != tt.rest {
+			t.Errorf("%q: want rest %q, got %q", tt.input, tt.rest, got)
+		}
+		for _, tok := range tokens {
+			if got, want := tt.input[tok.Start:tok.End], tok.Key+"="+tok.RawValue; got != want {
+				t.Errorf("%q: want span %q, got %q", tt.input, want, got)
+			}
+		}
+	}
+}
+
+func TestTokenizer_nested_error(t *testing.T) {
+	tests := []struct {
+		mode  tokenizerMode
+		input string
+		err   string
+	}{
+		{
+			mode:  modeOverlay,
+			input: "w=100,g/images/logo.png",
+			err:   `imageflux: missing '=' after key "g"`,
+		},
+		{
+			mode:  modeText,
+			input: "font=(Noto%2Cinstance=Bold,text=hello",
+			err:   "imageflux: invalid value: parenthesis is not closed",
+		},
+		{
+			mode:  modeFont,
+			input: "instance",
+			err:   `imageflux: missing '=' after key "instance"`,
+		},
+	}
+
+	for _, tt := range tests {
+		tokenizer := newNestedTokenizer(tt.input, tt.mode)
+		for tokenizer.Next() {
+		}
+		err := tokenizer.Err()
+		if err == nil {
+			t.Errorf("%q: want error, got nil", tt.input)
+			continue
+		}
+		if err.Error() != tt.err {
+			t.Errorf("%q: want %q, got %q", tt.input, tt.err, err.Error())
+		}
+	}
+}
+
+func TestToken_Value(t *testing.T) {
+	tok := Token{Key: "t", RawValue: "hello%20world"}
+	got, err := tok.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello world" {
+		t.Errorf("want %q, got %q", "hello world", got)
+	}
+
+	tok = Token{Key: "t", RawValue: "%zz"}
+	if _, err := tok.Value(); err == nil {
+		t.Error("want error, got nil")
+	}
+}
@@ -0,0 +1,101 @@
+package imageflux
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// VerifyResult is the result of Proxy.Verify.
+type VerifyResult struct {
+	// Image is the parsed image.
+	Image *Image
+
+	// Signed is true if the URL has a signature.
+	Signed bool
+
+	// Valid is true if the signature is valid.
+	// It is always false if the proxy has no signing secret.
+	Valid bool
+
+	// SignatureVersion is the version of the signature, e.g. "1".
+	// It is empty if the URL has no signature.
+	SignatureVersion string
+
+	// KeyIndex is the index of the secret that matched the signature.
+	// 0 is the current secret, and i+1 is Proxy.PreviousSecrets[i].
+	// It is -1 if no secret matched.
+	KeyIndex int
+
+	// Expires is the expiration time of the URL.
+	// It is zero if the URL does not expire.
+	Expires time.Time
+
+	// Expired is true if the URL has expired.
+	Expired bool
+
+	// Warnings are non-fatal problems found in the URL,
+	// such as deprecated aliases.
+	Warnings []string
+}
+
+// Verify parses rawURL and verifies its signature and expiration.
+// Unlike Parse, an invalid signature or an expired URL is not an error;
+// they are reported in the result.
+// The error is returned only when rawURL is malformed,
+// or it doesn't have the signed path prefix of the proxy.
+func (p *Proxy) Verify(rawURL string) (*VerifyResult, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("imageflux: invalid url %q: %w", rawURL, err)
+	}
+
+	state, err := p.newParseState(u.EscapedPath(), u.Query().Get("sig"), &Config{})
+	if err != nil {
+		return nil, err
+	}
+	state.allowExpired = true
+	c, rest, payload, err := state.parseConfigAndPayload(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &VerifyResult{
+		Image: &Image{
+			Proxy:  p,
+			Path:   rest,
+			Config: c,
+		},
+		KeyIndex: -1,
+		Expires:  c.Expires,
+		Warnings: state.warnings,
+	}
+	if !c.Expires.IsZero() {
+		result.Expired = !c.Expires.After(nowFunc())
+	}
+	if state.signature != "" {
+		result.Signed = true
+		if version, _, ok := strings.Cut(state.signature, "."); ok {
+			result.SignatureVersion = version
+		}
+		if len(p.secret()) != 0 {
+			if idx, err := p.verifySignature(state.signature, payload); err == nil {
+				result.Valid = true
+				result.KeyIndex = idx
+			}
+		}
+	}
+	return result, nil
+}
+
+// checkSignature returns ErrInvalidSignature if the proxy has a signing secret
+// and res is not signed with it.
+// It is used before re-signing the verified URL,
+// so that the proxy doesn't sign the transformations that nobody has signed.
+func (p *Proxy) checkSignature(res *VerifyResult) error {
+	if p.hasSecret() && !(res.Signed && res.Valid) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
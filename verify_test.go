@@ -0,0 +1,204 @@
+package imageflux
+
+import (
+	"image"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestProxy_Verify(t *testing.T) {
+	fixTime(t, time.Date(2023, 6, 24, 9, 23, 30, 0, time.UTC))
+
+	proxy := &Proxy{
+		Host:            "demo.imageflux.jp",
+		SecretBytes:     []byte("testsigningsecret"),
+		PreviousSecrets: [][]byte{[]byte("oldsecret")},
+	}
+
+	cases := []struct {
+		input string
+		want  *VerifyResult
+	}{
+		{
+			input: "https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path:   "/images/1.jpg",
+					Config: &Config{Width: 200},
+				},
+				Signed:           true,
+				Valid:            true,
+				SignatureVersion: "1",
+				KeyIndex:         0,
+			},
+		},
+		{
+			// signed with the previous secret
+			input: "https://demo.imageflux.jp/c/sig=1.V5PHZWHTmE_TGmwBgGpKzbGm2Lo2R4uTxcB2hE3vLLs=%2Cw=200/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path:   "/images/1.jpg",
+					Config: &Config{Width: 200},
+				},
+				Signed:           true,
+				Valid:            true,
+				SignatureVersion: "1",
+				KeyIndex:         1,
+			},
+		},
+		{
+			// the signature in the query string
+			input: "https://demo.imageflux.jp/c/w=200/images/1.jpg?sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=",
+			want: &VerifyResult{
+				Image: &Image{
+					Path:   "/images/1.jpg",
+					Config: &Config{Width: 200},
+				},
+				Signed:           true,
+				Valid:            true,
+				SignatureVersion: "1",
+				KeyIndex:         0,
+			},
+		},
+		{
+			// invalid signature
+			input: "https://demo.imageflux.jp/c/sig=1.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=300/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path:   "/images/1.jpg",
+					Config: &Config{Width: 300},
+				},
+				Signed:           true,
+				Valid:            false,
+				SignatureVersion: "1",
+				KeyIndex:         -1,
+			},
+		},
+		{
+			// unknown signature version
+			input: "https://demo.imageflux.jp/c/sig=2.tiKX5u2kw6wp9zDgl1tLiOIi8IsoRIBw8fVgVc0yrNg=%2Cw=200/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path:   "/images/1.jpg",
+					Config: &Config{Width: 200},
+				},
+				Signed:           true,
+				Valid:            false,
+				SignatureVersion: "2",
+				KeyIndex:         -1,
+			},
+		},
+		{
+			// no signature
+			input: "https://demo.imageflux.jp/c/w=200/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path:   "/images/1.jpg",
+					Config: &Config{Width: 200},
+				},
+				KeyIndex: -1,
+			},
+		},
+		{
+			// expired
+			input: "https://demo.imageflux.jp/c/sig=1.Aa05y5VnlhocCF-RABA2--P7-4kc8E9LqJ86BqGosqw=%2Cw=200%2Cexpires=2023-06-24T09:23:00Z/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path: "/images/1.jpg",
+					Config: &Config{
+						Width:   200,
+						Expires: time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC),
+					},
+				},
+				Signed:           true,
+				Valid:            true,
+				SignatureVersion: "1",
+				KeyIndex:         0,
+				Expires:          time.Date(2023, 6, 24, 9, 23, 0, 0, time.UTC),
+				Expired:          true,
+			},
+		},
+		{
+			// not expired yet
+			input: "https://demo.imageflux.jp/c/sig=1.O8sQCnkM4ucHryeshnrzPx6yfqqgXnHKnMElmW_WUfA=%2Cw=200%2Cexpires=2023-06-24T09:24:00Z/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path: "/images/1.jpg",
+					Config: &Config{
+						Width:   200,
+						Expires: time.Date(2023, 6, 24, 9, 24, 0, 0, time.UTC),
+					},
+				},
+				Signed:           true,
+				Valid:            true,
+				SignatureVersion: "1",
+				KeyIndex:         0,
+				Expires:          time.Date(2023, 6, 24, 9, 24, 0, 0, time.UTC),
+			},
+		},
+		{
+			// deprecated aliases
+			input: "https://demo.imageflux.jp/c/c=0:0:100:100%2Cr=2%2Cl=(cr=0:0:0.5:0.5%2Fimages%2F2.png)%2Cf=webp:jpeg/images/1.jpg",
+			want: &VerifyResult{
+				Image: &Image{
+					Path: "/images/1.jpg",
+					Config: &Config{
+						OutputClip:   image.Rect(0, 0, 100, 100),
+						OutputRotate: RotateTopRight,
+						Overlays: []*Overlay{
+							{
+								Path:            "/images/2.png",
+								OutputClipRatio: image.Rect(0, 0, 32768, 32768),
+								ClipMax:         image.Pt(65536, 65536),
+							},
+						},
+						Format: FormatWebPFromJPEG,
+					},
+				},
+				KeyIndex: -1,
+				Warnings: []string{
+					`deprecated key "c" is used, use "oc" instead`,
+					`deprecated key "r" is used, use "or" instead`,
+					`deprecated key "cr" is used, use "ocr" instead`,
+					`deprecated format "webp:jpeg" is used, use "webp:jpg" instead`,
+				},
+			},
+		},
+	}
+
+	for _, c := range cases {
+		got, err := proxy.Verify(c.input)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", c.input, err)
+			continue
+		}
+		opt := cmpopts.IgnoreFields(Image{}, "Proxy")
+		if diff := cmp.Diff(c.want, got, opt); diff != "" {
+			t.Errorf("%q: mismatch (-want +got):\n%s", c.input, diff)
+		}
+	}
+}
+
+func TestProxy_Verify_error(t *testing.T) {
+	proxy := &Proxy{
+		Host:        "demo.imageflux.jp",
+		SecretBytes: []byte("testsigningsecret"),
+	}
+
+	cases := []string{
+		// malformed url
+		"https://demo.imageflux.jp/%XX",
+
+		// malformed parameters
+		"https://demo.imageflux.jp/c/w=-1/images/1.jpg",
+	}
+
+	for _, c := range cases {
+		if _, err := proxy.Verify(c); err == nil {
+			t.Errorf("%q: expected error", c)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package imageflux
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"math"
+	"slices"
+)
+
+// maxWatermarkTiles is the maximum number of the tiles of a tiled watermark.
+// Each tile is an overlay parameter, so too many tiles make the URL too long.
+const maxWatermarkTiles = 100
+
+// Watermark is the layout of a watermark, e.g. a logo at the bottom-right corner.
+// The sizes are relative to the width of the output image,
+// so the watermark looks the same regardless of the size of the output image.
+type Watermark struct {
+	// Path is the path of the watermark image.
+	Path string
+
+	// Origin is the corner or the edge of the output image that the watermark is anchored to.
+	// If it is OriginDefault, OriginBottomRight is used.
+	Origin Origin
+
+	// Margin is the margin between the watermark and the edges of the output image,
+	// in ratio of the width of the output image, e.g. 0.02 for 2%.
+	// The vertical margin has the same length in pixel as the horizontal one.
+	Margin float64
+
+	// Size is the width of the watermark in ratio of the width of the output image, e.g. 0.1 for 10%.
+	// The aspect ratio of the watermark image is kept.
+	Size float64
+
+	// MaskType specifies the area of the watermark image to be drawn, e.g. MaskTypeAlpha.
+	MaskType MaskType
+
+	// Tile tiles the watermark over the whole output image.
+	// The tiles are placed in a grid from the top-left corner, and Origin and Margin are ignored.
+	Tile bool
+
+	// Gap is the gap between the tiles in ratio of the width of the output image.
+	Gap float64
+}
+
+// Overlays returns the overlays that draw the watermark on the output image of width x height pixels.
+func (w *Watermark) Overlays(width, height int) ([]*Overlay, error) {
+	if w.Path == "" {
+		return nil, errors.New("imageflux: the path of the watermark is required")
+	}
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("imageflux: the size of the output image must be positive, but got %dx%d", width, height)
+	}
+	if !(w.Size > 0 && w.Size <= 1) {
+		return nil, fmt.Errorf("imageflux: the size of the watermark must be in (0, 1], but got %g", w.Size)
+	}
+	if !(w.Margin >= 0 && w.Margin < 1) {
+		return nil, fmt.Errorf("imageflux: the margin of the watermark must be in [0, 1), but got %g", w.Margin)
+	}
+	if !(w.Gap >= 0 && w.Gap < 1) {
+		return nil, fmt.Errorf("imageflux: the gap of the watermark must be in [0, 1), but got %g", w.Gap)
+	}
+	if w.Origin < OriginDefault || w.Origin >= originMax {
+		return nil, fmt.Errorf("imageflux: invalid origin of the watermark: %d", w.Origin)
+	}
+
+	size := max(int(math.Round(w.Size*float64(width))), 1)
+	if w.Tile {
+		return w.tiles(width, height, size)
+	}
+
+	origin := w.Origin
+	if origin == OriginDefault {
+		origin = OriginBottomRight
+	}
+	overlay := &Overlay{
+		Path:          w.Path,
+		Width:         size,
+		OverlayOrigin: origin,
+		MaskType:      w.MaskType,
+	}
+	if w.Margin > 0 {
+		// the offset ratio is margin/width and margin/height,
+		// and the center origins have no margin in their direction.
+		margin := int(math.Round(w.Margin * float64(width)))
+		x, y := margin, margin
+		switch origin {
+		case OriginTopCenter, OriginBottomCenter:
+			x = 0
+		case OriginMiddleLeft, OriginMiddleRight:
+			y = 0
+		case OriginMiddleCenter:
+			x, y = 0, 0
+		}
+		overlay.OffsetRatio = image.Pt(x, y)
+		overlay.OffsetMax = image.Pt(width, height)
+	}
+	return []*Overlay{overlay}, nil
+}
+
+// tiles returns the grid of the tiles covering the output image.
+// Each tile is scaled to fit in a square cell of size x size pixels.
+func (w *Watermark) tiles(width, height, size int) ([]*Overlay, error) {
+	step := size + int(math.Round(w.Gap*float64(width)))
+	cols := (width + step - 1) / step
+	rows := (height + step - 1) / step
+	if cols*rows > maxWatermarkTiles {
+		return nil, fmt.Errorf("imageflux: the watermark needs %d tiles, but at most %d tiles are allowed", cols*rows, maxWatermarkTiles)
+	}
+
+	overlays := make([]*Overlay, 0, cols*rows)
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			overlays = append(overlays, &Overlay{
+				Path:          w.Path,
+				Width:         size,
+				Height:        size,
+				AspectMode:    AspectModeScale,
+				OffsetRatio:   image.Pt(col*step, row*step),
+				OffsetMax:     image.Pt(width, height),
+				OverlayOrigin: OriginTopLeft,
+				MaskType:      w.MaskType,
+			})
+		}
+	}
+	return overlays, nil
+}
+
+// Apply returns a copy of cfg with the watermark.
+// The size of the output image is cfg.Width x cfg.Height, so both of them must be specified.
+func (w *Watermark) Apply(cfg *Config) (*Config, error) {
+	overlays, err := w.Overlays(cfg.Width, cfg.Height)
+	if err != nil {
+		return nil, err
+	}
+	ret := *cfg
+	ret.Overlays = append(slices.Clip(cfg.Overlays), overlays...)
+	return &ret, nil
+}
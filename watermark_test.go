@@ -0,0 +1,182 @@
+package imageflux
+
+import (
+	"image"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestWatermark_Overlays(t *testing.T) {
+	tests := []struct {
+		watermark *Watermark
+		want      []*Overlay
+	}{
+		{
+			watermark: &Watermark{
+				Path:     "/logo.png",
+				Margin:   0.02,
+				Size:     0.1,
+				MaskType: MaskTypeAlpha,
+			},
+			want: []*Overlay{
+				{
+					Path:          "/logo.png",
+					Width:         100,
+					OffsetRatio:   image.Pt(20, 20),
+					OffsetMax:     image.Pt(1000, 500),
+					OverlayOrigin: OriginBottomRight,
+					MaskType:      MaskTypeAlpha,
+				},
+			},
+		},
+		{
+			watermark: &Watermark{
+				Path:   "/logo.png",
+				Origin: OriginTopCenter,
+				Margin: 0.02,
+				Size:   0.2,
+			},
+			want: []*Overlay{
+				{
+					Path:          "/logo.png",
+					Width:         200,
+					OffsetRatio:   image.Pt(0, 20),
+					OffsetMax:     image.Pt(1000, 500),
+					OverlayOrigin: OriginTopCenter,
+				},
+			},
+		},
+		{
+			watermark: &Watermark{
+				Path:   "/logo.png",
+				Origin: OriginMiddleCenter,
+				Size:   0.5,
+			},
+			want: []*Overlay{
+				{
+					Path:          "/logo.png",
+					Width:         500,
+					OverlayOrigin: OriginMiddleCenter,
+				},
+			},
+		},
+		{
+			watermark: &Watermark{
+				Path: "/logo.png",
+				Size: 0.4,
+				Gap:  0.1,
+				Tile: true,
+			},
+			want: []*Overlay{
+				{
+					Path:          "/logo.png",
+					Width:         400,
+					Height:        400,
+					AspectMode:    AspectModeScale,
+					OffsetMax:     image.Pt(1000, 500),
+					OverlayOrigin: OriginTopLeft,
+				},
+				{
+					Path:          "/logo.png",
+					Width:         400,
+					Height:        400,
+					AspectMode:    AspectModeScale,
+					OffsetRatio:   image.Pt(500, 0),
+					OffsetMax:     image.Pt(1000, 500),
+					OverlayOrigin: OriginTopLeft,
+				},
+			},
+		},
+	}
+	for i, tt := range tests {
+		got, err := tt.watermark.Overlays(1000, 500)
+		if err != nil {
+			t.Errorf("%d: unexpected error: %v", i, err)
+			continue
+		}
+		if diff := cmp.Diff(tt.want, got); diff != "" {
+			t.Errorf("%d: Overlays() mismatch (-want +got):\n%s", i, diff)
+		}
+	}
+}
+
+func TestWatermark_Overlays_tile(t *testing.T) {
+	w := &Watermark{
+		Path: "/logo.png",
+		Size: 0.25,
+		Tile: true,
+	}
+	overlays, err := w.Overlays(1000, 600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 4 columns x 3 rows cover 1000x600 pixels with 250x250 pixel cells.
+	if len(overlays) != 12 {
+		t.Fatalf("want 12 tiles, got %d", len(overlays))
+	}
+	last := overlays[len(overlays)-1]
+	if want := image.Pt(750, 500); last.OffsetRatio != want {
+		t.Errorf("want the last tile at %v, got %v", want, last.OffsetRatio)
+	}
+}
+
+func TestWatermark_Overlays_error(t *testing.T) {
+	tests := []struct {
+		watermark *Watermark
+		want      string
+	}{
+		{&Watermark{Size: 0.1}, "path of the watermark is required"},
+		{&Watermark{Path: "/logo.png"}, "size of the watermark"},
+		{&Watermark{Path: "/logo.png", Size: 1.5}, "size of the watermark"},
+		{&Watermark{Path: "/logo.png", Size: 0.1, Margin: -0.1}, "margin of the watermark"},
+		{&Watermark{Path: "/logo.png", Size: 0.1, Gap: 1}, "gap of the watermark"},
+		{&Watermark{Path: "/logo.png", Size: 0.1, Origin: originMax}, "invalid origin"},
+		{&Watermark{Path: "/logo.png", Size: 0.01, Tile: true}, "tiles"},
+	}
+	for i, tt := range tests {
+		_, err := tt.watermark.Overlays(1000, 500)
+		if err == nil {
+			t.Errorf("%d: want error, got nil", i)
+			continue
+		}
+		if !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%d: want error containing %q, got %v", i, tt.want, err)
+		}
+	}
+
+	w := &Watermark{Path: "/logo.png", Size: 0.1}
+	if _, err := w.Overlays(0, 500); err == nil {
+		t.Error("want error for the unknown size, got nil")
+	}
+}
+
+func TestWatermark_Apply(t *testing.T) {
+	w := &Watermark{
+		Path:     "/logo.png",
+		Margin:   0.02,
+		Size:     0.1,
+		MaskType: MaskTypeAlpha,
+	}
+	cfg := &Config{
+		Width:  1000,
+		Height: 500,
+	}
+	got, err := w.Apply(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "w=1000%2Ch=500%2Cl=(w=100%2Cxr=0.02%2Cyr=0.04%2Clg=9%2Cmask=alpha%2Flogo.png)"
+	if got.String() != want {
+		t.Errorf("want %s, got %s", want, got.String())
+	}
+	if len(cfg.Overlays) != 0 {
+		t.Error("Apply() modified the input")
+	}
+
+	if _, err := w.Apply(&Config{Width: 1000}); err == nil {
+		t.Error("want error for the unknown height, got nil")
+	}
+}